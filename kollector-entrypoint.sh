@@ -1,6 +1,4 @@
 #!/bin/sh
-EXIT_CODE=0
-
 EXEC_COMMAND_ARGS=$@
 
 if test -f "$1"; then
@@ -10,13 +8,5 @@ else
     EXEC_COMMAND_ARGS="/usr/bin/kollector "$@
 fi
 
-# exit code 2 means we have watch timeout just need to reconnect
-while true; do
-    $EXEC_COMMAND_ARGS
-    EXIT_CODE=$?    
-    echo "$EXEC_COMMAND_ARGS" " exited with code "$EXIT_CODE
-
-    if [ $EXIT_CODE -ne 4 ]; then
-        exit $EXIT_CODE
-    fi
-done
\ No newline at end of file
+# the kollector reconnects to the websocket by itself, it doesn't need to be restarted
+exec $EXEC_COMMAND_ARGS
@@ -9,6 +9,7 @@ import (
 
 	"github.com/armosec/utils-k8s-go/probes"
 	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func main() {
@@ -46,11 +47,22 @@ func main() {
 		}
 	}()
 
+	go func() {
+		for {
+			wh.NetworkPolicyWatch()
+		}
+	}()
+
 	go func() {
 		for {
 			wh.SecretWatch()
 		}
 	}()
+	go func() {
+		for {
+			wh.ConfigMapWatch()
+		}
+	}()
 	go func() {
 		for {
 			wh.NamespaceWatch()
@@ -61,7 +73,129 @@ func main() {
 			wh.CronJobWatch()
 		}
 	}()
-	glog.Error(wh.WebSocketHandle.SendReportRoutine(&isServerReady, wh.SetFirstReportFlag))
+	go func() {
+		for {
+			wh.IngressWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.GatewayWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.HTTPRouteWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.RoleWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.ClusterRoleWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.RoleBindingWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.ClusterRoleBindingWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.ServiceAccountWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.PersistentVolumeWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.PersistentVolumeClaimWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.StorageClassWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.EventWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.MutatingWebhookWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.ValidatingWebhookWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.DeploymentWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.StatefulSetWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.DaemonSetWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.JobWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.HorizontalPodAutoscalerWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.PodDisruptionBudgetWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.ResourceQuotaWatch()
+		}
+	}()
+	go func() {
+		for {
+			wh.LimitRangeWatch()
+		}
+	}()
+	for _, resource := range wh.Resources() {
+		go func(resource schema.GroupVersionResource) {
+			for {
+				wh.ResourceWatch(resource)
+			}
+		}(resource)
+	}
+	if wh.WebSocketHandle == nil {
+		// reporting to the local sinks only
+		isServerReady = true
+		select {}
+	}
+	glog.Error(wh.WebSocketHandle.SendReportRoutine(&isServerReady, wh.RequestResync, wh.ConnectionStateChanged))
 
 }
 
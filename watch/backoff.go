@@ -0,0 +1,39 @@
+package watch
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 2 * time.Minute
+)
+
+// backoff is an exponential backoff with jitter, the delay doubles on every try up to max
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{min: min, max: max}
+}
+
+// next returns the delay before the next try, a random duration between half and the whole of the current delay,
+// so the clusters disconnected together don't reconnect together
+func (b *backoff) next() time.Duration {
+	delay := b.max
+	if b.attempt < 32 {
+		if d := b.min << uint(b.attempt); d > 0 && d < b.max {
+			delay = d
+		}
+	}
+	b.attempt++
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (b *backoff) reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,268 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	core "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// CapacityContext are the scaling, disruption and resource settings applying to a microservice
+type CapacityContext struct {
+	HorizontalPodAutoscalers []HorizontalPodAutoscalerSettings `json:"horizontalPodAutoscalers"`
+	PodDisruptionBudgets     []PodDisruptionBudgetSettings     `json:"podDisruptionBudgets"`
+	ResourceQuotas           []ResourceQuotaSettings           `json:"resourceQuotas"`
+	LimitRanges              []LimitRangeSettings              `json:"limitRanges"`
+}
+
+// HorizontalPodAutoscalerSettings are the settings of an autoscaler targeting the owner of the microservice
+type HorizontalPodAutoscalerSettings struct {
+	Name        string                     `json:"name"`
+	MinReplicas *int32                     `json:"minReplicas,omitempty"`
+	MaxReplicas int32                      `json:"maxReplicas"`
+	Metrics     []autoscalingv2.MetricSpec `json:"metrics,omitempty"`
+}
+
+// PodDisruptionBudgetSettings are the settings of a disruption budget selecting the pods of the microservice
+type PodDisruptionBudgetSettings struct {
+	Name           string              `json:"name"`
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// ResourceQuotaSettings are the limits of a resource quota of the namespace of the microservice
+type ResourceQuotaSettings struct {
+	Name   string                    `json:"name"`
+	Hard   core.ResourceList         `json:"hard,omitempty"`
+	Scopes []core.ResourceQuotaScope `json:"scopes,omitempty"`
+}
+
+// LimitRangeSettings are the limits of a limit range of the namespace of the microservice
+type LimitRangeSettings struct {
+	Name   string                `json:"name"`
+	Limits []core.LimitRangeItem `json:"limits"`
+}
+
+// HorizontalPodAutoscalerWatch watch over horizontal pod autoscalers
+func (wh *WatchHandler) HorizontalPodAutoscalerWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER HorizontalPodAutoscalerWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	if _, found := wh.getServedGroupVersionResource(autoscalingv2.GroupName, []string{autoscalingv2.SchemeGroupVersion.Version}, "horizontalpodautoscalers"); !found {
+		glog.Warningf("%s is not served, the horizontal pod autoscalers are not reported, looking again in %s", autoscalingv2.SchemeGroupVersion, resourceDiscoveryInterval)
+		time.Sleep(resourceDiscoveryInterval)
+		return
+	}
+	glog.Infof("Watching over horizontal pod autoscalers starting")
+	hpaWatcher := wh.watchInformer(wh.informerFactory.Autoscaling().V2().HorizontalPodAutoscalers().Informer(), "horizontalpodautoscaler")
+	glog.Infof("Watching over horizontal pod autoscalers started")
+	wh.handleInformerEvents(hpaWatcher, "horizontalpodautoscaler", wh.hpaEventHandler)
+}
+
+// PodDisruptionBudgetWatch watch over pod disruption budgets
+func (wh *WatchHandler) PodDisruptionBudgetWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER PodDisruptionBudgetWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	if _, found := wh.getServedGroupVersionResource(policyv1.GroupName, []string{policyv1.SchemeGroupVersion.Version}, "poddisruptionbudgets"); !found {
+		glog.Warningf("%s is not served, the pod disruption budgets are not reported, looking again in %s", policyv1.SchemeGroupVersion, resourceDiscoveryInterval)
+		time.Sleep(resourceDiscoveryInterval)
+		return
+	}
+	glog.Infof("Watching over pod disruption budgets starting")
+	pdbWatcher := wh.watchInformer(wh.informerFactory.Policy().V1().PodDisruptionBudgets().Informer(), "poddisruptionbudget")
+	glog.Infof("Watching over pod disruption budgets started")
+	wh.handleInformerEvents(pdbWatcher, "poddisruptionbudget", wh.pdbEventHandler)
+}
+
+// ResourceQuotaWatch watch over resource quotas
+func (wh *WatchHandler) ResourceQuotaWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER ResourceQuotaWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over resource quotas starting")
+	resourceQuotaWatcher := wh.watchInformer(wh.informerFactory.Core().V1().ResourceQuotas().Informer(), "resourcequota")
+	glog.Infof("Watching over resource quotas started")
+	wh.handleInformerEvents(resourceQuotaWatcher, "resourcequota", wh.resourceQuotaEventHandler)
+}
+
+// LimitRangeWatch watch over limit ranges
+func (wh *WatchHandler) LimitRangeWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER LimitRangeWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over limit ranges starting")
+	limitRangeWatcher := wh.watchInformer(wh.informerFactory.Core().V1().LimitRanges().Informer(), "limitrange")
+	glog.Infof("Watching over limit ranges started")
+	wh.handleInformerEvents(limitRangeWatcher, "limitrange", wh.limitRangeEventHandler)
+}
+
+func (wh *WatchHandler) hpaEventHandler(event *watch.Event) error {
+	hpa, ok := event.Object.(*autoscalingv2.HorizontalPodAutoscaler)
+	if !ok {
+		return fmt.Errorf("got unexpected horizontal pod autoscaler from chan")
+	}
+	if wh.reportObjectEvent("horizontal pod autoscaler", event.Type, hpa, wh.hpadm, HORIZONTALPODAUTOSCALERS, isHPAChanged) {
+		wh.updateCapacityContexts(hpa.Namespace)
+	}
+	return nil
+}
+
+func (wh *WatchHandler) pdbEventHandler(event *watch.Event) error {
+	pdb, ok := event.Object.(*policyv1.PodDisruptionBudget)
+	if !ok {
+		return fmt.Errorf("got unexpected pod disruption budget from chan")
+	}
+	if wh.reportObjectEvent("pod disruption budget", event.Type, pdb, wh.pdbdm, PODDISRUPTIONBUDGETS, isPDBChanged) {
+		wh.updateCapacityContexts(pdb.Namespace)
+	}
+	return nil
+}
+
+func (wh *WatchHandler) resourceQuotaEventHandler(event *watch.Event) error {
+	resourceQuota, ok := event.Object.(*core.ResourceQuota)
+	if !ok {
+		return fmt.Errorf("got unexpected resource quota from chan")
+	}
+	if wh.reportObjectEvent("resource quota", event.Type, resourceQuota, wh.resourcequotadm, RESOURCEQUOTAS, isResourceQuotaChanged) {
+		wh.updateCapacityContexts(resourceQuota.Namespace)
+	}
+	return nil
+}
+
+func (wh *WatchHandler) limitRangeEventHandler(event *watch.Event) error {
+	limitRange, ok := event.Object.(*core.LimitRange)
+	if !ok {
+		return fmt.Errorf("got unexpected limit range from chan")
+	}
+	if wh.reportObjectEvent("limit range", event.Type, limitRange, wh.limitrangedm, LIMITRANGES, isLimitRangeChanged) {
+		wh.updateCapacityContexts(limitRange.Namespace)
+	}
+	return nil
+}
+
+// updateCapacityContexts updates the capacity context of the microservices of the namespace
+func (wh *WatchHandler) updateCapacityContexts(namespace string) {
+	wh.updateMicroServices(namespace, func(msd *MicroServiceData) bool {
+		capacity := wh.getCapacityContext(msd)
+		if reflect.DeepEqual(capacity, msd.Capacity) {
+			return false
+		}
+		msd.Capacity = capacity
+		return true
+	})
+}
+
+// getCapacityContext returns the settings applying to the microservice, from the informers cache: the autoscalers
+// targeting its owner, the disruption budgets selecting its pods, and the quotas and limit ranges of its namespace
+func (wh *WatchHandler) getCapacityContext(msd *MicroServiceData) *CapacityContext {
+	namespace := msd.Pod.Namespace
+	capacity := &CapacityContext{
+		HorizontalPodAutoscalers: []HorizontalPodAutoscalerSettings{},
+		PodDisruptionBudgets:     []PodDisruptionBudgetSettings{},
+		ResourceQuotas:           []ResourceQuotaSettings{},
+		LimitRanges:              []LimitRangeSettings{},
+	}
+	// the autoscalers and the disruption budgets are listed once watched, their API may not be served
+	var hpas []*autoscalingv2.HorizontalPodAutoscaler
+	var err error
+	if wh.informerWatchers.isWatched("horizontalpodautoscaler") {
+		hpas, err = wh.informerFactory.Autoscaling().V2().HorizontalPodAutoscalers().Lister().HorizontalPodAutoscalers(namespace).List(labels.Everything())
+		if err != nil {
+			glog.Errorf("failed to list horizontal pod autoscalers of namespace %s: %s", namespace, err.Error())
+		}
+	}
+	for _, hpa := range hpas {
+		if hpa.Spec.ScaleTargetRef.Kind == msd.Owner.Kind && hpa.Spec.ScaleTargetRef.Name == msd.Owner.Name {
+			capacity.HorizontalPodAutoscalers = append(capacity.HorizontalPodAutoscalers, HorizontalPodAutoscalerSettings{
+				Name: hpa.Name, MinReplicas: hpa.Spec.MinReplicas, MaxReplicas: hpa.Spec.MaxReplicas, Metrics: hpa.Spec.Metrics})
+		}
+	}
+	var pdbs []*policyv1.PodDisruptionBudget
+	if wh.informerWatchers.isWatched("poddisruptionbudget") {
+		pdbs, err = wh.informerFactory.Policy().V1().PodDisruptionBudgets().Lister().PodDisruptionBudgets(namespace).List(labels.Everything())
+		if err != nil {
+			glog.Errorf("failed to list pod disruption budgets of namespace %s: %s", namespace, err.Error())
+		}
+	}
+	for _, pdb := range pdbs {
+		// a budget without selector selects no pod
+		if pdb.Spec.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || !selector.Matches(labels.Set(msd.Pod.Labels)) {
+			continue
+		}
+		capacity.PodDisruptionBudgets = append(capacity.PodDisruptionBudgets, PodDisruptionBudgetSettings{
+			Name: pdb.Name, MinAvailable: pdb.Spec.MinAvailable, MaxUnavailable: pdb.Spec.MaxUnavailable})
+	}
+	resourceQuotas, err := wh.informerFactory.Core().V1().ResourceQuotas().Lister().ResourceQuotas(namespace).List(labels.Everything())
+	if err != nil {
+		glog.Errorf("failed to list resource quotas of namespace %s: %s", namespace, err.Error())
+	}
+	for _, resourceQuota := range resourceQuotas {
+		capacity.ResourceQuotas = append(capacity.ResourceQuotas, ResourceQuotaSettings{
+			Name: resourceQuota.Name, Hard: resourceQuota.Spec.Hard, Scopes: resourceQuota.Spec.Scopes})
+	}
+	limitRanges, err := wh.informerFactory.Core().V1().LimitRanges().Lister().LimitRanges(namespace).List(labels.Everything())
+	if err != nil {
+		glog.Errorf("failed to list limit ranges of namespace %s: %s", namespace, err.Error())
+	}
+	for _, limitRange := range limitRanges {
+		capacity.LimitRanges = append(capacity.LimitRanges, LimitRangeSettings{Name: limitRange.Name, Limits: limitRange.Spec.Limits})
+	}
+	// the listers return the objects in no particular order
+	sort.Slice(capacity.HorizontalPodAutoscalers, func(i, j int) bool {
+		return capacity.HorizontalPodAutoscalers[i].Name < capacity.HorizontalPodAutoscalers[j].Name
+	})
+	sort.Slice(capacity.PodDisruptionBudgets, func(i, j int) bool {
+		return capacity.PodDisruptionBudgets[i].Name < capacity.PodDisruptionBudgets[j].Name
+	})
+	sort.Slice(capacity.ResourceQuotas, func(i, j int) bool { return capacity.ResourceQuotas[i].Name < capacity.ResourceQuotas[j].Name })
+	sort.Slice(capacity.LimitRanges, func(i, j int) bool { return capacity.LimitRanges[i].Name < capacity.LimitRanges[j].Name })
+	return capacity
+}
+
+// isHPAChanged ignores the status, the current replicas and metrics change all the time
+func isHPAChanged(oldObj, newObj watchedObject) bool {
+	oldHPA, newHPA := oldObj.(*autoscalingv2.HorizontalPodAutoscaler), newObj.(*autoscalingv2.HorizontalPodAutoscaler)
+	return isObjectMetaChanged(&oldHPA.ObjectMeta, &newHPA.ObjectMeta) ||
+		!reflect.DeepEqual(oldHPA.Spec, newHPA.Spec)
+}
+
+func isPDBChanged(oldObj, newObj watchedObject) bool {
+	oldPDB, newPDB := oldObj.(*policyv1.PodDisruptionBudget), newObj.(*policyv1.PodDisruptionBudget)
+	return isObjectMetaChanged(&oldPDB.ObjectMeta, &newPDB.ObjectMeta) ||
+		!reflect.DeepEqual(oldPDB.Spec, newPDB.Spec)
+}
+
+func isResourceQuotaChanged(oldObj, newObj watchedObject) bool {
+	oldQuota, newQuota := oldObj.(*core.ResourceQuota), newObj.(*core.ResourceQuota)
+	return isObjectMetaChanged(&oldQuota.ObjectMeta, &newQuota.ObjectMeta) ||
+		!reflect.DeepEqual(oldQuota.Spec, newQuota.Spec)
+}
+
+func isLimitRangeChanged(oldObj, newObj watchedObject) bool {
+	oldLimitRange, newLimitRange := oldObj.(*core.LimitRange), newObj.(*core.LimitRange)
+	return isObjectMetaChanged(&oldLimitRange.ObjectMeta, &newLimitRange.ObjectMeta) ||
+		!reflect.DeepEqual(oldLimitRange.Spec, newLimitRange.Spec)
+}
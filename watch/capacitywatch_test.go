@@ -0,0 +1,117 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	core "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCapacityEventHandlers(t *testing.T) {
+	minReplicas := int32(2)
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", ResourceVersion: "1"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: "web", APIVersion: "apps/v1"},
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    5,
+		},
+	}
+	wh := newTestWatchHandler(hpa)
+	defer close(wh.stopChan)
+	pdbInformer := wh.informerFactory.Policy().V1().PodDisruptionBudgets().Informer()
+	resourceQuotaInformer := wh.informerFactory.Core().V1().ResourceQuotas().Informer()
+	wh.informerFactory.Autoscaling().V2().HorizontalPodAutoscalers().Informer()
+	wh.informerFactory.Core().V1().LimitRanges().Informer()
+	wh.informerFactory.Start(wh.stopChan)
+	wh.informerFactory.WaitForCacheSync(wh.stopChan)
+	wh.informerWatchers.kinds["horizontalpodautoscaler"] = true
+	wh.informerWatchers.kinds["poddisruptionbudget"] = true
+	newTestMicroService(wh, 1, "default", "web", map[string]string{"app": "web"})
+	newTestMicroService(wh, 2, "default", "worker", map[string]string{"app": "worker"})
+	for id, name := range map[int]string{1: "web", 2: "worker"} {
+		msd := wh.pdm[id].Front().Value.(MicroServiceData)
+		msd.Owner = OwnerDet{Name: name, Kind: "Deployment"}
+		wh.setMicroService(msd)
+	}
+
+	// the autoscaler targets the web deployment only
+	assert.NoError(t, wh.hpaEventHandler(&watch.Event{Type: watch.Added, Object: hpa.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.HorizontalPodAutoscalers.Created))
+	assert.Equal(t, 2, len(wh.jsonReport.MicroServices.Updated))
+	web := wh.pdm[1].Front().Value.(MicroServiceData)
+	assert.Equal(t, []HorizontalPodAutoscalerSettings{{Name: "web", MinReplicas: &minReplicas, MaxReplicas: 5}}, web.Capacity.HorizontalPodAutoscalers)
+	assert.Empty(t, wh.pdm[2].Front().Value.(MicroServiceData).Capacity.HorizontalPodAutoscalers)
+
+	// the status of the autoscaler is not reported
+	hpa.ResourceVersion = "2"
+	hpa.Status.CurrentReplicas = 3
+	assert.NoError(t, wh.hpaEventHandler(&watch.Event{Type: watch.Modified, Object: hpa.DeepCopy()}))
+	assert.Nil(t, wh.jsonReport.HorizontalPodAutoscalers.Updated)
+
+	maxUnavailable := intstr.FromInt(1)
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default", ResourceVersion: "3"},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "worker"}},
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+	assert.NoError(t, pdbInformer.GetStore().Add(pdb))
+	assert.NoError(t, wh.pdbEventHandler(&watch.Event{Type: watch.Added, Object: pdb.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.PodDisruptionBudgets.Created))
+	// only the selected microservice changed
+	assert.Equal(t, 3, len(wh.jsonReport.MicroServices.Updated))
+	worker := wh.jsonReport.MicroServices.Updated[2].(MicroServiceData)
+	assert.Equal(t, []PodDisruptionBudgetSettings{{Name: "worker", MaxUnavailable: &maxUnavailable}}, worker.Capacity.PodDisruptionBudgets)
+
+	resourceQuota := &core.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "default", ResourceVersion: "4"},
+		Spec:       core.ResourceQuotaSpec{Hard: core.ResourceList{core.ResourceLimitsCPU: resource.MustParse("8")}},
+	}
+	assert.NoError(t, resourceQuotaInformer.GetStore().Add(resourceQuota))
+	assert.NoError(t, wh.resourceQuotaEventHandler(&watch.Event{Type: watch.Added, Object: resourceQuota.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.ResourceQuotas.Created))
+	// the quotas of the namespace apply to all its microservices
+	assert.Equal(t, 5, len(wh.jsonReport.MicroServices.Updated))
+	for id := range wh.pdm {
+		quotas := wh.pdm[id].Front().Value.(MicroServiceData).Capacity.ResourceQuotas
+		assert.Equal(t, 1, len(quotas))
+		assert.Equal(t, "compute", quotas[0].Name)
+	}
+
+	assert.NoError(t, resourceQuotaInformer.GetStore().Delete(resourceQuota))
+	assert.NoError(t, wh.resourceQuotaEventHandler(&watch.Event{Type: watch.Deleted, Object: resourceQuota.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.ResourceQuotas.Deleted))
+	assert.Equal(t, 7, len(wh.jsonReport.MicroServices.Updated))
+	assert.Empty(t, wh.pdm[1].Front().Value.(MicroServiceData).Capacity.ResourceQuotas)
+}
+
+func TestCapacityWatchNotServed(t *testing.T) {
+	defer func(interval time.Duration) { resourceDiscoveryInterval = interval }(resourceDiscoveryInterval)
+	resourceDiscoveryInterval = time.Millisecond
+	wh := newTestWatchHandler()
+	defer close(wh.stopChan)
+	// a cluster serving autoscaling/v1 and policy/v1beta1 only
+	wh.RestAPIClient.(*fake.Clientset).Resources = []*metav1.APIResourceList{
+		{GroupVersion: "autoscaling/v1", APIResources: []metav1.APIResource{{Name: "horizontalpodautoscalers"}}},
+		{GroupVersion: "policy/v1beta1", APIResources: []metav1.APIResource{{Name: "poddisruptionbudgets"}}},
+	}
+	wh.HorizontalPodAutoscalerWatch()
+	wh.PodDisruptionBudgetWatch()
+	assert.Equal(t, 0, len(wh.informerWatchers.watchers), "no informer is started for the API not served")
+
+	// the capacity of the microservices doesn't need them
+	newTestMicroService(wh, 1, "default", "web", map[string]string{"app": "web"})
+	capacity := wh.getCapacityContext(&MicroServiceData{Pod: wh.pdm[1].Front().Value.(MicroServiceData).Pod})
+	assert.Empty(t, capacity.HorizontalPodAutoscalers)
+	assert.Empty(t, capacity.PodDisruptionBudgets)
+}
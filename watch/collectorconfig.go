@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/armosec/utils-go/str"
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// collectorConfig holds the settings of the kollector. They are read from the cluster config file,
+// next to the fields of armometadata.ClusterConfig
+type collectorConfig struct {
+	// ReportSinks are the destinations of the reports, the event receiver websocket when empty
+	ReportSinks []sinkConfig `json:"reportSinks,omitempty"`
+	// ReportSpool keeps the reports until the event receiver websocket delivers them
+	ReportSpool spoolConfig `json:"reportSpool,omitempty"`
+	// ReportAcks keeps the reports in the spool until the event receiver acks them
+	ReportAcks bool `json:"reportAcks,omitempty"`
+	// MaxReportSizeKB splits the bigger reports into chunks, the reports are never split when zero
+	MaxReportSizeKB int `json:"maxReportSizeKB,omitempty"`
+	// ReportEncoding is the encoding of the reports on the event receiver websocket
+	ReportEncoding reportEncoding `json:"reportEncoding,omitempty"`
+	// ConfigMapValues are the config maps whose values are reported, only the digests of the values are reported otherwise
+	ConfigMapValues []objectSelector `json:"configMapValues,omitempty"`
+	// Resources are more resources to watch, custom resources included. They are reported by group/version/resource
+	Resources []resourceConfig `json:"resources,omitempty"`
+	// Events filters and rate limits the reported Kubernetes events
+	Events eventsConfig `json:"events,omitempty"`
+}
+
+// eventsConfig selects the reported Kubernetes events. An empty list matches all
+type eventsConfig struct {
+	// Types are the reported event types, Normal and Warning
+	Types []string `json:"types,omitempty"`
+	// Reasons are the reported event reasons
+	Reasons []string `json:"reasons,omitempty"`
+	// ExcludeReasons are the event reasons never reported
+	ExcludeReasons []string `json:"excludeReasons,omitempty"`
+	// MaxPerSecond is the rate of reported events, defaultEventsPerSecond when zero
+	MaxPerSecond float32 `json:"maxPerSecond,omitempty"`
+	// Burst is the number of events reported at once above the rate, defaultEventsBurst when zero
+	Burst int `json:"burst,omitempty"`
+}
+
+func (config *eventsConfig) matches(eventType, reason string) bool {
+	return (len(config.Types) == 0 || str.StringInSlice(config.Types, eventType)) &&
+		(len(config.Reasons) == 0 || str.StringInSlice(config.Reasons, reason)) &&
+		!str.StringInSlice(config.ExcludeReasons, reason)
+}
+
+// resourceConfig is a resource to watch with the dynamic client
+type resourceConfig struct {
+	Group    string `json:"group,omitempty"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+}
+
+// groupVersionResources returns the resources to watch, each once
+func (config *collectorConfig) groupVersionResources() ([]schema.GroupVersionResource, error) {
+	resources := make([]schema.GroupVersionResource, 0, len(config.Resources))
+	seen := map[schema.GroupVersionResource]bool{}
+	for i := range config.Resources {
+		gvr, err := config.Resources[i].groupVersionResource()
+		if err != nil {
+			return nil, err
+		}
+		if !seen[gvr] {
+			seen[gvr] = true
+			resources = append(resources, gvr)
+		}
+	}
+	return resources, nil
+}
+
+func (config *resourceConfig) groupVersionResource() (schema.GroupVersionResource, error) {
+	if config.Version == "" || config.Resource == "" {
+		return schema.GroupVersionResource{}, fmt.Errorf("resource '%s' of group '%s' is missing the version or the resource name", config.Resource, config.Group)
+	}
+	return schema.GroupVersionResource{Group: config.Group, Version: config.Version, Resource: config.Resource}, nil
+}
+
+// objectSelector selects objects by namespace and name, an empty field matches all
+type objectSelector struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+func (selector *objectSelector) matches(namespace, name string) bool {
+	return (selector.Namespace == "" || selector.Namespace == namespace) && (selector.Name == "" || selector.Name == name)
+}
+
+func loadCollectorConfig(configPath string) (*collectorConfig, error) {
+	if configPath == "" {
+		configPath = armometadata.DefaultConfigPath
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file, path: %s, reason: %s", configPath, err.Error())
+	}
+	config := &collectorConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to read collector config, path: %s, reason: %s", configPath, err.Error())
+	}
+	return config, nil
+}
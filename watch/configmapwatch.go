@@ -0,0 +1,120 @@
+package watch
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// lastAppliedConfigAnnotation holds the whole object as applied by kubectl, values included
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// configMapData is the reported config map. The values are replaced by their digests, unless the config map is
+// selected by the configMapValues of the config
+type configMapData struct {
+	*corev1.ConfigMap `json:",inline"`
+	// Keys are the keys of data and binaryData
+	Keys []string `json:"keys"`
+	// Digests are the hex SHA-1 of the values, by key
+	Digests map[string]string `json:"digests"`
+}
+
+// ConfigMapWatch watch over config maps
+func (wh *WatchHandler) ConfigMapWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER ConfigMapWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over config maps starting")
+	configMapWatcher := wh.watchInformer(wh.informerFactory.Core().V1().ConfigMaps().Informer(), "configmap")
+	glog.Infof("Watching over config maps started")
+	wh.handleInformerEvents(configMapWatcher, "configmap", wh.configMapEventHandler)
+}
+
+func (wh *WatchHandler) configMapEventHandler(event *watch.Event) error {
+	configMap, ok := event.Object.(*corev1.ConfigMap)
+	if !ok {
+		return fmt.Errorf("got unexpected config map from chan")
+	}
+	if !wh.isNamespaceWatched(configMap.Namespace) {
+		return nil
+	}
+	configMap.ManagedFields = []metav1.ManagedFieldsEntry{}
+	data := wh.newConfigMapData(configMap)
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		id, stored, found := wh.configmapdm.lookup("config map", configMap.Namespace, configMap.Name)
+		if !found {
+			id = CreateID("config map", configMap.Namespace, configMap.Name)
+			wh.configmapdm.init(id)
+			wh.configmapdm.pushBack(id, data)
+			wh.jsonReport.AddToJsonFormat(data, CONFIGMAPS, CREATED)
+		} else if isConfigMapChanged(stored.(configMapData), data) {
+			wh.configmapdm.updateFront(id, data)
+			glog.Infof("config map %s updated", configMap.Name)
+			wh.jsonReport.AddToJsonFormat(data, CONFIGMAPS, UPDATED)
+		} else {
+			return nil
+		}
+		informNewDataArrive(wh)
+	case watch.Deleted:
+		if id, _, found := wh.configmapdm.lookup("config map", configMap.Namespace, configMap.Name); found {
+			wh.configmapdm.remove(id)
+			DeleteID(id)
+			glog.Infof("config map %s removed", configMap.Name)
+			wh.jsonReport.AddToJsonFormat(data, CONFIGMAPS, DELETED)
+			informNewDataArrive(wh)
+		}
+	}
+	return nil
+}
+
+// newConfigMapData returns the config map to report, with the digests of its values
+func (wh *WatchHandler) newConfigMapData(configMap *corev1.ConfigMap) configMapData {
+	data := configMapData{ConfigMap: configMap, Keys: []string{}, Digests: map[string]string{}}
+	for key, value := range configMap.Data {
+		data.Keys = append(data.Keys, key)
+		data.Digests[key] = hex.EncodeToString(HashByteArray([]byte(value)))
+	}
+	for key, value := range configMap.BinaryData {
+		data.Keys = append(data.Keys, key)
+		data.Digests[key] = hex.EncodeToString(HashByteArray(value))
+	}
+	sort.Strings(data.Keys)
+	if !wh.isConfigMapValueReported(configMap) {
+		removeConfigMapData(configMap)
+	}
+	return data
+}
+
+func (wh *WatchHandler) isConfigMapValueReported(configMap *corev1.ConfigMap) bool {
+	for i := range wh.configMapValues {
+		if wh.configMapValues[i].matches(configMap.Namespace, configMap.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeConfigMapData(configMap *corev1.ConfigMap) {
+	configMap.Data = nil
+	configMap.BinaryData = nil
+	if configMap.Annotations != nil {
+		delete(configMap.Annotations, lastAppliedConfigAnnotation)
+	}
+}
+
+// isConfigMapChanged compares the config maps by the digests of their values
+func isConfigMapChanged(oldData, newData configMapData) bool {
+	return isObjectMetaChanged(&oldData.ObjectMeta, &newData.ObjectMeta) ||
+		!reflect.DeepEqual(oldData.Immutable, newData.Immutable) ||
+		!reflect.DeepEqual(oldData.Digests, newData.Digests)
+}
@@ -0,0 +1,67 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestConfigMapEventHandler(t *testing.T) {
+	wh := newTestWatchHandler()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "settings",
+			Namespace:   "default",
+			Annotations: map[string]string{lastAppliedConfigAnnotation: `{"data":{"level":"debug"}}`},
+		},
+		Data:       map[string]string{"level": "debug"},
+		BinaryData: map[string][]byte{"cert": []byte("1234")},
+	}
+	assert.NoError(t, wh.configMapEventHandler(&watch.Event{Type: watch.Added, Object: configMap.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.ConfigMaps.Created))
+	data := wh.jsonReport.ConfigMaps.Created[0].(configMapData)
+	assert.Nil(t, data.Data)
+	assert.Nil(t, data.BinaryData)
+	assert.Empty(t, data.Annotations)
+	assert.Equal(t, []string{"cert", "level"}, data.Keys)
+	assert.Equal(t, map[string]string{
+		"level": "32faaecac742100f7753f0c1d0aa0add01b4046b",
+		"cert":  "7110eda4d09e062aa5e4a390b0a572ac0d2c0220",
+	}, data.Digests)
+
+	// the same values are not an update
+	assert.NoError(t, wh.configMapEventHandler(&watch.Event{Type: watch.Modified, Object: configMap.DeepCopy()}))
+	assert.Nil(t, wh.jsonReport.ConfigMaps.Updated)
+
+	changed := configMap.DeepCopy()
+	changed.Data["level"] = "info"
+	assert.NoError(t, wh.configMapEventHandler(&watch.Event{Type: watch.Modified, Object: changed}))
+	assert.Equal(t, 1, len(wh.jsonReport.ConfigMaps.Updated))
+	assert.NotEqual(t, data.Digests["level"], wh.jsonReport.ConfigMaps.Updated[0].(configMapData).Digests["level"])
+
+	assert.NoError(t, wh.configMapEventHandler(&watch.Event{Type: watch.Deleted, Object: changed.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.ConfigMaps.Deleted))
+	assert.Equal(t, 0, wh.configmapdm.len())
+}
+
+func TestConfigMapValues(t *testing.T) {
+	wh := newTestWatchHandler()
+	wh.configMapValues = []objectSelector{{Namespace: "monitoring"}, {Namespace: "default", Name: "feature-flags"}}
+	for _, test := range []struct {
+		namespace, name string
+		reported        bool
+	}{
+		{"monitoring", "settings", true},
+		{"default", "feature-flags", true},
+		{"default", "settings", false},
+		{"other", "feature-flags", false},
+	} {
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: test.name, Namespace: test.namespace}, Data: map[string]string{"a": "b"}}
+		data := wh.newConfigMapData(configMap)
+		assert.Equal(t, test.reported, data.Data != nil, "%s/%s", test.namespace, test.name)
+		assert.Equal(t, 1, len(data.Digests))
+	}
+}
@@ -1,9 +1,9 @@
 package watch
 
 import (
-	"container/list"
+	"fmt"
+	"reflect"
 	"runtime/debug"
-	"time"
 
 	"github.com/golang/glog"
 	batchv1 "k8s.io/api/batch/v1"
@@ -12,108 +12,104 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 )
 
-// CronJobWatch watch over services
+// CronJobWatch watch over cronjobs
 func (wh *WatchHandler) CronJobWatch() {
 	defer func() {
 		if err := recover(); err != nil {
 			glog.Errorf("RECOVER CronJobWatch. error: %v, stack: %s", err, debug.Stack())
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-	for {
-		glog.Info("Watching over cronjobs starting")
-		cronjobWatcher, err := wh.RestAPIClient.BatchV1().CronJobs("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			glog.Errorf("Cannot watch over cronjobs. %v", err)
-			time.Sleep(3 * time.Second)
-			continue
-		}
-		wh.handleCronJobWatch(cronjobWatcher, newStateChan, &lastWatchEventCreationTime)
-
-		glog.Infof("Watching over cronjobs ended - since we got timeout")
-	}
+	glog.Info("Watching over cronjobs starting")
+	cronjobWatcher := wh.watchInformer(wh.informerFactory.Batch().V1().CronJobs().Informer(), "cronjob")
+	glog.Infof("Watching over cronjobs started")
+	wh.handleInformerEvents(cronjobWatcher, "cronjob", wh.cronJobEventHandler)
 }
 
-func (wh *WatchHandler) handleCronJobWatch(cronjobWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
-	cronjobChan := cronjobWatcher.ResultChan()
-	cronJobIDs := make(map[string]int)
-	glog.Infof("Watching over cronjobs started")
-	for {
-		var event watch.Event
-		select {
-		case event = <-cronjobChan:
-		case <-newStateChan:
-			cronjobWatcher.Stop()
-			glog.Errorf("CronJob watch - newStateChan signal")
-			*lastWatchEventCreationTime = time.Now()
-			return
+func (wh *WatchHandler) cronJobEventHandler(event *watch.Event) error {
+	cronjob, ok := event.Object.(*batchv1.CronJob)
+	if !ok {
+		return fmt.Errorf("got unexpected cronjob from chan")
+	}
+	if !wh.isNamespaceWatched(cronjob.Namespace) {
+		return nil
+	}
+	cronjob.Kind = "CronJob"
+	if cronjob.APIVersion == "" {
+		cronjob.APIVersion = "batch/v1"
+	}
+	// handle cases like microservice
+	cronjob.ManagedFields = []metav1.ManagedFieldsEntry{}
+	wh.pdmMutex.Lock()
+	defer wh.pdmMutex.Unlock()
+	key := podKey(cronjob.Namespace, cronjob.Name)
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		nms := newCronJobMicroService(cronjob)
+		if oldID, ok := wh.cronJobIDs[key]; ok && oldID != nms.PodSpecId {
+			// the job template changed, the pods of the new template are another microservice
+			wh.removeCronJobMicroService(cronjob, oldID)
+		}
+		wh.cronJobIDs[key] = nms.PodSpecId
+		msdList := wh.pdm[nms.PodSpecId]
+		if msdList == nil {
+			wh.setMicroServiceDerivedData(&nms)
+			wh.addMicroService(nms)
+			wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, CREATED)
+			informNewDataArrive(wh)
+			return nil
 		}
-		if event.Type == watch.Error {
-			glog.Errorf("CronJob watch chan loop error: %v", event.Object)
-			*lastWatchEventCreationTime = time.Now()
-			return
+		stored := msdList.Front().Value.(MicroServiceData)
+		// the status changes on every run, only the spec and the metadata are reported
+		if storedCronJob, ok := stored.Owner.OwnerData.(*batchv1.CronJob); ok && !isCronJobChanged(storedCronJob, cronjob) {
+			return nil
 		}
-		if cronjob, ok := event.Object.(*batchv1.CronJob); ok {
-			if !wh.isNamespaceWatched(cronjob.Namespace) {
-				continue
-			}
-			cronjob.Kind = "CronJob"
-			if cronjob.APIVersion == "" {
-				cronjob.APIVersion = "batch/v1"
-			}
-			// handle cases like microservice
-			cronjob.ManagedFields = []metav1.ManagedFieldsEntry{}
-			switch event.Type {
-			case watch.Added:
-				if cronjob.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
-					glog.Infof("cronjob %s already exist, will not be reported", cronjob.Name)
-					continue
-				}
-				id := CreateID()
-				od := OwnerDet{
-					Name:      cronjob.Name,
-					Kind:      cronjob.Kind,
-					OwnerData: cronjob,
-				}
-				wh.pdm[id] = list.New()
-				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
-					Owner: od, PodSpecId: id}
-				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, CREATED)
-				cronJobIDs[string(cronjob.GetUID())] = id
-				informNewDataArrive(wh)
-			case watch.Modified:
-				od := OwnerDet{
-					Name:      cronjob.Name,
-					Kind:      cronjob.Kind,
-					OwnerData: cronjob,
-				}
-				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
-					Owner: od, PodSpecId: cronJobIDs[string(cronjob.GetUID())]}
-				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, UPDATED)
-				informNewDataArrive(wh)
-			case watch.Deleted:
-				delete(cronJobIDs, string(cronjob.GetUID()))
-				od := OwnerDet{
-					Name:      cronjob.Name,
-					Kind:      cronjob.Kind,
-					OwnerData: cronjob,
-				}
-				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
-					Owner: od, PodSpecId: cronJobIDs[string(cronjob.GetUID())]}
-				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, DELETED)
-				informNewDataArrive(wh)
-			case watch.Bookmark: //only the resource version is changed but it's the same workload
-				continue
-			case watch.Error:
-				glog.Errorf("while watching over cronjobs we got an error: %v", event)
-				*lastWatchEventCreationTime = time.Now()
-				return
-			}
+		if msdList.Len() > 1 {
+			// the microservice is reported with the spec of its first pod
+			stored.Owner.OwnerData = cronjob
+			nms = stored
 		} else {
-			*lastWatchEventCreationTime = time.Now()
-			return
+			wh.setMicroServiceDerivedData(&nms)
+		}
+		wh.setMicroService(nms)
+		wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, UPDATED)
+		informNewDataArrive(wh)
+	case watch.Deleted:
+		if id, ok := wh.cronJobIDs[key]; ok {
+			delete(wh.cronJobIDs, key)
+			wh.removeCronJobMicroService(cronjob, id)
 		}
 	}
+	return nil
+}
+
+// removeCronJobMicroService removes the microservice of the cronjob, unless it has pods, it's then removed with its
+// last pod
+func (wh *WatchHandler) removeCronJobMicroService(cronjob *batchv1.CronJob, id int) {
+	msdList := wh.pdm[id]
+	if msdList == nil || msdList.Len() > 1 {
+		return
+	}
+	nms := msdList.Front().Value.(MicroServiceData)
+	wh.removeMicroService(id)
+	glog.Infof("remove %s.%s", cronjob.Kind, cronjob.Name)
+	wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, DELETED)
+	informNewDataArrive(wh)
+}
+
+// newCronJobMicroService returns the microservice of the cronjob, with the ID of the microservice of its pods. Its pod has the spec and the labels of the pods of
+// the job template, the ones the network policies and the disruption budgets select, and the rest of the metadata of
+// the cronjob
+func newCronJobMicroService(cronjob *batchv1.CronJob) MicroServiceData {
+	objectMeta := *cronjob.ObjectMeta.DeepCopy()
+	objectMeta.Labels = cronjob.Spec.JobTemplate.Spec.Template.Labels
+	nms := MicroServiceData{
+		Pod:   &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: objectMeta},
+		Owner: OwnerDet{Name: cronjob.Name, Kind: cronjob.Kind, OwnerData: cronjob},
+	}
+	nms.PodSpecId = microServiceID(cronjob.Namespace, &nms.Owner, objectMeta.Labels)
+	return nms
+}
+
+func isCronJobChanged(oldCronJob, newCronJob *batchv1.CronJob) bool {
+	return isObjectMetaChanged(&oldCronJob.ObjectMeta, &newCronJob.ObjectMeta) || !reflect.DeepEqual(oldCronJob.Spec, newCronJob.Spec)
 }
@@ -0,0 +1,84 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func newTestCronJob(image string) *batchv1.CronJob {
+	cronJob := &batchv1.CronJob{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+		ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "default", UID: types.UID("CronJob-report"), ResourceVersion: "1"},
+		Spec:       batchv1.CronJobSpec{Schedule: "0 * * * *"},
+	}
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers = []core.Container{{Name: "report", Image: image}}
+	return cronJob
+}
+
+func TestCronJobMicroServiceID(t *testing.T) {
+	cronJob := newTestCronJob("report:1")
+	job := &batchv1.Job{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{Name: "report-1", Namespace: "default", UID: types.UID("Job-report-1"), OwnerReferences: []metav1.OwnerReference{newTestOwnerReference("batch/v1", "CronJob", "report", true)}},
+	}
+	wh := newTestWatchHandler(cronJob, job)
+	defer close(wh.stopChan)
+	wh.informerFactory.Batch().V1().CronJobs().Informer()
+	wh.informerFactory.Start(wh.stopChan)
+	wh.informerFactory.WaitForCacheSync(wh.stopChan)
+
+	assert.NoError(t, wh.cronJobEventHandler(&watch.Event{Type: watch.Added, Object: cronJob.DeepCopy()}))
+	id := wh.jsonReport.MicroServices.Created[0].(MicroServiceData).PodSpecId
+
+	// the pods of the jobs of the cronjob are the microservice of the cronjob
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            "report-1-abcde",
+		Namespace:       "default",
+		Labels:          map[string]string{"job-name": "report-1"},
+		OwnerReferences: []metav1.OwnerReference{newTestOwnerReference("batch/v1", "Job", "report-1", true)},
+	}}
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Added, Object: pod.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Created))
+	assert.Equal(t, 2, wh.pdm[id].Len())
+
+	// a cronjob deleted with running pods is removed with its last pod
+	assert.NoError(t, wh.cronJobEventHandler(&watch.Event{Type: watch.Deleted, Object: cronJob.DeepCopy()}))
+	assert.Equal(t, 0, len(wh.jsonReport.MicroServices.Deleted))
+	assert.NotNil(t, wh.pdm[id])
+}
+
+func TestCronJobTemplateChange(t *testing.T) {
+	wh := newTestWatchHandler()
+	cronJob := newTestCronJob("report:1")
+	assert.NoError(t, wh.cronJobEventHandler(&watch.Event{Type: watch.Added, Object: cronJob.DeepCopy()}))
+	id := wh.jsonReport.MicroServices.Created[0].(MicroServiceData).PodSpecId
+
+	// the schedule isn't part of the identity
+	cronJob.ResourceVersion = "2"
+	cronJob.Spec.Schedule = "30 * * * *"
+	assert.NoError(t, wh.cronJobEventHandler(&watch.Event{Type: watch.Modified, Object: cronJob.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Updated))
+	assert.Equal(t, id, wh.jsonReport.MicroServices.Updated[0].(MicroServiceData).PodSpecId)
+	assert.NotNil(t, wh.jsonReport.MicroServices.Updated[0].(MicroServiceData).Posture)
+
+	// the pods of a new template are another microservice
+	cronJob.ResourceVersion = "3"
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image = "report:2"
+	assert.NoError(t, wh.cronJobEventHandler(&watch.Event{Type: watch.Modified, Object: cronJob.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Deleted))
+	assert.Equal(t, id, wh.jsonReport.MicroServices.Deleted[0].(MicroServiceData).PodSpecId)
+	assert.Equal(t, 2, len(wh.jsonReport.MicroServices.Created))
+	newID := wh.jsonReport.MicroServices.Created[1].(MicroServiceData).PodSpecId
+	assert.NotEqual(t, id, newID)
+	assert.Nil(t, wh.pdm[id])
+
+	assert.NoError(t, wh.cronJobEventHandler(&watch.Event{Type: watch.Deleted, Object: cronJob.DeepCopy()}))
+	assert.Equal(t, 2, len(wh.jsonReport.MicroServices.Deleted))
+	assert.Nil(t, wh.pdm[newID])
+}
@@ -7,3 +7,8 @@ const (
 	configEnvironmentVariable                        = "CONFIG"
 	namespaceEnvironmentVariable                     = "NAMESPACE"
 )
+
+const (
+	// reportDeltasEnvironmentVariable reports updates as patches against the previously reported version
+	reportDeltasEnvironmentVariable = "REPORT_DELTAS"
+)
@@ -0,0 +1,196 @@
+package watch
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	defaultEventsPerSecond = 10
+	defaultEventsBurst     = 100
+)
+
+// eventData is the reported event, with the PodSpecId of the microservice of the object it's about
+type eventData struct {
+	*eventsv1.Event `json:",inline"`
+	// PodSpecId is nil when the object is not a microservice, a pod of one or its owner
+	PodSpecId *int `json:"podSpecId,omitempty"`
+}
+
+// reportedEvents keeps the resourceVersion of the events reported, so an event is reported again only when it
+// recurs. The events are not kept as the other objects are, there are many of them and they are never updated but
+// for their series
+type reportedEvents struct {
+	versions map[types.UID]string
+	mutex    sync.Mutex
+}
+
+func newReportedEvents() *reportedEvents {
+	return &reportedEvents{versions: make(map[types.UID]string)}
+}
+
+// stateOf returns how to report the event: CREATED the first time, UPDATED when it recurs. Returns false when
+// this version of the event was reported already
+func (re *reportedEvents) stateOf(event *eventsv1.Event) (StateType, bool) {
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+	version, found := re.versions[event.UID]
+	if !found {
+		return CREATED, true
+	}
+	return UPDATED, version != event.ResourceVersion
+}
+
+func (re *reportedEvents) add(event *eventsv1.Event) {
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+	re.versions[event.UID] = event.ResourceVersion
+}
+
+func (re *reportedEvents) remove(event *eventsv1.Event) {
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+	delete(re.versions, event.UID)
+}
+
+// reset forgets the reported events, so they are reported again as created
+func (re *reportedEvents) reset() {
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+	re.versions = make(map[types.UID]string)
+}
+
+// newEventRateLimiter returns the rate limiter of the reported events
+func newEventRateLimiter(config *eventsConfig) flowcontrol.RateLimiter {
+	perSecond, burst := config.MaxPerSecond, config.Burst
+	if perSecond <= 0 {
+		perSecond = defaultEventsPerSecond
+	}
+	if burst <= 0 {
+		burst = defaultEventsBurst
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(perSecond, burst)
+}
+
+// EventWatch watch over the Kubernetes events, with the events.k8s.io API when it's served and the core API otherwise
+func (wh *WatchHandler) EventWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER EventWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over events starting")
+	var eventWatcher *informerWatcher
+	if _, found := wh.getServedGroupVersionResource(eventsv1.GroupName, []string{eventsv1.SchemeGroupVersion.Version}, "events"); found {
+		eventWatcher = wh.watchInformer(wh.informerFactory.Events().V1().Events().Informer(), "event")
+	} else {
+		glog.Infof("%s is not served, watching over the core events", eventsv1.SchemeGroupVersion)
+		eventWatcher = wh.watchInformer(wh.informerFactory.Core().V1().Events().Informer(), "event")
+	}
+	glog.Infof("Watching over events started")
+	wh.handleInformerEvents(eventWatcher, "event", wh.eventHandler)
+}
+
+func (wh *WatchHandler) eventHandler(event *watch.Event) error {
+	var kubeEvent *eventsv1.Event
+	switch obj := event.Object.(type) {
+	case *eventsv1.Event:
+		kubeEvent = obj
+	case *core.Event:
+		kubeEvent = convertCoreEvent(obj)
+	default:
+		return fmt.Errorf("got unexpected event from chan")
+	}
+	if !wh.isNamespaceWatched(kubeEvent.Namespace) {
+		return nil
+	}
+	// the events expire, their deletion is not reported
+	if event.Type == watch.Deleted {
+		wh.reportedEvents.remove(kubeEvent)
+		return nil
+	}
+	if !wh.eventsConfig.matches(kubeEvent.Type, kubeEvent.Reason) {
+		return nil
+	}
+	stype, ok := wh.reportedEvents.stateOf(kubeEvent)
+	if !ok {
+		return nil
+	}
+	if !wh.eventRateLimiter.TryAccept() {
+		glog.Infof("events rate limit reached, event %s %s of %s %s is not reported", kubeEvent.Type, kubeEvent.Reason, kubeEvent.Regarding.Kind, kubeEvent.Regarding.Name)
+		return nil
+	}
+	wh.reportedEvents.add(kubeEvent)
+	kubeEvent.ManagedFields = nil
+	data := eventData{Event: kubeEvent}
+	if podSpecID, found := wh.getMicroServiceID(&kubeEvent.Regarding); found {
+		data.PodSpecId = &podSpecID
+	}
+	wh.jsonReport.AddToJsonFormat(data, EVENTS, stype)
+	informNewDataArrive(wh)
+	return nil
+}
+
+// getMicroServiceID returns the PodSpecId of the microservice of the object: the microservice of the pod, or the
+// microservice the object is an owner of, like a replica set or a job of a cronjob. An object that isn't the owner of
+// a microservice, like a job of a cronjob other than the one of its first pod, is linked through its own owners
+func (wh *WatchHandler) getMicroServiceID(object *core.ObjectReference) (int, bool) {
+	if id, found := wh.getIndexedMicroServiceID(object.Namespace, object.Kind, object.Name); found || object.Kind == "Pod" {
+		return id, found
+	}
+	// the chain is resolved without pdmMutex, the owners may be fetched from the API server
+	chain, ok := wh.owners.resolveObject(object)
+	if !ok {
+		return 0, false
+	}
+	for _, owner := range chain[1:] {
+		if id, found := wh.getIndexedMicroServiceID(object.Namespace, owner.Kind, owner.Name); found {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// getIndexedMicroServiceID returns the PodSpecId of the microservice of the pod, or of the microservice the object is
+// an owner of
+func (wh *WatchHandler) getIndexedMicroServiceID(namespace, kind, name string) (int, bool) {
+	wh.pdmMutex.RLock()
+	defer wh.pdmMutex.RUnlock()
+	if kind == "Pod" {
+		entry, ok := wh.pods[podKey(namespace, name)]
+		return entry.id, ok
+	}
+	return wh.getOwnedMicroServiceID(namespace, kind, name)
+}
+
+// convertCoreEvent returns the core event as an events.k8s.io event, the way the API server serves it
+func convertCoreEvent(event *core.Event) *eventsv1.Event {
+	converted := &eventsv1.Event{
+		ObjectMeta:               event.ObjectMeta,
+		EventTime:                event.EventTime,
+		ReportingController:      event.ReportingController,
+		ReportingInstance:        event.ReportingInstance,
+		Action:                   event.Action,
+		Reason:                   event.Reason,
+		Regarding:                event.InvolvedObject,
+		Related:                  event.Related,
+		Note:                     event.Message,
+		Type:                     event.Type,
+		DeprecatedSource:         event.Source,
+		DeprecatedFirstTimestamp: event.FirstTimestamp,
+		DeprecatedLastTimestamp:  event.LastTimestamp,
+		DeprecatedCount:          event.Count,
+	}
+	if event.Series != nil {
+		converted.Series = &eventsv1.EventSeries{Count: event.Series.Count, LastObservedTime: event.Series.LastObservedTime}
+	}
+	return converted
+}
@@ -0,0 +1,166 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestEventsConfigMatches(t *testing.T) {
+	config := eventsConfig{}
+	assert.True(t, config.matches(core.EventTypeNormal, "Scheduled"))
+
+	config = eventsConfig{Types: []string{core.EventTypeWarning}, ExcludeReasons: []string{"FailedMount"}}
+	assert.False(t, config.matches(core.EventTypeNormal, "Scheduled"))
+	assert.True(t, config.matches(core.EventTypeWarning, "BackOff"))
+	assert.False(t, config.matches(core.EventTypeWarning, "FailedMount"))
+
+	config = eventsConfig{Reasons: []string{"OOMKilling"}}
+	assert.True(t, config.matches(core.EventTypeWarning, "OOMKilling"))
+	assert.False(t, config.matches(core.EventTypeWarning, "BackOff"))
+}
+
+func TestConvertCoreEvent(t *testing.T) {
+	event := &core.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "web.1", Namespace: "default", UID: "1"},
+		InvolvedObject: core.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-1"},
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		Type:           core.EventTypeWarning,
+		Count:          3,
+	}
+	converted := convertCoreEvent(event)
+	assert.Equal(t, event.ObjectMeta, converted.ObjectMeta)
+	assert.Equal(t, event.InvolvedObject, converted.Regarding)
+	assert.Equal(t, "Back-off restarting failed container", converted.Note)
+	assert.Equal(t, int32(3), converted.DeprecatedCount)
+	assert.Nil(t, converted.Series)
+}
+
+func TestEventHandler(t *testing.T) {
+	wh := newTestWatchHandler()
+	wh.eventsConfig = eventsConfig{Types: []string{core.EventTypeWarning}}
+	newTestMicroService(wh, 1, "default", "web-1", nil)
+	wh.addPodData(1, PodDataForExistMicroService{PodName: "web-2", Namespace: "default"})
+	msd := wh.pdm[1].Front().Value.(MicroServiceData)
+	msd.Owner = OwnerDet{Name: "web", Kind: "Deployment"}
+	wh.setMicroService(msd)
+
+	backOff := &eventsv1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-2.1", Namespace: "default", UID: "1", ResourceVersion: "1"},
+		Regarding:  core.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-2"},
+		Reason:     "BackOff",
+		Type:       core.EventTypeWarning,
+	}
+	assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Added, Object: backOff.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Events.Created))
+	data := wh.jsonReport.Events.Created[0].(eventData)
+	assert.Equal(t, 1, *data.PodSpecId)
+
+	// the same version is not reported twice, a recurrence is reported as an update
+	assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Added, Object: backOff.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Events.Created))
+	backOff.ResourceVersion = "2"
+	assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Modified, Object: backOff.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Events.Updated))
+
+	// the events of the owner are linked to the microservice, the core events are reported as events.k8s.io events
+	scaled := &core.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "web.1", Namespace: "default", UID: "2", ResourceVersion: "3"},
+		InvolvedObject: core.ObjectReference{Kind: "Deployment", Namespace: "default", Name: "web"},
+		Reason:         "FailedCreate",
+		Type:           core.EventTypeWarning,
+	}
+	assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Added, Object: scaled}))
+	assert.Equal(t, 2, len(wh.jsonReport.Events.Created))
+	data = wh.jsonReport.Events.Created[1].(eventData)
+	assert.Equal(t, 1, *data.PodSpecId)
+	assert.Equal(t, "FailedCreate", data.Reason)
+
+	// filtered out
+	normal := &eventsv1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-2.2", Namespace: "default", UID: "3", ResourceVersion: "4"},
+		Regarding:  core.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-2"},
+		Reason:     "Pulled",
+		Type:       core.EventTypeNormal,
+	}
+	assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Added, Object: normal}))
+	assert.Equal(t, 2, len(wh.jsonReport.Events.Created))
+
+	// not a microservice
+	node := &eventsv1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1.1", Namespace: "default", UID: "4", ResourceVersion: "5"},
+		Regarding:  core.ObjectReference{Kind: "Node", Name: "node-1"},
+		Reason:     "NodeNotReady",
+		Type:       core.EventTypeWarning,
+	}
+	assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Added, Object: node}))
+	assert.Equal(t, 3, len(wh.jsonReport.Events.Created))
+	assert.Nil(t, wh.jsonReport.Events.Created[2].(eventData).PodSpecId)
+
+	// a deleted event is forgotten, not reported
+	assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Deleted, Object: backOff.DeepCopy()}))
+	assert.Equal(t, 0, len(wh.jsonReport.Events.Deleted))
+	assert.Equal(t, 2, len(wh.reportedEvents.versions))
+}
+
+func TestEventHandlerRateLimit(t *testing.T) {
+	wh := newTestWatchHandler()
+	wh.eventRateLimiter = newEventRateLimiter(&eventsConfig{MaxPerSecond: 0.001, Burst: 2})
+	for _, uid := range []string{"1", "2", "3"} {
+		event := &eventsv1.Event{ObjectMeta: metav1.ObjectMeta{Name: "web." + uid, Namespace: "default", UID: types.UID(uid), ResourceVersion: uid}}
+		assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Added, Object: event}))
+	}
+	assert.Equal(t, 2, len(wh.jsonReport.Events.Created))
+	// the dropped event is not marked as reported, its next version is reported
+	assert.Equal(t, 2, len(wh.reportedEvents.versions))
+}
+
+func TestEventHandlerOwners(t *testing.T) {
+	cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "default", UID: "CronJob-backup"}}
+	cronJobReference := newTestOwnerReference("batch/v1", "CronJob", "backup", true)
+	jobs := []*batchv1.Job{}
+	for _, name := range []string{"backup-1", "backup-2"} {
+		jobs = append(jobs, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID("Job-" + name), OwnerReferences: []metav1.OwnerReference{cronJobReference}}})
+	}
+	wh := newTestWatchHandler(cronJob, jobs[0], jobs[1])
+	defer close(wh.stopChan)
+	wh.eventsConfig = eventsConfig{Types: []string{core.EventTypeWarning}}
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            "backup-1-abcde",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{newTestOwnerReference("batch/v1", "Job", "backup-1", true)},
+	}}
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Added, Object: pod}))
+	id := wh.pods[podKey("default", "backup-1-abcde")].id
+
+	newEvent := func(uid types.UID, regarding core.ObjectReference) *eventsv1.Event {
+		return &eventsv1.Event{
+			ObjectMeta: metav1.ObjectMeta{Name: regarding.Name + ".1", Namespace: "default", UID: uid, ResourceVersion: "1"},
+			Regarding:  regarding,
+			Reason:     "BackoffLimitExceeded",
+			Type:       core.EventTypeWarning,
+		}
+	}
+	// the job of the first pod is in the owner chain of the microservice
+	job := core.ObjectReference{APIVersion: "batch/v1", Kind: "Job", Namespace: "default", Name: "backup-1", UID: "Job-backup-1"}
+	assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Added, Object: newEvent("1", job)}))
+	assert.Equal(t, id, *wh.jsonReport.Events.Created[0].(eventData).PodSpecId)
+
+	// another job of the cronjob is linked through its owner
+	job = core.ObjectReference{APIVersion: "batch/v1", Kind: "Job", Namespace: "default", Name: "backup-2", UID: "Job-backup-2"}
+	assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Added, Object: newEvent("2", job)}))
+	assert.Equal(t, id, *wh.jsonReport.Events.Created[1].(eventData).PodSpecId)
+
+	// the objects of the kinds owning no pod are not resolved
+	service := core.ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "backup", UID: "Service-backup"}
+	assert.NoError(t, wh.eventHandler(&watch.Event{Type: watch.Added, Object: newEvent("3", service)}))
+	assert.Nil(t, wh.jsonReport.Events.Created[2].(eventData).PodSpecId)
+	assert.Equal(t, 2, len(wh.owners.informers), "the informers of the jobs and the cronjobs only")
+}
@@ -0,0 +1,77 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	defaultFileSinkMaxSizeMB = 100
+	defaultFileSinkMaxFiles  = 5
+)
+
+// fileSink appends each report as a line to a local file (NDJSON). When the file grows over the max size it's rotated
+// to <path>.1, the older files are shifted up to <path>.<maxFiles>
+type fileSink struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	mutex    sync.Mutex
+}
+
+func newFileSink(config *sinkConfig) (*fileSink, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("file sink path is missing")
+	}
+	sink := &fileSink{
+		path:     config.Path,
+		maxSize:  int64(config.MaxSizeMB) * 1024 * 1024,
+		maxFiles: config.MaxFiles,
+	}
+	if sink.maxSize <= 0 {
+		sink.maxSize = defaultFileSinkMaxSizeMB * 1024 * 1024
+	}
+	if sink.maxFiles <= 0 {
+		sink.maxFiles = defaultFileSinkMaxFiles
+	}
+	return sink, nil
+}
+
+func (sink *fileSink) Name() string {
+	return "file sink " + sink.path
+}
+
+func (sink *fileSink) Send(report []byte) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if info, err := os.Stat(sink.path); err == nil && info.Size() > 0 && info.Size()+int64(len(report)) > sink.maxSize {
+		if err := sink.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate %s: %s", sink.path, err.Error())
+		}
+	}
+	f, err := os.OpenFile(sink.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(report); err != nil {
+		return err
+	}
+	_, err = f.Write([]byte{'\n'})
+	return err
+}
+
+func (sink *fileSink) rotate() error {
+	os.Remove(sink.rotatedPath(sink.maxFiles))
+	for i := sink.maxFiles - 1; i > 0; i-- {
+		if err := os.Rename(sink.rotatedPath(i), sink.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(sink.path, sink.rotatedPath(1))
+}
+
+func (sink *fileSink) rotatedPath(index int) string {
+	return fmt.Sprintf("%s.%d", sink.path, index)
+}
@@ -0,0 +1,239 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const gatewayAPIGroup = "gateway.networking.k8s.io"
+
+// gatewayAPIVersions are the versions of the Gateway API, the first one served is watched
+var gatewayAPIVersions = []string{"v1", "v1beta1", "v1alpha2"}
+
+// gatewayAPIDiscoveryInterval is the time to wait before looking for the Gateway API CRDs again
+const gatewayAPIDiscoveryInterval = 10 * time.Minute
+
+// httpRouteData is the reported HTTPRoute, with the services of its rules
+type httpRouteData struct {
+	*unstructured.Unstructured
+	Backends []ServiceBackend
+}
+
+// MarshalJSON reports the backends next to the fields of the route
+func (data httpRouteData) MarshalJSON() ([]byte, error) {
+	object := make(map[string]interface{}, len(data.Object)+1)
+	for key, value := range data.Object {
+		object[key] = value
+	}
+	object["backends"] = data.Backends
+	return json.Marshal(object)
+}
+
+// GatewayWatch watch over the Gateway API gateways, when the CRDs are installed
+func (wh *WatchHandler) GatewayWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER GatewayWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	gvr, found := wh.getServedGroupVersionResource(gatewayAPIGroup, gatewayAPIVersions, "gateways")
+	if !found {
+		glog.Infof("gateways are not served, looking again in %s", gatewayAPIDiscoveryInterval)
+		time.Sleep(gatewayAPIDiscoveryInterval)
+		return
+	}
+	glog.Infof("Watching over gateways %s starting", gvr.Version)
+	gatewayWatcher := wh.watchInformer(wh.dynamicInformerFactory.ForResource(gvr).Informer(), "gateway")
+	glog.Infof("Watching over gateways started")
+	wh.handleInformerEvents(gatewayWatcher, "gateway", wh.gatewayEventHandler)
+}
+
+// HTTPRouteWatch watch over the Gateway API HTTP routes, when the CRDs are installed
+func (wh *WatchHandler) HTTPRouteWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER HTTPRouteWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	gvr, found := wh.getServedGroupVersionResource(gatewayAPIGroup, gatewayAPIVersions, "httproutes")
+	if !found {
+		glog.Infof("httproutes are not served, looking again in %s", gatewayAPIDiscoveryInterval)
+		time.Sleep(gatewayAPIDiscoveryInterval)
+		return
+	}
+	glog.Infof("Watching over httproutes %s starting", gvr.Version)
+	httpRouteWatcher := wh.watchInformer(wh.dynamicInformerFactory.ForResource(gvr).Informer(), "httproute")
+	glog.Infof("Watching over httproutes started")
+	wh.handleInformerEventsAndRefresh(httpRouteWatcher, "httproute", wh.httpRouteEventHandler, wh.microServiceNotifier("httproute"), wh.refreshHTTPRoutes)
+}
+
+// getServedGroupVersionResource returns the resource in the first of the versions served by the API server
+func (wh *WatchHandler) getServedGroupVersionResource(group string, versions []string, resource string) (schema.GroupVersionResource, bool) {
+	for _, version := range versions {
+		gv := schema.GroupVersion{Group: group, Version: version}
+		resources, err := wh.RestAPIClient.Discovery().ServerResourcesForGroupVersion(gv.String())
+		if err != nil {
+			continue
+		}
+		for i := range resources.APIResources {
+			if resources.APIResources[i].Name == resource {
+				return gv.WithResource(resource), true
+			}
+		}
+	}
+	return schema.GroupVersionResource{}, false
+}
+
+func (wh *WatchHandler) gatewayEventHandler(event *watch.Event) error {
+	gateway, ok := event.Object.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("got unexpected gateway from chan")
+	}
+	if !wh.isNamespaceWatched(gateway.GetNamespace()) {
+		return nil
+	}
+	gateway.SetManagedFields(nil)
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		id, stored, found := wh.gatewaydm.lookup("gateway", gateway.GetNamespace(), gateway.GetName())
+		if !found {
+			id = CreateID("gateway", gateway.GetNamespace(), gateway.GetName())
+			wh.gatewaydm.init(id)
+			wh.gatewaydm.pushBack(id, gateway)
+			wh.jsonReport.AddToJsonFormat(gateway, GATEWAYS, CREATED)
+		} else if isUnstructuredChanged(stored.(*unstructured.Unstructured), gateway) {
+			wh.gatewaydm.updateFront(id, gateway)
+			glog.Infof("gateway %s updated", gateway.GetName())
+			wh.jsonReport.AddToJsonFormat(gateway, GATEWAYS, UPDATED)
+		} else {
+			return nil
+		}
+		informNewDataArrive(wh)
+	case watch.Deleted:
+		if id, _, found := wh.gatewaydm.lookup("gateway", gateway.GetNamespace(), gateway.GetName()); found {
+			wh.gatewaydm.remove(id)
+			DeleteID(id)
+			glog.Infof("gateway %s removed", gateway.GetName())
+			wh.jsonReport.AddToJsonFormat(gateway, GATEWAYS, DELETED)
+			informNewDataArrive(wh)
+		}
+	}
+	return nil
+}
+
+func (wh *WatchHandler) httpRouteEventHandler(event *watch.Event) error {
+	route, ok := event.Object.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("got unexpected httproute from chan")
+	}
+	if !wh.isNamespaceWatched(route.GetNamespace()) {
+		return nil
+	}
+	route.SetManagedFields(nil)
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		wh.updateHTTPRoute(httpRouteData{Unstructured: route, Backends: wh.getHTTPRouteBackends(route)})
+	case watch.Deleted:
+		if id, _, found := wh.httproutedm.lookup("httproute", route.GetNamespace(), route.GetName()); found {
+			wh.httproutedm.remove(id)
+			DeleteID(id)
+			glog.Infof("httproute %s removed", route.GetName())
+			wh.jsonReport.AddToJsonFormat(httpRouteData{Unstructured: route, Backends: []ServiceBackend{}}, HTTPROUTES, DELETED)
+			informNewDataArrive(wh)
+		}
+	}
+	return nil
+}
+
+// updateHTTPRoute stores the route and reports it when it's new or changed
+func (wh *WatchHandler) updateHTTPRoute(data httpRouteData) {
+	id, stored, found := wh.httproutedm.lookup("httproute", data.GetNamespace(), data.GetName())
+	if !found {
+		id = CreateID("httproute", data.GetNamespace(), data.GetName())
+		wh.httproutedm.init(id)
+		wh.httproutedm.pushBack(id, data)
+		wh.jsonReport.AddToJsonFormat(data, HTTPROUTES, CREATED)
+	} else if storedData := stored.(httpRouteData); isUnstructuredChanged(storedData.Unstructured, data.Unstructured) || !reflect.DeepEqual(storedData.Backends, data.Backends) {
+		wh.httproutedm.updateFront(id, data)
+		glog.Infof("httproute %s updated", data.GetName())
+		wh.jsonReport.AddToJsonFormat(data, HTTPROUTES, UPDATED)
+	} else {
+		return
+	}
+	informNewDataArrive(wh)
+}
+
+// refreshHTTPRoutes resolves the backends of the routes in the namespaces again
+func (wh *WatchHandler) refreshHTTPRoutes(namespaces []string) {
+	for _, namespace := range namespaces {
+		for _, id := range wh.httproutedm.getIDs() {
+			front := wh.httproutedm.front(id)
+			if front == nil {
+				continue
+			}
+			if data, ok := front.Value.(httpRouteData); ok && data.GetNamespace() == namespace {
+				wh.updateHTTPRoute(httpRouteData{Unstructured: data.Unstructured, Backends: wh.getHTTPRouteBackends(data.Unstructured)})
+			}
+		}
+	}
+}
+
+// getHTTPRouteBackends returns the services of the backendRefs of the rules, each service and port once
+func (wh *WatchHandler) getHTTPRouteBackends(route *unstructured.Unstructured) []ServiceBackend {
+	backends := []ServiceBackend{}
+	seen := map[string]bool{}
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	for i := range rules {
+		rule, ok := rules[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		backendRefs, _, _ := unstructured.NestedSlice(rule, "backendRefs")
+		for j := range backendRefs {
+			backendRef, ok := backendRefs[j].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// the group and kind default to core Service
+			group, _, _ := unstructured.NestedString(backendRef, "group")
+			kind, _, _ := unstructured.NestedString(backendRef, "kind")
+			if group != "" || (kind != "" && kind != "Service") {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(backendRef, "name")
+			namespace, _, _ := unstructured.NestedString(backendRef, "namespace")
+			if namespace == "" {
+				namespace = route.GetNamespace()
+			}
+			port := ""
+			if number, found, _ := unstructured.NestedInt64(backendRef, "port"); found {
+				port = strconv.FormatInt(number, 10)
+			}
+			if key := namespace + "/" + name + ":" + port; !seen[key] {
+				seen[key] = true
+				backends = append(backends, wh.newServiceBackend(namespace, name, port))
+			}
+		}
+	}
+	return backends
+}
+
+// isUnstructuredChanged compares the parts of the object worth reporting
+func isUnstructuredChanged(oldObj, newObj *unstructured.Unstructured) bool {
+	return !reflect.DeepEqual(oldObj.GetLabels(), newObj.GetLabels()) ||
+		!reflect.DeepEqual(oldObj.GetAnnotations(), newObj.GetAnnotations()) ||
+		!reflect.DeepEqual(oldObj.GetOwnerReferences(), newObj.GetOwnerReferences()) ||
+		!reflect.DeepEqual(oldObj.GetFinalizers(), newObj.GetFinalizers()) ||
+		!reflect.DeepEqual(oldObj.GetDeletionTimestamp(), newObj.GetDeletionTimestamp()) ||
+		!reflect.DeepEqual(oldObj.Object["spec"], newObj.Object["spec"]) ||
+		!reflect.DeepEqual(oldObj.Object["status"], newObj.Object["status"])
+}
@@ -0,0 +1,109 @@
+package watch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestHTTPRoute(backendRefs ...interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1beta1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default", "resourceVersion": "1"},
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{map[string]interface{}{"name": "gateway"}},
+			"rules":      []interface{}{map[string]interface{}{"backendRefs": backendRefs}},
+		},
+	}}
+}
+
+func TestGetServedGroupVersionResource(t *testing.T) {
+	wh := newTestWatchHandler()
+	_, found := wh.getServedGroupVersionResource(gatewayAPIGroup, gatewayAPIVersions, "httproutes")
+	assert.False(t, found)
+
+	wh.RestAPIClient.(*fake.Clientset).Resources = []*metav1.APIResourceList{
+		{GroupVersion: "gateway.networking.k8s.io/v1alpha2", APIResources: []metav1.APIResource{{Name: "httproutes"}}},
+		{GroupVersion: "gateway.networking.k8s.io/v1beta1", APIResources: []metav1.APIResource{{Name: "gateways"}, {Name: "httproutes"}}},
+	}
+	gvr, found := wh.getServedGroupVersionResource(gatewayAPIGroup, gatewayAPIVersions, "httproutes")
+	assert.True(t, found)
+	assert.Equal(t, schema.GroupVersionResource{Group: gatewayAPIGroup, Version: "v1beta1", Resource: "httproutes"}, gvr)
+}
+
+func TestHTTPRouteEventHandler(t *testing.T) {
+	service := &core.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       core.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	}
+	wh := newTestWatchHandler(service)
+	defer close(wh.stopChan)
+	syncServices(wh)
+	newTestMicroService(wh, 1, "default", "web", map[string]string{"app": "web"})
+
+	route := newTestHTTPRoute(
+		map[string]interface{}{"name": "web", "port": int64(80)},
+		map[string]interface{}{"name": "web", "port": int64(80), "weight": int64(10)},
+		map[string]interface{}{"name": "db", "namespace": "data", "port": int64(5432)},
+		map[string]interface{}{"group": "example.com", "kind": "Bucket", "name": "files"},
+	)
+	assert.NoError(t, wh.httpRouteEventHandler(&watch.Event{Type: watch.Added, Object: route.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.HTTPRoutes.Created))
+	data := wh.jsonReport.HTTPRoutes.Created[0].(httpRouteData)
+	assert.Equal(t, []ServiceBackend{
+		{ServiceName: "web", Namespace: "default", Port: "80", PodSpecIds: []int{1}},
+		{ServiceName: "db", Namespace: "data", Port: "5432", PodSpecIds: []int{}},
+	}, data.Backends)
+
+	raw, err := json.Marshal(data)
+	assert.NoError(t, err)
+	reported := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(raw, &reported))
+	assert.Equal(t, "HTTPRoute", reported["kind"])
+	assert.Equal(t, 2, len(reported["backends"].([]interface{})))
+
+	// a new resourceVersion alone is not an update
+	sameRoute := route.DeepCopy()
+	sameRoute.SetResourceVersion("2")
+	assert.NoError(t, wh.httpRouteEventHandler(&watch.Event{Type: watch.Modified, Object: sameRoute}))
+	assert.Nil(t, wh.jsonReport.HTTPRoutes.Updated)
+
+	newTestMicroService(wh, 2, "default", "web-canary", map[string]string{"app": "web"})
+	wh.refreshHTTPRoutes([]string{"default"})
+	assert.Equal(t, 1, len(wh.jsonReport.HTTPRoutes.Updated))
+	assert.Equal(t, []int{1, 2}, wh.jsonReport.HTTPRoutes.Updated[0].(httpRouteData).Backends[0].PodSpecIds)
+
+	assert.NoError(t, wh.httpRouteEventHandler(&watch.Event{Type: watch.Deleted, Object: route.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.HTTPRoutes.Deleted))
+	assert.Equal(t, 0, wh.httproutedm.len())
+}
+
+func TestGatewayEventHandler(t *testing.T) {
+	wh := newTestWatchHandler()
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1beta1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{"name": "gateway", "namespace": "default", "resourceVersion": "1"},
+		"spec":       map[string]interface{}{"gatewayClassName": "istio"},
+	}}
+	assert.NoError(t, wh.gatewayEventHandler(&watch.Event{Type: watch.Added, Object: gateway.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Gateways.Created))
+
+	changed := gateway.DeepCopy()
+	changed.SetResourceVersion("2")
+	assert.NoError(t, unstructured.SetNestedField(changed.Object, "Programmed", "status", "phase"))
+	assert.NoError(t, wh.gatewayEventHandler(&watch.Event{Type: watch.Modified, Object: changed}))
+	assert.Equal(t, 1, len(wh.jsonReport.Gateways.Updated))
+
+	assert.NoError(t, wh.gatewayEventHandler(&watch.Event{Type: watch.Deleted, Object: changed.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Gateways.Deleted))
+	assert.Equal(t, 0, wh.gatewaydm.len())
+}
@@ -0,0 +1,53 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// httpSink posts each report to a URL
+type httpSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPSink(config *sinkConfig) (*httpSink, error) {
+	if _, err := url.ParseRequestURI(config.URL); err != nil {
+		return nil, fmt.Errorf("invalid http sink url '%s': %s", config.URL, err.Error())
+	}
+	return &httpSink{
+		url:     config.URL,
+		headers: config.Headers,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (sink *httpSink) Name() string {
+	return "http sink " + sink.url
+}
+
+func (sink *httpSink) Send(report []byte) error {
+	req, err := http.NewRequest(http.MethodPost, sink.url, bytes.NewReader(report))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range sink.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := sink.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("http error: %s", resp.Status)
+	}
+	return nil
+}
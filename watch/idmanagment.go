@@ -1,56 +1,89 @@
 package watch
 
 import (
-	"container/list"
+	"expvar"
+	"hash/fnv"
+	"strings"
 	"sync"
+
+	"github.com/golang/glog"
 )
 
-type IDDataBase struct {
-	Ids     *list.List
-	Mutex   sync.RWMutex
-	counter int
-}
+// idBits is the length of the IDs, they are exact as JSON numbers
+const idBits = 53
 
-var ids IDDataBase = IDDataBase{Ids: list.New(), counter: 0}
+// idMetrics counts the collisions of the IDs, served at /debug/vars with the probes
+var idMetrics = expvar.NewMap("ids")
 
-//static function
-func IDCreator() int {
-	id := ids.counter
-	ids.counter++
-	return id
+// IDDataBase holds the IDs in use. An ID is derived from the identity of what it's given to, with the cluster name, so
+// it's the same after a restart. The IDs are 53 bits long, so a collision is unlikely below millions of identities,
+// but when the hashes of two identities collide, the identity created last gets the next free ID: which one depends on
+// the order they were created in, and isn't stable across restarts. Collisions are logged as errors and counted
+type IDDataBase struct {
+	// Ids are the identities by ID, and identities the IDs by identity
+	Ids         map[int]string
+	identities  map[string]int
+	clusterName string
+	Mutex       sync.RWMutex
 }
 
-func CreateID() int {
-
-	var id int
-	var flag int = 1
+var ids IDDataBase = IDDataBase{Ids: make(map[int]string), identities: make(map[string]int)}
 
+// setIDsClusterName sets the cluster name the IDs are derived with
+func setIDsClusterName(clusterName string) {
 	ids.Mutex.Lock()
 	defer ids.Mutex.Unlock()
+	ids.clusterName = clusterName
+}
 
-	for flag == 1 {
-		flag = 0
-		id = IDCreator()
-		for e := ids.Ids.Front(); e != nil; e = e.Next() {
-			if e.Value.(int) == id {
-				flag = 1
-				break
-			}
+// CreateID returns the ID of the identity, made of the parts identifying an object, like its kind, namespace and name
+func CreateID(identity ...string) int {
+	ids.Mutex.Lock()
+	defer ids.Mutex.Unlock()
+	key := ids.key(identity)
+	if id, ok := ids.identities[key]; ok {
+		return id
+	}
+	id := hashID(key)
+	for {
+		other, ok := ids.Ids[id]
+		if !ok {
+			break
 		}
-
+		glog.Errorf("ID collision: %s has the ID %d of %s, its ID depends on the order they were created in and may change after a restart", key, id, other)
+		idMetrics.Add("collisions", 1)
+		id = (id + 1) & (1<<idBits - 1)
 	}
-	ids.Ids.PushBack(id)
+	ids.Ids[id] = key
+	ids.identities[key] = id
 	return id
 }
 
+// getID returns the ID of the identity when it was created
+func getID(identity ...string) (int, bool) {
+	ids.Mutex.RLock()
+	defer ids.Mutex.RUnlock()
+	id, ok := ids.identities[ids.key(identity)]
+	return id, ok
+}
+
+// DeleteID releases the ID, it's created again the same unless another identity with the same hash took it meanwhile
 func DeleteID(id int) {
 	ids.Mutex.Lock()
 	defer ids.Mutex.Unlock()
-
-	for e := ids.Ids.Front(); e != nil; e = e.Next() {
-		if e.Value.(int) == id {
-			ids.Ids.Remove(e)
-			break
-		}
+	if key, ok := ids.Ids[id]; ok {
+		delete(ids.identities, key)
+		delete(ids.Ids, id)
 	}
 }
+
+func (db *IDDataBase) key(identity []string) string {
+	return db.clusterName + "/" + strings.Join(identity, "/")
+}
+
+// hashID is a variable for the tests to collide the IDs
+var hashID = func(key string) int {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int(h.Sum64() & (1<<idBits - 1))
+}
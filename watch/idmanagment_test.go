@@ -1,22 +1,60 @@
 package watch
 
 import (
-	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCreateID(t *testing.T) {
-	s0 := CreateID()
-	fmt.Printf("%d\n", s0)
-	s1 := CreateID()
-	fmt.Printf("%d\n", s1)
-
+	s0 := CreateID("test", "default", "web")
+	assert.Equal(t, s0, CreateID("test", "default", "web"), "the same identity has the same ID")
+	assert.Less(t, s0, 1<<idBits)
+	s1 := CreateID("test", "default", "db")
 	assert.NotEqual(t, s1, s0, "ids equal")
-
-	s2 := CreateID()
-	fmt.Printf("%d\n", s2)
+	s2 := CreateID("test", "other", "web")
 	assert.NotEqual(t, s1, s2, "ids equal")
 	assert.NotEqual(t, s2, s0, "ids equal")
+
+	id, ok := getID("test", "default", "web")
+	assert.True(t, ok)
+	assert.Equal(t, s0, id)
+
+	// the ID is the same once released and created again
+	DeleteID(s0)
+	_, ok = getID("test", "default", "web")
+	assert.False(t, ok)
+	assert.Equal(t, s0, CreateID("test", "default", "web"))
+	DeleteID(s0)
+	DeleteID(s1)
+	DeleteID(s2)
+}
+
+func TestCreateIDCollision(t *testing.T) {
+	defer func(hash func(string) int) { hashID = hash }(hashID)
+	hashID = func(string) int { return 42 }
+
+	// the identity created first gets the ID, whatever the order
+	for _, identities := range [][]string{{"web", "db"}, {"db", "web"}} {
+		collisions := getMetric(idMetrics, "collisions")
+		first := CreateID("test", identities[0])
+		second := CreateID("test", identities[1])
+		assert.Equal(t, 42, first)
+		assert.Equal(t, 43, second)
+		assert.Equal(t, collisions+1, getMetric(idMetrics, "collisions"), "the collision is counted")
+		assert.Equal(t, second, CreateID("test", identities[1]), "the ID of a created identity doesn't change")
+		assert.Equal(t, collisions+1, getMetric(idMetrics, "collisions"))
+		DeleteID(first)
+		DeleteID(second)
+	}
+}
+
+func TestIDsClusterName(t *testing.T) {
+	s0 := CreateID("test", "default", "web")
+	DeleteID(s0)
+	setIDsClusterName("other-cluster")
+	defer setIDsClusterName("")
+	s1 := CreateID("test", "default", "web")
+	DeleteID(s1)
+	assert.NotEqual(t, s0, s1, "the IDs of the clusters differ")
 }
@@ -0,0 +1,268 @@
+package watch
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const defaultImageRegistry = "docker.io"
+
+// ImageData is an image running in the cluster, by digest
+type ImageData struct {
+	Digest string `json:"digest"`
+	// Registries and Repositories are where the pods pull the image from, the repositories with their registry
+	Registries   []string `json:"registries"`
+	Repositories []string `json:"repositories"`
+	// Tags are the tags of the image in the pod specs, latest when a spec has no tag nor digest
+	Tags         []string          `json:"tags"`
+	PullPolicies []core.PullPolicy `json:"pullPolicies"`
+	Workloads    []ImageWorkload   `json:"workloads"`
+	Nodes        []string          `json:"nodes"`
+	// FirstSeen is when a pod started to run the image, LastSeen the last time the pods running it changed
+	FirstSeen string `json:"firstSeen"`
+	LastSeen  string `json:"lastSeen"`
+}
+
+// ImageWorkload is a workload running an image, the pod itself for a pod without owner
+type ImageWorkload struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+}
+
+// imageUse is an image run by a container of a pod
+type imageUse struct {
+	digest     string
+	registry   string
+	repository string
+	tag        string
+	pullPolicy core.PullPolicy
+	workload   ImageWorkload
+	node       string
+}
+
+type inventoryImage struct {
+	data ImageData
+	// uses are the containers running the image, by pod and container
+	uses map[string]imageUse
+}
+
+// imageInventory keeps the images running in the cluster, from the container statuses of the pods
+type imageInventory struct {
+	images map[string]*inventoryImage
+	// podImages are the keys of the uses of the images by pod
+	podImages map[string][]string
+	mutex     sync.Mutex
+}
+
+func newImageInventory() *imageInventory {
+	return &imageInventory{images: make(map[string]*inventoryImage), podImages: make(map[string][]string)}
+}
+
+// reset forgets the images, so they are reported again as created
+func (inventory *imageInventory) reset() {
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	inventory.images = make(map[string]*inventoryImage)
+	inventory.podImages = make(map[string][]string)
+}
+
+// updateImages updates the image inventory with the images the pod runs and reports the images created, changed
+// or removed. A deleted or finished pod runs no image
+func (wh *WatchHandler) updateImages(eventType watch.EventType, pod *core.Pod, od *OwnerDet) {
+	uses := map[string]imageUse{}
+	if eventType != watch.Deleted && pod.Status.Phase != core.PodSucceeded && pod.Status.Phase != core.PodFailed {
+		uses = getPodImageUses(pod, ImageWorkload{Namespace: pod.Namespace, Kind: od.Kind, Name: od.Name})
+	}
+	reports := wh.images.setPodImages(pod.Namespace+"/"+pod.Name, uses, time.Now().UTC().Format(time.RFC3339))
+	for i := range reports {
+		wh.jsonReport.AddToJsonFormat(reports[i].data, IMAGES, reports[i].stype)
+	}
+	if len(reports) > 0 {
+		informNewDataArrive(wh)
+	}
+}
+
+type imageReport struct {
+	data  ImageData
+	stype StateType
+}
+
+// setPodImages replaces the uses of the images by the pod, and returns what to report about the images it changed
+func (inventory *imageInventory) setPodImages(podKey string, uses map[string]imageUse, now string) []imageReport {
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	changed := map[string]bool{}
+	for _, key := range inventory.podImages[podKey] {
+		digest := strings.SplitN(key, "|", 2)[0]
+		if image, ok := inventory.images[digest]; ok {
+			delete(image.uses, key)
+			changed[digest] = true
+		}
+	}
+	delete(inventory.podImages, podKey)
+	for key, use := range uses {
+		image, ok := inventory.images[use.digest]
+		if !ok {
+			image = &inventoryImage{data: ImageData{Digest: use.digest}, uses: make(map[string]imageUse)}
+			inventory.images[use.digest] = image
+		}
+		image.uses[key] = use
+		inventory.podImages[podKey] = append(inventory.podImages[podKey], key)
+		changed[use.digest] = true
+	}
+	reports := []imageReport{}
+	for digest := range changed {
+		image := inventory.images[digest]
+		if len(image.uses) == 0 {
+			delete(inventory.images, digest)
+			image.data.LastSeen = now
+			reports = append(reports, imageReport{data: image.data, stype: DELETED})
+			continue
+		}
+		data := newImageData(digest, image.uses)
+		if image.data.FirstSeen == "" {
+			data.FirstSeen, data.LastSeen = now, now
+			image.data = data
+			reports = append(reports, imageReport{data: data, stype: CREATED})
+			continue
+		}
+		data.FirstSeen, data.LastSeen = image.data.FirstSeen, image.data.LastSeen
+		if reflect.DeepEqual(data, image.data) {
+			continue
+		}
+		data.LastSeen = now
+		image.data = data
+		reports = append(reports, imageReport{data: data, stype: UPDATED})
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].data.Digest < reports[j].data.Digest })
+	return reports
+}
+
+// newImageData returns the image aggregating its uses, without the times
+func newImageData(digest string, uses map[string]imageUse) ImageData {
+	registries, repositories, tags, pullPolicies, nodes := map[string]bool{}, map[string]bool{}, map[string]bool{}, map[string]bool{}, map[string]bool{}
+	workloads := map[ImageWorkload]bool{}
+	for _, use := range uses {
+		registries[use.registry] = true
+		repositories[use.registry+"/"+use.repository] = true
+		if use.tag != "" {
+			tags[use.tag] = true
+		}
+		if use.pullPolicy != "" {
+			pullPolicies[string(use.pullPolicy)] = true
+		}
+		if use.node != "" {
+			nodes[use.node] = true
+		}
+		workloads[use.workload] = true
+	}
+	data := ImageData{
+		Digest:       digest,
+		Registries:   sortedKeys(registries),
+		Repositories: sortedKeys(repositories),
+		Tags:         sortedKeys(tags),
+		PullPolicies: []core.PullPolicy{},
+		Workloads:    make([]ImageWorkload, 0, len(workloads)),
+		Nodes:        sortedKeys(nodes),
+	}
+	for _, pullPolicy := range sortedKeys(pullPolicies) {
+		data.PullPolicies = append(data.PullPolicies, core.PullPolicy(pullPolicy))
+	}
+	for workload := range workloads {
+		data.Workloads = append(data.Workloads, workload)
+	}
+	sort.Slice(data.Workloads, func(i, j int) bool {
+		a, b := data.Workloads[i], data.Workloads[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	return data
+}
+
+// getPodImageUses returns the images run by the containers of the pod, by container. The containers not started
+// yet have no image ID
+func getPodImageUses(pod *core.Pod, workload ImageWorkload) map[string]imageUse {
+	containers := map[string]*core.Container{}
+	for i := range pod.Spec.InitContainers {
+		containers[pod.Spec.InitContainers[i].Name] = &pod.Spec.InitContainers[i]
+	}
+	for i := range pod.Spec.Containers {
+		containers[pod.Spec.Containers[i].Name] = &pod.Spec.Containers[i]
+	}
+	uses := map[string]imageUse{}
+	statuses := make([]core.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for i := range statuses {
+		digest := getImageDigest(statuses[i].ImageID)
+		if digest == "" {
+			continue
+		}
+		use := imageUse{digest: digest, workload: workload, node: pod.Spec.NodeName}
+		image := statuses[i].Image
+		if container, ok := containers[statuses[i].Name]; ok {
+			image = container.Image
+			use.pullPolicy = container.ImagePullPolicy
+		}
+		use.registry, use.repository, use.tag = parseImageName(image)
+		uses[digest+"|"+pod.Namespace+"/"+pod.Name+"/"+statuses[i].Name] = use
+	}
+	return uses
+}
+
+// getImageDigest returns the digest of the image ID of a container status, like
+// docker-pullable://nginx@sha256:... or docker.io/library/nginx@sha256:...
+func getImageDigest(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i >= 0 {
+		return imageID[i+1:]
+	}
+	if i := strings.Index(imageID, "://"); i >= 0 {
+		return imageID[i+3:]
+	}
+	return imageID
+}
+
+// parseImageName returns the registry, the repository and the tag of an image name. The registry defaults to
+// docker.io and the tag to latest, unless the image is pulled by digest
+func parseImageName(image string) (string, string, string) {
+	name, tag := image, ""
+	byDigest := false
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, byDigest = name[:i], true
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	if tag == "" && !byDigest {
+		tag = "latest"
+	}
+	registry := defaultImageRegistry
+	if i := strings.Index(name, "/"); i >= 0 && (strings.ContainsAny(name[:i], ".:") || name[:i] == "localhost") {
+		registry, name = name[:i], name[i+1:]
+	} else if i < 0 {
+		// the official images of docker hub
+		name = "library/" + name
+	}
+	return registry, name, tag
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,92 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestParseImageName(t *testing.T) {
+	tests := []struct {
+		image, registry, repository, tag string
+	}{
+		{"nginx", "docker.io", "library/nginx", "latest"},
+		{"nginx:1.21", "docker.io", "library/nginx", "1.21"},
+		{"bitnami/redis:7.0", "docker.io", "bitnami/redis", "7.0"},
+		{"gcr.io/project/app@sha256:1234", "gcr.io", "project/app", ""},
+		{"localhost:5000/app:v1", "localhost:5000", "app", "v1"},
+		{"quay.io/prometheus/node-exporter:v1.3.1@sha256:1234", "quay.io", "prometheus/node-exporter", "v1.3.1"},
+	}
+	for _, test := range tests {
+		registry, repository, tag := parseImageName(test.image)
+		assert.Equal(t, test.registry, registry, test.image)
+		assert.Equal(t, test.repository, repository, test.image)
+		assert.Equal(t, test.tag, tag, test.image)
+	}
+}
+
+func TestGetImageDigest(t *testing.T) {
+	assert.Equal(t, "sha256:1234", getImageDigest("docker-pullable://nginx@sha256:1234"))
+	assert.Equal(t, "sha256:1234", getImageDigest("docker.io/library/nginx@sha256:1234"))
+	assert.Equal(t, "sha256:1234", getImageDigest("docker://sha256:1234"))
+	assert.Equal(t, "", getImageDigest(""))
+}
+
+func newTestImagePod(name, node, image, imageID string) *core.Pod {
+	return &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: core.PodSpec{
+			NodeName:   node,
+			Containers: []core.Container{{Name: "app", Image: image, ImagePullPolicy: core.PullIfNotPresent}},
+		},
+		Status: core.PodStatus{
+			Phase:             core.PodRunning,
+			ContainerStatuses: []core.ContainerStatus{{Name: "app", Image: image, ImageID: imageID}},
+		},
+	}
+}
+
+func TestUpdateImages(t *testing.T) {
+	wh := newTestWatchHandler()
+	od := &OwnerDet{Name: "web", Kind: "Deployment"}
+
+	// a container not started yet has no image
+	pending := newTestImagePod("web-1", "node-1", "nginx:1.21", "")
+	wh.updateImages(watch.Added, pending, od)
+	assert.Nil(t, wh.jsonReport.Images)
+
+	web1 := newTestImagePod("web-1", "node-1", "nginx:1.21", "docker-pullable://nginx@sha256:1234")
+	wh.updateImages(watch.Modified, web1, od)
+	assert.Equal(t, 1, len(wh.jsonReport.Images.Created))
+	image := wh.jsonReport.Images.Created[0].(ImageData)
+	assert.Equal(t, "sha256:1234", image.Digest)
+	assert.Equal(t, []string{"docker.io"}, image.Registries)
+	assert.Equal(t, []string{"docker.io/library/nginx"}, image.Repositories)
+	assert.Equal(t, []string{"1.21"}, image.Tags)
+	assert.Equal(t, []core.PullPolicy{core.PullIfNotPresent}, image.PullPolicies)
+	assert.Equal(t, []ImageWorkload{{Namespace: "default", Kind: "Deployment", Name: "web"}}, image.Workloads)
+	assert.Equal(t, []string{"node-1"}, image.Nodes)
+	assert.NotEmpty(t, image.FirstSeen)
+
+	// the image is updated when it runs on another node, not when the pods change otherwise
+	wh.updateImages(watch.Modified, web1, od)
+	assert.Nil(t, wh.jsonReport.Images.Updated)
+	web2 := newTestImagePod("web-2", "node-2", "nginx:1.21", "docker-pullable://nginx@sha256:1234")
+	wh.updateImages(watch.Added, web2, od)
+	assert.Equal(t, 1, len(wh.jsonReport.Images.Updated))
+	assert.Equal(t, []string{"node-1", "node-2"}, wh.jsonReport.Images.Updated[0].(ImageData).Nodes)
+
+	// the image is deleted with its last pod
+	wh.updateImages(watch.Deleted, web1, od)
+	assert.Equal(t, 2, len(wh.jsonReport.Images.Updated))
+	assert.Nil(t, wh.jsonReport.Images.Deleted)
+	web2.Status.Phase = core.PodSucceeded
+	wh.updateImages(watch.Modified, web2, od)
+	assert.Equal(t, 1, len(wh.jsonReport.Images.Deleted))
+	assert.Equal(t, "sha256:1234", wh.jsonReport.Images.Deleted[0].(ImageData).Digest)
+	assert.Empty(t, wh.images.images)
+	assert.Empty(t, wh.images.podImages)
+}
@@ -0,0 +1,284 @@
+package watch
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informersResyncPeriod is zero since the informers re-list by themselves when a watch can't be resumed,
+// and the full state is replayed to the handlers on every new connection to BE
+const informersResyncPeriod = 0
+
+// newSharedInformerFactory creates the informers factory. Bookmarks keep the resourceVersion of the informers up to date
+// on quiet resources, so a watch can be resumed instead of re-listing
+func newSharedInformerFactory(client kubernetes.Interface) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(client, informersResyncPeriod,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.AllowWatchBookmarks = true
+		}))
+}
+
+// newDynamicSharedInformerFactory creates the factory of the dynamic informers, with the options of newSharedInformerFactory
+func newDynamicSharedInformerFactory(client dynamic.Interface) dynamicinformer.DynamicSharedInformerFactory {
+	return dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, informersResyncPeriod, metav1.NamespaceAll,
+		func(options *metav1.ListOptions) {
+			options.AllowWatchBookmarks = true
+		})
+}
+
+// informerWatcher adapts a shared informer to the event handlers of the watchers.
+// The informer does the initial LIST, and its reflector resumes the watch from the last resourceVersion it saw,
+// bookmarks included, and re-lists by itself when that resourceVersion is too old, so the handlers get every object
+// exactly once as ADDED and only real changes afterwards.
+type informerWatcher struct {
+	informer cache.SharedIndexInformer
+	kind     string
+	events   chan watch.Event
+	// newStateChan is signaled whenever a new connection to BE is initialized, the cache is then replayed as ADDED events.
+	// It's registered once the informer synced, an informer that can't list doesn't hold back the reports
+	newStateChan chan bool
+	registered   bool
+}
+
+type informerWatchers struct {
+	watchers map[cache.SharedIndexInformer]*informerWatcher
+	// newStateChans are signaled in a loop whenever a new connection to BE is initialized
+	newStateChans []chan bool
+	// kinds are the kinds of the watchers whose informer synced
+	kinds map[string]bool
+	mutex sync.Mutex
+}
+
+// getNewStateChans returns the newStateChan of the watchers whose informer synced
+func (iws *informerWatchers) getNewStateChans() []chan bool {
+	iws.mutex.Lock()
+	defer iws.mutex.Unlock()
+	return append([]chan bool{}, iws.newStateChans...)
+}
+
+// isWatched returns whether the informer of the watcher of the kind synced, its lister then has all the objects
+func (iws *informerWatchers) isWatched(kind string) bool {
+	iws.mutex.Lock()
+	defer iws.mutex.Unlock()
+	return iws.kinds[kind]
+}
+
+func newInformerWatcher(informer cache.SharedIndexInformer, kind string) *informerWatcher {
+	iw := &informerWatcher{
+		informer:     informer,
+		kind:         kind,
+		events:       make(chan watch.Event),
+		newStateChan: make(chan bool),
+	}
+	informer.AddEventHandler(iw)
+	return iw
+}
+
+// OnAdd is called for new objects, and after a re-list for the objects missed while the watch was down
+func (iw *informerWatcher) OnAdd(obj interface{}) {
+	iw.push(watch.Added, obj)
+}
+
+// OnUpdate is called for modified objects. A re-list re-delivers the objects we already have,
+// only the resourceVersion tells if something changed
+func (iw *informerWatcher) OnUpdate(oldObj, newObj interface{}) {
+	if isSameResourceVersion(oldObj, newObj) {
+		return
+	}
+	iw.push(watch.Modified, newObj)
+}
+
+// OnDelete is called for deleted objects. When the deletion was missed while the watch was down, the object found
+// missing on the re-list is wrapped in a tombstone holding its last known state
+func (iw *informerWatcher) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		glog.Infof("%s was deleted while the watch was down", tombstone.Key)
+		obj = tombstone.Obj
+	}
+	iw.push(watch.Deleted, obj)
+}
+
+func (iw *informerWatcher) push(eventType watch.EventType, obj interface{}) {
+	robj, ok := obj.(runtime.Object)
+	if !ok {
+		glog.Errorf("informer event %s: unexpected object %T", eventType, obj)
+		return
+	}
+	// the cached object is shared with the other informer consumers, the handlers must get their own copy
+	iw.events <- watch.Event{Type: eventType, Object: robj.DeepCopyObject()}
+}
+
+// ResultChan returns the events of the informer
+func (iw *informerWatcher) ResultChan() <-chan watch.Event {
+	return iw.events
+}
+
+// replay returns the current content of the informer cache as ADDED events
+func (iw *informerWatcher) replay() []watch.Event {
+	objs := iw.informer.GetStore().List()
+	events := make([]watch.Event, 0, len(objs))
+	for i := range objs {
+		if robj, ok := objs[i].(runtime.Object); ok {
+			events = append(events, watch.Event{Type: watch.Added, Object: robj.DeepCopyObject()})
+		}
+	}
+	return events
+}
+
+func isSameResourceVersion(oldObj, newObj interface{}) bool {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		return false
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		return false
+	}
+	return oldMeta.GetResourceVersion() == newMeta.GetResourceVersion()
+}
+
+// watchInformer returns the watcher of the informer, starts the informer and waits for its initial LIST to end.
+// A watcher is created once per informer, so a restarted watch loop continues from where it stopped
+func (wh *WatchHandler) watchInformer(informer cache.SharedIndexInformer, kind string) *informerWatcher {
+	wh.informerWatchers.mutex.Lock()
+	iw, ok := wh.informerWatchers.watchers[informer]
+	if !ok {
+		iw = newInformerWatcher(informer, kind)
+		wh.informerWatchers.watchers[informer] = iw
+		setWatchErrorHandler(informer, kind)
+	}
+	wh.informerFactory.Start(wh.stopChan)
+	if wh.dynamicInformerFactory != nil {
+		wh.dynamicInformerFactory.Start(wh.stopChan)
+	}
+	wh.informerWatchers.mutex.Unlock()
+
+	// only this informer is waited for, an informer of the factories that can't list, e.g. forbidden, doesn't hold
+	// back the other watchers
+	if !cache.WaitForCacheSync(wh.stopChan, informer.HasSynced) {
+		glog.Errorf("%s watch: stopped before the initial list ended", kind)
+		return iw
+	}
+	wh.informerWatchers.mutex.Lock()
+	if !iw.registered {
+		iw.registered = true
+		wh.informerWatchers.newStateChans = append(wh.informerWatchers.newStateChans, iw.newStateChan)
+		wh.informerWatchers.kinds[kind] = true
+	}
+	wh.informerWatchers.mutex.Unlock()
+	return iw
+}
+
+// watchersSyncTimeout bounds the wait for the initial LIST of the watchers before the first report
+var watchersSyncTimeout = 2 * time.Minute
+
+// waitForWatchersSync waits for the initial LIST of the informers of the watchers started so far, not for the owner
+// informers started on demand. The watchers not synced within watchersSyncTimeout, e.g. forbidden, are left out of
+// the first report, their objects are reported once they synced
+func (wh *WatchHandler) waitForWatchersSync() {
+	wh.informerWatchers.mutex.Lock()
+	watchers := make([]*informerWatcher, 0, len(wh.informerWatchers.watchers))
+	synced := make([]cache.InformerSynced, 0, len(wh.informerWatchers.watchers))
+	for informer, iw := range wh.informerWatchers.watchers {
+		watchers = append(watchers, iw)
+		synced = append(synced, informer.HasSynced)
+	}
+	wh.informerWatchers.mutex.Unlock()
+
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(watchersSyncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-wh.stopChan:
+			// the timer closes timeout when it already fired
+			if timer.Stop() {
+				close(timeout)
+			}
+		case <-timeout:
+		case <-done:
+		}
+	}()
+	if cache.WaitForCacheSync(timeout, synced...) {
+		return
+	}
+	for _, iw := range watchers {
+		if !iw.informer.HasSynced() {
+			glog.Errorf("%s watch: the initial list didn't end within %s, reporting without it", iw.kind, watchersSyncTimeout)
+		}
+	}
+}
+
+// setWatchErrorHandler logs how the informer recovers from a broken watch. The informer resumes from the last
+// resourceVersion it saw (bookmarks included), when that resourceVersion is too old the API server answers with
+// 410 Gone and the informer re-lists. The re-list is compared with the cache, so the handlers get the difference
+// as ADDED, MODIFIED and DELETED events
+func setWatchErrorHandler(informer cache.SharedIndexInformer, kind string) {
+	err := informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		if isResourceVersionExpired(err) {
+			glog.Warningf("%s watch: resourceVersion %s is too old, re-listing. reason: %s", kind, r.LastSyncResourceVersion(), err.Error())
+			return
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			glog.Infof("%s watch closed, resuming from resourceVersion %s", kind, r.LastSyncResourceVersion())
+			return
+		}
+		glog.Errorf("%s watch failed, resuming from resourceVersion %s. reason: %s", kind, r.LastSyncResourceVersion(), err.Error())
+	})
+	if err != nil {
+		// the informer is shared and was already started with the handler set by registerOwnerInformers
+		glog.Infof("%s watch: %s", kind, err.Error())
+	}
+}
+
+func isResourceVersionExpired(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+// handleInformerEvents passes the events of the watcher to the handler. On a new connection to BE the handler gets the
+// whole informer cache again, so the first report holds the full cluster state
+func (wh *WatchHandler) handleInformerEvents(iw *informerWatcher, kind string, eventHandler func(*watch.Event) error) {
+	wh.handleInformerEventsAndRefresh(iw, kind, eventHandler, nil, nil)
+}
+
+// handleInformerEventsAndRefresh is handleInformerEvents for the watchers linking their objects to the microservices.
+// The refresh is called with the namespaces where the microservices changed
+func (wh *WatchHandler) handleInformerEventsAndRefresh(iw *informerWatcher, kind string, eventHandler func(*watch.Event) error, notifier *namespaceNotifier, refresh func(namespaces []string)) {
+	for {
+		select {
+		case <-notifier.channel():
+			refresh(notifier.take())
+		case event := <-iw.ResultChan():
+			if err := eventHandler(&event); err != nil {
+				glog.Errorf("%s watch: %s", kind, err.Error())
+			}
+		case <-iw.newStateChan:
+			glog.Infof("%s watch - newStateChan signal, reporting the current state. resourceVersion: %s", kind, iw.informer.LastSyncResourceVersion())
+			// the state of the watcher is reset here, between its events, so no event is handled against a half reset state
+			wh.resetWatcherState(kind)
+			events := iw.replay()
+			for i := range events {
+				if err := eventHandler(&events[i]); err != nil {
+					glog.Errorf("%s watch: %s", kind, err.Error())
+				}
+			}
+			// let SetFirstReportFlag know the current state is in the report
+			iw.newStateChan <- true
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package watch
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestWatchHandler(objects ...runtime.Object) *WatchHandler {
+	client := fake.NewSimpleClientset(objects...)
+	wh := &WatchHandler{
+		RestAPIClient:          client,
+		informerFactory:        newSharedInformerFactory(client),
+		informerWatchers:       informerWatchers{watchers: make(map[cache.SharedIndexInformer]*informerWatcher), kinds: make(map[string]bool)},
+		stopChan:               make(chan struct{}),
+		pdm:                    make(map[int]*list.List),
+		pods:                   make(map[string]podEntry),
+		cronJobIDs:             make(map[string]int),
+		ownerIDs:               make(map[string]map[int]bool),
+		ndm:                    make(map[int]*list.List),
+		sdm:                    make(map[int]*list.List),
+		secretdm:               newResourceMap(),
+		namespacedm:            newResourceMap(),
+		ingressdm:              newResourceMap(),
+		gatewaydm:              newResourceMap(),
+		httproutedm:            newResourceMap(),
+		networkpolicydm:        newResourceMap(),
+		roledm:                 newResourceMap(),
+		clusterroledm:          newResourceMap(),
+		rolebindingdm:          newResourceMap(),
+		clusterrolebindingdm:   newResourceMap(),
+		serviceaccountdm:       newResourceMap(),
+		configmapdm:            newResourceMap(),
+		resourcedm:             newResourceMap(),
+		pvdm:                   newResourceMap(),
+		pvcdm:                  newResourceMap(),
+		storageclassdm:         newResourceMap(),
+		mutatingwebhookdm:      newResourceMap(),
+		validatingwebhookdm:    newResourceMap(),
+		deploymentdm:           newResourceMap(),
+		statefulsetdm:          newResourceMap(),
+		daemonsetdm:            newResourceMap(),
+		jobdm:                  newResourceMap(),
+		hpadm:                  newResourceMap(),
+		pdbdm:                  newResourceMap(),
+		resourcequotadm:        newResourceMap(),
+		limitrangedm:           newResourceMap(),
+		reportedEvents:         newReportedEvents(),
+		images:                 newImageInventory(),
+		eventRateLimiter:       newEventRateLimiter(&eventsConfig{}),
+		informNewDataChannel:   make(chan int, 1),
+		resyncChannel:          make(chan struct{}, 1),
+		aggregateFirstDataFlag: 1,
+		includeNamespaces:      []string{""},
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme.Scheme, objects...)
+	wh.owners = newOwnerResolver(dynamicClient, newTestRESTMapper(), wh.informerFactory, newDynamicSharedInformerFactory(dynamicClient), wh.stopChan)
+	return wh
+}
+
+// newTestRESTMapper maps the kinds of the pod owners of the tests
+func newTestRESTMapper() meta.ResettableRESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{
+		appsv1.SchemeGroupVersion.WithKind("ReplicaSet"),
+		appsv1.SchemeGroupVersion.WithKind("Deployment"),
+		appsv1.SchemeGroupVersion.WithKind("StatefulSet"),
+		appsv1.SchemeGroupVersion.WithKind("DaemonSet"),
+		batchv1.SchemeGroupVersion.WithKind("Job"),
+		batchv1.SchemeGroupVersion.WithKind("CronJob"),
+	} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	return meta.MultiRESTMapper{mapper}
+}
+
+func TestInformerWatcher(t *testing.T) {
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", ResourceVersion: "1"}}
+	wh := newTestWatchHandler(pod)
+	defer close(wh.stopChan)
+
+	iw := wh.watchInformer(wh.informerFactory.Core().V1().Pods().Informer(), "pod")
+	assert.Equal(t, iw, wh.watchInformer(wh.informerFactory.Core().V1().Pods().Informer(), "pod"), "watcher should be created once")
+	assert.Equal(t, 1, len(wh.informerWatchers.getNewStateChans()))
+
+	select {
+	case event := <-iw.ResultChan():
+		assert.Equal(t, watch.Added, event.Type)
+		assert.Equal(t, "nginx", event.Object.(*core.Pod).Name)
+		// the handlers get their own copy of the cached object
+		event.Object.(*core.Pod).Name = "changed"
+	case <-time.After(5 * time.Second):
+		t.Fatal("initial list was not reported")
+	}
+
+	events := iw.replay()
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, watch.Added, events[0].Type)
+	assert.Equal(t, "nginx", events[0].Object.(*core.Pod).Name)
+}
+
+func TestInformerWatcherForbiddenInformer(t *testing.T) {
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", ResourceVersion: "1"}}
+	wh := newTestWatchHandler(pod)
+	defer close(wh.stopChan)
+	wh.RestAPIClient.(*fake.Clientset).PrependReactor("list", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+	})
+	// an informer of the factory that never lists, like an owner informer of a forbidden resource
+	wh.informerFactory.Core().V1().Secrets().Informer()
+
+	done := make(chan struct{})
+	go func() {
+		wh.watchInformer(wh.informerFactory.Core().V1().Pods().Informer(), "pod")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watcher waited for the forbidden informer")
+	}
+}
+
+func TestFirstReportWithForbiddenWatcher(t *testing.T) {
+	defer func(timeout time.Duration) { watchersSyncTimeout = timeout }(watchersSyncTimeout)
+	watchersSyncTimeout = 100 * time.Millisecond
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", ResourceVersion: "1"}}
+	wh := newTestWatchHandler(pod)
+	defer close(wh.stopChan)
+	wh.RestAPIClient.(*fake.Clientset).PrependReactor("list", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+	})
+	go wh.handleInformerEvents(wh.watchInformer(wh.informerFactory.Core().V1().Pods().Informer(), "pod"), "pod", wh.podEventHandler)
+	go func() {
+		wh.handleInformerEvents(wh.watchInformer(wh.informerFactory.Core().V1().Secrets().Informer(), "secret"), "secret", wh.secretEventHandler)
+	}()
+	assert.Eventually(t, func() bool { return len(wh.informerWatchers.getNewStateChans()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// the forbidden watcher is left out of the first report
+	done := make(chan struct{})
+	go func() {
+		wh.waitForWatchersSync()
+		wh.SetFirstReportFlag(true)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first report waited for the forbidden watcher")
+	}
+	assert.Equal(t, 1, len(wh.informerWatchers.getNewStateChans()))
+	wh.pdmMutex.RLock()
+	defer wh.pdmMutex.RUnlock()
+	assert.Equal(t, 1, len(wh.pods))
+}
+
+func TestIsSameResourceVersion(t *testing.T) {
+	oldPod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", ResourceVersion: "1"}}
+	newPod := oldPod.DeepCopy()
+	assert.True(t, isSameResourceVersion(oldPod, newPod))
+	newPod.ResourceVersion = "2"
+	assert.False(t, isSameResourceVersion(oldPod, newPod))
+	assert.False(t, isSameResourceVersion("not an object", newPod))
+}
+
+func TestInformerWatcherReListDiff(t *testing.T) {
+	iw := &informerWatcher{events: make(chan watch.Event, 3)}
+	oldPod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", ResourceVersion: "1"}}
+
+	// unchanged objects re-delivered by the re-list are not reported
+	iw.OnUpdate(oldPod, oldPod.DeepCopy())
+	assert.Equal(t, 0, len(iw.events))
+
+	newPod := oldPod.DeepCopy()
+	newPod.ResourceVersion = "5"
+	iw.OnUpdate(oldPod, newPod)
+	event := <-iw.events
+	assert.Equal(t, watch.Modified, event.Type)
+
+	// objects missing from the re-list are deleted with their last known state
+	iw.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/nginx", Obj: newPod})
+	event = <-iw.events
+	assert.Equal(t, watch.Deleted, event.Type)
+	assert.Equal(t, "nginx", event.Object.(*core.Pod).Name)
+
+	iw.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/unknown", Obj: "not an object"})
+	assert.Equal(t, 0, len(iw.events))
+}
+
+func TestIsResourceVersionExpired(t *testing.T) {
+	assert.True(t, isResourceVersionExpired(apierrors.NewResourceExpired("too old resource version")))
+	assert.True(t, isResourceVersionExpired(apierrors.NewGone("gone")))
+	assert.False(t, isResourceVersionExpired(io.EOF))
+}
+
+func TestResyncWhileEventsFlow(t *testing.T) {
+	wh := newTestWatchHandler()
+	defer close(wh.stopChan)
+	client := wh.RestAPIClient.(*fake.Clientset)
+	go wh.handleInformerEvents(wh.watchInformer(wh.informerFactory.Core().V1().Secrets().Informer(), "secret"), "secret", wh.secretEventHandler)
+	go wh.handleInformerEvents(wh.watchInformer(wh.informerFactory.Core().V1().Services().Informer(), "service"), "service", wh.serviceEventHandler)
+	go wh.handleInformerEvents(wh.watchInformer(wh.informerFactory.Core().V1().Nodes().Informer(), "node"), "node", wh.nodeEventHandler)
+
+	const count = 50
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < count; i++ {
+			name := fmt.Sprintf("object-%d", i)
+			client.CoreV1().Secrets("default").Create(context.Background(), &core.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}, metav1.CreateOptions{})
+			client.CoreV1().Services("default").Create(context.Background(), &core.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}, metav1.CreateOptions{})
+			client.CoreV1().Nodes().Create(context.Background(), &core.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}, metav1.CreateOptions{})
+		}
+	}()
+	// the state is reset and reported again while the events are handled, the race detector checks the maps
+	for i := 0; i < 20; i++ {
+		wh.SetFirstReportFlag(true)
+		wh.SetFirstReportFlag(false)
+	}
+	<-done
+
+	// no object is lost by the resyncs
+	assert.Eventually(t, func() bool { return wh.secretdm.len() == count }, 5*time.Second, 10*time.Millisecond)
+	wh.SetFirstReportFlag(true)
+	assert.Equal(t, count, wh.secretdm.len())
+}
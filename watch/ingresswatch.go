@@ -0,0 +1,128 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/golang/glog"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// ingressData is the reported ingress, with the services of its rules
+type ingressData struct {
+	*networkingv1.Ingress `json:",inline"`
+	Backends              []ServiceBackend `json:"backends"`
+}
+
+// IngressWatch watch over ingresses
+func (wh *WatchHandler) IngressWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER IngressWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Info("Watching over ingresses starting")
+	ingressWatcher := wh.watchInformer(wh.informerFactory.Networking().V1().Ingresses().Informer(), "ingress")
+	glog.Infof("Watching over ingresses started")
+	wh.handleInformerEventsAndRefresh(ingressWatcher, "ingress", wh.ingressEventHandler, wh.microServiceNotifier("ingress"), wh.refreshIngresses)
+}
+
+func (wh *WatchHandler) ingressEventHandler(event *watch.Event) error {
+	ingress, ok := event.Object.(*networkingv1.Ingress)
+	if !ok {
+		return fmt.Errorf("got unexpected ingress from chan")
+	}
+	if !wh.isNamespaceWatched(ingress.Namespace) {
+		return nil
+	}
+	ingress.ManagedFields = []metav1.ManagedFieldsEntry{}
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		wh.updateIngress(ingressData{Ingress: ingress, Backends: wh.getIngressBackends(ingress)})
+	case watch.Deleted:
+		if id, _, found := wh.ingressdm.lookup("ingress", ingress.Namespace, ingress.Name); found {
+			wh.ingressdm.remove(id)
+			DeleteID(id)
+			glog.Infof("ingress %s removed", ingress.Name)
+			wh.jsonReport.AddToJsonFormat(ingressData{Ingress: ingress, Backends: []ServiceBackend{}}, INGRESSES, DELETED)
+			informNewDataArrive(wh)
+		}
+	}
+	return nil
+}
+
+// updateIngress stores the ingress and reports it when it's new or changed
+func (wh *WatchHandler) updateIngress(data ingressData) {
+	id, stored, found := wh.ingressdm.lookup("ingress", data.Namespace, data.Name)
+	if !found {
+		id = CreateID("ingress", data.Namespace, data.Name)
+		wh.ingressdm.init(id)
+		wh.ingressdm.pushBack(id, data)
+		wh.jsonReport.AddToJsonFormat(data, INGRESSES, CREATED)
+	} else if isIngressChanged(stored.(ingressData), data) {
+		wh.ingressdm.updateFront(id, data)
+		glog.Infof("ingress %s updated", data.Name)
+		wh.jsonReport.AddToJsonFormat(data, INGRESSES, UPDATED)
+	} else {
+		return
+	}
+	informNewDataArrive(wh)
+}
+
+// refreshIngresses resolves the backends of the ingresses in the namespaces again
+func (wh *WatchHandler) refreshIngresses(namespaces []string) {
+	for _, namespace := range namespaces {
+		for _, id := range wh.ingressdm.getIDs() {
+			front := wh.ingressdm.front(id)
+			if front == nil {
+				continue
+			}
+			if data, ok := front.Value.(ingressData); ok && data.Namespace == namespace {
+				wh.updateIngress(ingressData{Ingress: data.Ingress, Backends: wh.getIngressBackends(data.Ingress)})
+			}
+		}
+	}
+}
+
+func isIngressChanged(oldData, newData ingressData) bool {
+	return isObjectMetaChanged(&oldData.ObjectMeta, &newData.ObjectMeta) ||
+		!reflect.DeepEqual(oldData.Spec, newData.Spec) ||
+		!reflect.DeepEqual(oldData.Status, newData.Status) ||
+		!reflect.DeepEqual(oldData.Backends, newData.Backends)
+}
+
+// getIngressBackends returns the services of the default backend and of the rules, each service and port once
+func (wh *WatchHandler) getIngressBackends(ingress *networkingv1.Ingress) []ServiceBackend {
+	services := []*networkingv1.IngressServiceBackend{}
+	if ingress.Spec.DefaultBackend != nil && ingress.Spec.DefaultBackend.Service != nil {
+		services = append(services, ingress.Spec.DefaultBackend.Service)
+	}
+	for i := range ingress.Spec.Rules {
+		if ingress.Spec.Rules[i].HTTP == nil {
+			continue
+		}
+		for j := range ingress.Spec.Rules[i].HTTP.Paths {
+			if service := ingress.Spec.Rules[i].HTTP.Paths[j].Backend.Service; service != nil {
+				services = append(services, service)
+			}
+		}
+	}
+
+	backends := []ServiceBackend{}
+	seen := map[string]bool{}
+	for _, service := range services {
+		port := service.Port.Name
+		if port == "" && service.Port.Number != 0 {
+			port = strconv.Itoa(int(service.Port.Number))
+		}
+		if key := service.Name + ":" + port; !seen[key] {
+			seen[key] = true
+			backends = append(backends, wh.newServiceBackend(ingress.Namespace, service.Name, port))
+		}
+	}
+	return backends
+}
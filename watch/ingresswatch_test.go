@@ -0,0 +1,93 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func newTestMicroService(wh *WatchHandler, id int, namespace, name string, podLabels map[string]string) {
+	wh.addMicroService(MicroServiceData{
+		Pod:       &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: podLabels}},
+		PodSpecId: id,
+	})
+}
+
+// syncServices starts the services informer the backends are resolved with
+func syncServices(wh *WatchHandler) {
+	wh.informerFactory.Core().V1().Services().Informer()
+	wh.informerFactory.Start(wh.stopChan)
+	wh.informerFactory.WaitForCacheSync(wh.stopChan)
+}
+
+func TestIngressEventHandler(t *testing.T) {
+	service := &core.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       core.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	}
+	wh := newTestWatchHandler(service)
+	defer close(wh.stopChan)
+	syncServices(wh)
+	newTestMicroService(wh, 1, "default", "web", map[string]string{"app": "web"})
+	newTestMicroService(wh, 2, "default", "db", map[string]string{"app": "db"})
+	newTestMicroService(wh, 3, "other", "web", map[string]string{"app": "web"})
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", ResourceVersion: "1"},
+		Spec: networkingv1.IngressSpec{
+			DefaultBackend: &networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: "web", Port: networkingv1.ServiceBackendPort{Number: 80}}},
+			Rules: []networkingv1.IngressRule{{IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{
+					{Path: "/", Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: "web", Port: networkingv1.ServiceBackendPort{Number: 80}}}},
+					{Path: "/api", Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: "api", Port: networkingv1.ServiceBackendPort{Name: "http"}}}},
+				},
+			}}}},
+		},
+	}
+	assert.NoError(t, wh.ingressEventHandler(&watch.Event{Type: watch.Added, Object: ingress.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Ingresses.Created))
+	data := wh.jsonReport.Ingresses.Created[0].(ingressData)
+	assert.Equal(t, []ServiceBackend{
+		{ServiceName: "web", Namespace: "default", Port: "80", PodSpecIds: []int{1}},
+		{ServiceName: "api", Namespace: "default", Port: "http", PodSpecIds: []int{}},
+	}, data.Backends)
+
+	// the same ingress is not an update
+	assert.NoError(t, wh.ingressEventHandler(&watch.Event{Type: watch.Modified, Object: ingress.DeepCopy()}))
+	assert.Nil(t, wh.jsonReport.Ingresses.Updated)
+
+	// a new microservice behind the service updates the backends
+	newTestMicroService(wh, 4, "default", "web-canary", map[string]string{"app": "web", "track": "canary"})
+	wh.refreshIngresses([]string{"other"})
+	assert.Nil(t, wh.jsonReport.Ingresses.Updated)
+	wh.refreshIngresses([]string{"default"})
+	assert.Equal(t, 1, len(wh.jsonReport.Ingresses.Updated))
+	assert.Equal(t, []int{1, 4}, wh.jsonReport.Ingresses.Updated[0].(ingressData).Backends[0].PodSpecIds)
+
+	assert.NoError(t, wh.ingressEventHandler(&watch.Event{Type: watch.Deleted, Object: ingress.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Ingresses.Deleted))
+	assert.Equal(t, 0, wh.ingressdm.len())
+}
+
+func TestMicroServiceNotifier(t *testing.T) {
+	wh := newTestWatchHandler()
+	notifier := wh.microServiceNotifier("ingress")
+	assert.Equal(t, notifier, wh.microServiceNotifier("ingress"), "notifier should be created once")
+
+	wh.notifyMicroServiceChanged("default")
+	wh.notifyMicroServiceChanged("default")
+	select {
+	case <-notifier.channel():
+	default:
+		t.Fatal("notifier was not signaled")
+	}
+	assert.Equal(t, []string{"default"}, notifier.take())
+	assert.Empty(t, notifier.take())
+
+	var none *namespaceNotifier
+	assert.Nil(t, none.channel())
+}
@@ -1,7 +1,7 @@
 package watch
 
 import (
-	"encoding/json"
+	"sync"
 
 	"github.com/golang/glog"
 	"k8s.io/apimachinery/pkg/version"
@@ -11,12 +11,38 @@ type JsonType int
 type StateType int
 
 const (
-	NODE          JsonType = 1
-	SERVICES      JsonType = 2
-	MICROSERVICES JsonType = 3
-	PODS          JsonType = 4
-	SECRETS       JsonType = 5
-	NAMESPACES    JsonType = 6
+	NODE                     JsonType = 1
+	SERVICES                 JsonType = 2
+	MICROSERVICES            JsonType = 3
+	PODS                     JsonType = 4
+	SECRETS                  JsonType = 5
+	NAMESPACES               JsonType = 6
+	INGRESSES                JsonType = 7
+	GATEWAYS                 JsonType = 8
+	HTTPROUTES               JsonType = 9
+	NETWORKPOLICIES          JsonType = 10
+	ROLES                    JsonType = 11
+	CLUSTERROLES             JsonType = 12
+	ROLEBINDINGS             JsonType = 13
+	CLUSTERROLEBINDINGS      JsonType = 14
+	SERVICEACCOUNTS          JsonType = 15
+	CONFIGMAPS               JsonType = 16
+	RESOURCES                JsonType = 17
+	PERSISTENTVOLUMES        JsonType = 18
+	PERSISTENTVOLUMECLAIMS   JsonType = 19
+	STORAGECLASSES           JsonType = 20
+	EVENTS                   JsonType = 21
+	MUTATINGWEBHOOKS         JsonType = 22
+	VALIDATINGWEBHOOKS       JsonType = 23
+	DEPLOYMENTS              JsonType = 24
+	STATEFULSETS             JsonType = 25
+	DAEMONSETS               JsonType = 26
+	JOBS                     JsonType = 27
+	HORIZONTALPODAUTOSCALERS JsonType = 28
+	PODDISRUPTIONBUDGETS     JsonType = 29
+	RESOURCEQUOTAS           JsonType = 30
+	LIMITRANGES              JsonType = 31
+	IMAGES                   JsonType = 32
 )
 
 const (
@@ -32,15 +58,126 @@ type ObjectData struct {
 }
 
 type jsonFormat struct {
-	FirstReport             bool          `json:"firstReport"`
-	ClusterAPIServerVersion *version.Info `json:"clusterAPIServerVersion,omitempty"`
-	CloudVendor             string        `json:"cloudVendor,omitempty"`
-	Nodes                   *ObjectData   `json:"node,omitempty"`
-	Services                *ObjectData   `json:"service,omitempty"`
-	MicroServices           *ObjectData   `json:"microservice,omitempty"`
-	Pods                    *ObjectData   `json:"pod,omitempty"`
-	Secret                  *ObjectData   `json:"secret,omitempty"`
-	Namespace               *ObjectData   `json:"namespace,omitempty"`
+	// SessionID and SequenceNumber let the server ack the reports and detect the missing ones
+	SessionID      string `json:"sessionID"`
+	SequenceNumber uint64 `json:"sequenceNumber"`
+	// ReportID, PartNum and PartsCount are set on the chunks of a report too big to be sent at once
+	ReportID                 string        `json:"reportID,omitempty"`
+	PartNum                  int           `json:"partNum,omitempty"`
+	PartsCount               int           `json:"partsCount,omitempty"`
+	FirstReport              bool          `json:"firstReport"`
+	ClusterAPIServerVersion  *version.Info `json:"clusterAPIServerVersion,omitempty"`
+	CloudVendor              string        `json:"cloudVendor,omitempty"`
+	Nodes                    *ObjectData   `json:"node,omitempty"`
+	Services                 *ObjectData   `json:"service,omitempty"`
+	MicroServices            *ObjectData   `json:"microservice,omitempty"`
+	Pods                     *ObjectData   `json:"pod,omitempty"`
+	Secret                   *ObjectData   `json:"secret,omitempty"`
+	Namespace                *ObjectData   `json:"namespace,omitempty"`
+	Ingresses                *ObjectData   `json:"ingress,omitempty"`
+	Gateways                 *ObjectData   `json:"gateway,omitempty"`
+	HTTPRoutes               *ObjectData   `json:"httpRoute,omitempty"`
+	NetworkPolicies          *ObjectData   `json:"networkPolicy,omitempty"`
+	Roles                    *ObjectData   `json:"role,omitempty"`
+	ClusterRoles             *ObjectData   `json:"clusterRole,omitempty"`
+	RoleBindings             *ObjectData   `json:"roleBinding,omitempty"`
+	ClusterRoleBindings      *ObjectData   `json:"clusterRoleBinding,omitempty"`
+	ServiceAccounts          *ObjectData   `json:"serviceAccount,omitempty"`
+	ConfigMaps               *ObjectData   `json:"configMap,omitempty"`
+	PersistentVolumes        *ObjectData   `json:"persistentVolume,omitempty"`
+	PersistentVolumeClaims   *ObjectData   `json:"persistentVolumeClaim,omitempty"`
+	StorageClasses           *ObjectData   `json:"storageClass,omitempty"`
+	Events                   *ObjectData   `json:"events,omitempty"`
+	MutatingWebhooks         *ObjectData   `json:"mutatingWebhookConfiguration,omitempty"`
+	ValidatingWebhooks       *ObjectData   `json:"validatingWebhookConfiguration,omitempty"`
+	Deployments              *ObjectData   `json:"deployment,omitempty"`
+	StatefulSets             *ObjectData   `json:"statefulSet,omitempty"`
+	DaemonSets               *ObjectData   `json:"daemonSet,omitempty"`
+	Jobs                     *ObjectData   `json:"job,omitempty"`
+	HorizontalPodAutoscalers *ObjectData   `json:"horizontalPodAutoscaler,omitempty"`
+	PodDisruptionBudgets     *ObjectData   `json:"podDisruptionBudget,omitempty"`
+	ResourceQuotas           *ObjectData   `json:"resourceQuota,omitempty"`
+	LimitRanges              *ObjectData   `json:"limitRange,omitempty"`
+	Images                   *ObjectData   `json:"images,omitempty"`
+	// Resources are the objects of the resources watched by the config, by group/version/resource
+	Resources map[string]*ObjectData `json:"resources,omitempty"`
+	// deltas is set when updates are reported as deltas
+	deltas *reportDeltas
+	// mutex guards the objects, added by the watchers while the sender reports them
+	mutex sync.Mutex
+}
+
+// reportKinds are the kinds of objects in the report, with their field in objectData, in the order they are split
+// into chunks. The objects of the resources of the config are apart, in Resources
+var reportKinds = []JsonType{NODE, SERVICES, MICROSERVICES, PODS, SECRETS, NAMESPACES, INGRESSES, GATEWAYS, HTTPROUTES, NETWORKPOLICIES, ROLES, CLUSTERROLES, ROLEBINDINGS, CLUSTERROLEBINDINGS, SERVICEACCOUNTS, CONFIGMAPS, PERSISTENTVOLUMES, PERSISTENTVOLUMECLAIMS, STORAGECLASSES, EVENTS, MUTATINGWEBHOOKS, VALIDATINGWEBHOOKS, DEPLOYMENTS, STATEFULSETS, DAEMONSETS, JOBS, HORIZONTALPODAUTOSCALERS, PODDISRUPTIONBUDGETS, RESOURCEQUOTAS, LIMITRANGES, IMAGES}
+
+// objectData returns the field holding the objects of the kind
+func (jsonReport *jsonFormat) objectData(jtype JsonType) **ObjectData {
+	switch jtype {
+	case NODE:
+		return &jsonReport.Nodes
+	case SERVICES:
+		return &jsonReport.Services
+	case MICROSERVICES:
+		return &jsonReport.MicroServices
+	case PODS:
+		return &jsonReport.Pods
+	case SECRETS:
+		return &jsonReport.Secret
+	case NAMESPACES:
+		return &jsonReport.Namespace
+	case INGRESSES:
+		return &jsonReport.Ingresses
+	case GATEWAYS:
+		return &jsonReport.Gateways
+	case HTTPROUTES:
+		return &jsonReport.HTTPRoutes
+	case NETWORKPOLICIES:
+		return &jsonReport.NetworkPolicies
+	case ROLES:
+		return &jsonReport.Roles
+	case CLUSTERROLES:
+		return &jsonReport.ClusterRoles
+	case ROLEBINDINGS:
+		return &jsonReport.RoleBindings
+	case CLUSTERROLEBINDINGS:
+		return &jsonReport.ClusterRoleBindings
+	case SERVICEACCOUNTS:
+		return &jsonReport.ServiceAccounts
+	case CONFIGMAPS:
+		return &jsonReport.ConfigMaps
+	case PERSISTENTVOLUMES:
+		return &jsonReport.PersistentVolumes
+	case PERSISTENTVOLUMECLAIMS:
+		return &jsonReport.PersistentVolumeClaims
+	case STORAGECLASSES:
+		return &jsonReport.StorageClasses
+	case EVENTS:
+		return &jsonReport.Events
+	case MUTATINGWEBHOOKS:
+		return &jsonReport.MutatingWebhooks
+	case VALIDATINGWEBHOOKS:
+		return &jsonReport.ValidatingWebhooks
+	case DEPLOYMENTS:
+		return &jsonReport.Deployments
+	case STATEFULSETS:
+		return &jsonReport.StatefulSets
+	case DAEMONSETS:
+		return &jsonReport.DaemonSets
+	case JOBS:
+		return &jsonReport.Jobs
+	case HORIZONTALPODAUTOSCALERS:
+		return &jsonReport.HorizontalPodAutoscalers
+	case PODDISRUPTIONBUDGETS:
+		return &jsonReport.PodDisruptionBudgets
+	case RESOURCEQUOTAS:
+		return &jsonReport.ResourceQuotas
+	case LIMITRANGES:
+		return &jsonReport.LimitRanges
+	case IMAGES:
+		return &jsonReport.Images
+	}
+	return nil
 }
 
 func (obj *ObjectData) AddToJsonFormatByState(NewData interface{}, stype StateType) {
@@ -54,6 +191,21 @@ func (obj *ObjectData) AddToJsonFormatByState(NewData interface{}, stype StateTy
 	}
 }
 
+func (obj *ObjectData) byState(stype StateType) []interface{} {
+	if obj == nil {
+		return nil
+	}
+	switch stype {
+	case CREATED:
+		return obj.Created
+	case DELETED:
+		return obj.Deleted
+	case UPDATED:
+		return obj.Updated
+	}
+	return nil
+}
+
 func (obj *ObjectData) Len() int {
 	sum := 0
 	if obj == nil {
@@ -72,87 +224,92 @@ func (obj *ObjectData) Len() int {
 }
 
 func (jsonReport *jsonFormat) AddToJsonFormat(data interface{}, jtype JsonType, stype StateType) {
-	switch jtype {
-	case NODE:
-		if jsonReport.Nodes == nil {
-			jsonReport.Nodes = &ObjectData{}
-		}
-		jsonReport.Nodes.AddToJsonFormatByState(data, stype)
-	case SERVICES:
-		if jsonReport.Services == nil {
-			jsonReport.Services = &ObjectData{}
-		}
-		jsonReport.Services.AddToJsonFormatByState(data, stype)
-	case MICROSERVICES:
-		if jsonReport.MicroServices == nil {
-			jsonReport.MicroServices = &ObjectData{}
-		}
-		jsonReport.MicroServices.AddToJsonFormatByState(data, stype)
-	case PODS:
-		if jsonReport.Pods == nil {
-			jsonReport.Pods = &ObjectData{}
-		}
-		jsonReport.Pods.AddToJsonFormatByState(data, stype)
-	case SECRETS:
-		if jsonReport.Secret == nil {
-			jsonReport.Secret = &ObjectData{}
-		}
-		jsonReport.Secret.AddToJsonFormatByState(data, stype)
-	case NAMESPACES:
-		if jsonReport.Namespace == nil {
-			jsonReport.Namespace = &ObjectData{}
-		}
-		jsonReport.Namespace.AddToJsonFormatByState(data, stype)
+	objectData := jsonReport.objectData(jtype)
+	if objectData == nil {
+		glog.Errorf("AddToJsonFormat: unknown kind %d", jtype)
+		return
+	}
+	data = jsonReport.deltas.toReport(data, jtype, stype)
+	jsonReport.mutex.Lock()
+	defer jsonReport.mutex.Unlock()
+	if *objectData == nil {
+		*objectData = &ObjectData{}
 	}
+	(*objectData).AddToJsonFormatByState(data, stype)
+}
 
+// AddResourceToJsonFormat adds an object of a resource watched by the config, resource is its group/version/resource
+func (jsonReport *jsonFormat) AddResourceToJsonFormat(resource string, data interface{}, stype StateType) {
+	data = jsonReport.deltas.toReport(data, RESOURCES, stype)
+	jsonReport.mutex.Lock()
+	defer jsonReport.mutex.Unlock()
+	if jsonReport.Resources == nil {
+		jsonReport.Resources = make(map[string]*ObjectData)
+	}
+	if jsonReport.Resources[resource] == nil {
+		jsonReport.Resources[resource] = &ObjectData{}
+	}
+	jsonReport.Resources[resource].AddToJsonFormatByState(data, stype)
 }
 
-func prepareDataToSend(wh *WatchHandler) []byte {
-	jsonReport := wh.jsonReport
-	if *wh.getAggregateFirstDataFlag() {
+// prepareDataToSend returns the report, or its chunks when it's bigger than the maximum report size
+func prepareDataToSend(wh *WatchHandler) [][]byte {
+	jsonReport := &wh.jsonReport
+	jsonReport.mutex.Lock()
+	defer jsonReport.mutex.Unlock()
+	if wh.getAggregateFirstDataFlag() {
 		jsonReport.ClusterAPIServerVersion = wh.clusterAPIServerVersion
 		jsonReport.CloudVendor = wh.cloudVendor
 	} else {
 		jsonReport.ClusterAPIServerVersion = nil
 		jsonReport.CloudVendor = ""
 	}
-	if jsonReport.Nodes.Len() == 0 {
-		jsonReport.Nodes = nil
-	}
-	if jsonReport.Services.Len() == 0 {
-		jsonReport.Services = nil
-	}
-	if jsonReport.Secret.Len() == 0 {
-		jsonReport.Secret = nil
-	}
-	if jsonReport.Pods.Len() == 0 {
-		jsonReport.Pods = nil
-	}
-	if jsonReport.MicroServices.Len() == 0 {
-		jsonReport.MicroServices = nil
+	for _, jtype := range reportKinds {
+		if objectData := jsonReport.objectData(jtype); (*objectData).Len() == 0 {
+			*objectData = nil
+		}
 	}
-	if jsonReport.Namespace.Len() == 0 {
-		jsonReport.Namespace = nil
+	for resource := range jsonReport.Resources {
+		if jsonReport.Resources[resource].Len() == 0 {
+			delete(jsonReport.Resources, resource)
+		}
 	}
-	jsonReportToSend, err := json.Marshal(jsonReport)
+	reports, err := jsonReport.marshalReports(wh.reportSequenceNumber, wh.maxReportSize)
 	if nil != err {
 		glog.Errorf("In PrepareDataToSend json.Marshal %v", err)
 		return nil
 	}
+	wh.reportSequenceNumber += uint64(len(reports))
 	deleteJsonData(wh)
-	wh.aggregateFirstDataFlag = false
-	return jsonReportToSend
+	wh.setAggregateFirstDataFlag(false)
+	return reports
 }
 
-//WaitTillNewDataArrived -
+// WaitTillNewDataArrived returns true when new data arrived, and false when the server requested a resync
 func WaitTillNewDataArrived(wh *WatchHandler) bool {
-	<-wh.informNewDataChannel
-	return true
+	select {
+	case <-wh.informNewDataChannel:
+		return true
+	case <-wh.resyncChannel:
+		return false
+	}
 }
 
+// RequestResync makes the sender report the full cluster state again
+func (wh *WatchHandler) RequestResync() {
+	select {
+	case wh.resyncChannel <- struct{}{}:
+	default:
+	}
+}
+
+// informNewDataArrive wakes up the sender, data arriving while the sender is busy is collected by the next report
 func informNewDataArrive(wh *WatchHandler) {
-	if !wh.aggregateFirstDataFlag {
-		wh.informNewDataChannel <- 1
+	if !wh.getAggregateFirstDataFlag() {
+		select {
+		case wh.informNewDataChannel <- 1:
+		default:
+		}
 	}
 }
 
@@ -160,42 +317,15 @@ func deleteObjectData(l *[]interface{}) {
 	*l = []interface{}{}
 }
 
+// deleteJsonData removes the reported objects, it's called with the mutex of the report held
 func deleteJsonData(wh *WatchHandler) {
 	jsonReport := &wh.jsonReport
-
-	if jsonReport.Nodes != nil {
-		deleteObjectData(&jsonReport.Nodes.Created)
-		deleteObjectData(&jsonReport.Nodes.Deleted)
-		deleteObjectData(&jsonReport.Nodes.Updated)
-	}
-
-	if jsonReport.Pods != nil {
-		deleteObjectData(&jsonReport.Pods.Created)
-		deleteObjectData(&jsonReport.Pods.Deleted)
-		deleteObjectData(&jsonReport.Pods.Updated)
-	}
-
-	if jsonReport.Services != nil {
-		deleteObjectData(&jsonReport.Services.Created)
-		deleteObjectData(&jsonReport.Services.Deleted)
-		deleteObjectData(&jsonReport.Services.Updated)
-	}
-
-	if jsonReport.MicroServices != nil {
-		deleteObjectData(&jsonReport.MicroServices.Created)
-		deleteObjectData(&jsonReport.MicroServices.Deleted)
-		deleteObjectData(&jsonReport.MicroServices.Updated)
-	}
-
-	if jsonReport.Secret != nil {
-		deleteObjectData(&jsonReport.Secret.Created)
-		deleteObjectData(&jsonReport.Secret.Deleted)
-		deleteObjectData(&jsonReport.Secret.Updated)
-	}
-
-	if jsonReport.Namespace != nil {
-		deleteObjectData(&jsonReport.Namespace.Created)
-		deleteObjectData(&jsonReport.Namespace.Deleted)
-		deleteObjectData(&jsonReport.Namespace.Updated)
+	for _, jtype := range reportKinds {
+		if objectData := *jsonReport.objectData(jtype); objectData != nil {
+			deleteObjectData(&objectData.Created)
+			deleteObjectData(&objectData.Deleted)
+			deleteObjectData(&objectData.Updated)
+		}
 	}
+	jsonReport.Resources = nil
 }
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 var (
@@ -24,5 +26,35 @@ func TestJson(test *testing.T) {
 	if !bytes.Equal(wh.jsonReport.Pods.Updated[0].([]byte), []byte("12343589thfgnvdfklbnvklbnmdfk'lbgfbhs")) {
 		test.Errorf("PODS")
 	}
-	fmt.Printf("json %s\n", string(prepareDataToSend(&wh)))
+	for _, report := range prepareDataToSend(&wh) {
+		fmt.Printf("json %s\n", string(report))
+	}
+}
+
+func TestReportKinds(t *testing.T) {
+	report := &jsonFormat{}
+	fields := map[**ObjectData]JsonType{}
+	for jtype := NODE; jtype <= IMAGES; jtype++ {
+		if jtype == RESOURCES {
+			continue
+		}
+		assert.Contains(t, reportKinds, jtype)
+		objectData := report.objectData(jtype)
+		if assert.NotNil(t, objectData, "kind %d has no field", jtype) {
+			_, found := fields[objectData]
+			assert.False(t, found, "kind %d has the field of another kind", jtype)
+			fields[objectData] = jtype
+		}
+	}
+	assert.Equal(t, len(fields), len(reportKinds))
+
+	wh := newTestWatchHandler()
+	for _, jtype := range reportKinds {
+		wh.jsonReport.AddToJsonFormat(fmt.Sprintf("object %d", jtype), jtype, CREATED)
+		assert.Equal(t, 1, (*wh.jsonReport.objectData(jtype)).Len())
+	}
+	assert.Equal(t, 1, len(prepareDataToSend(wh)))
+	for _, jtype := range reportKinds {
+		assert.Equal(t, 0, (*wh.jsonReport.objectData(jtype)).Len(), "kind %d is not cleared", jtype)
+	}
 }
@@ -0,0 +1,73 @@
+package watch
+
+import "sync"
+
+// namespaceNotifier collects the namespaces where microservices or services were created, updated or deleted, for a watcher
+// to refresh the objects it links to them
+type namespaceNotifier struct {
+	namespaces map[string]bool
+	mutex      sync.Mutex
+	notify     chan struct{}
+}
+
+func newNamespaceNotifier() *namespaceNotifier {
+	return &namespaceNotifier{
+		namespaces: make(map[string]bool),
+		notify:     make(chan struct{}, 1),
+	}
+}
+
+func (notifier *namespaceNotifier) add(namespace string) {
+	notifier.mutex.Lock()
+	notifier.namespaces[namespace] = true
+	notifier.mutex.Unlock()
+	select {
+	case notifier.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the collected namespaces and clears them
+func (notifier *namespaceNotifier) take() []string {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	namespaces := make([]string, 0, len(notifier.namespaces))
+	for namespace := range notifier.namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	notifier.namespaces = make(map[string]bool)
+	return namespaces
+}
+
+// channel is signaled when namespaces were added, a nil notifier is never signaled
+func (notifier *namespaceNotifier) channel() <-chan struct{} {
+	if notifier == nil {
+		return nil
+	}
+	return notifier.notify
+}
+
+// microServiceNotifier returns the notifier of the watcher kind, created once so a restarted watcher keeps it
+func (wh *WatchHandler) microServiceNotifier(kind string) *namespaceNotifier {
+	wh.microServiceNotifiersMutex.Lock()
+	defer wh.microServiceNotifiersMutex.Unlock()
+	if wh.microServiceNotifiers == nil {
+		wh.microServiceNotifiers = make(map[string]*namespaceNotifier)
+	}
+	notifier, ok := wh.microServiceNotifiers[kind]
+	if !ok {
+		notifier = newNamespaceNotifier()
+		wh.microServiceNotifiers[kind] = notifier
+	}
+	return notifier
+}
+
+// notifyMicroServiceChanged lets the watchers linking their objects to the microservices know the microservices of
+// the namespace changed
+func (wh *WatchHandler) notifyMicroServiceChanged(namespace string) {
+	wh.microServiceNotifiersMutex.Lock()
+	defer wh.microServiceNotifiersMutex.Unlock()
+	for _, notifier := range wh.microServiceNotifiers {
+		notifier.add(namespace)
+	}
+}
@@ -2,9 +2,8 @@ package watch
 
 import (
 	"fmt"
+	"reflect"
 	"runtime/debug"
-	"strings"
-	"time"
 
 	"github.com/golang/glog"
 	corev1 "k8s.io/api/core/v1"
@@ -12,78 +11,39 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 )
 
-// namespaceWatch watch over namespaces
+// NamespaceWatch watch over namespaces
 func (wh *WatchHandler) NamespaceWatch() {
 	defer func() {
 		if err := recover(); err != nil {
 			glog.Errorf("RECOVER NamespaceWatch. error: %v\n %s", err, string(debug.Stack()))
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-WatchLoop:
-	for {
-		glog.Infof("Watching over namespaces starting")
-		namespacesWatcher, err := wh.RestAPIClient.CoreV1().Namespaces().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			glog.Errorf("Failed watching over namespaces. %s", err.Error())
-			time.Sleep(3 * time.Second)
-			continue
-		}
-		namespacesChan := namespacesWatcher.ResultChan()
-		glog.Infof("Watching over namespaces started")
-	ChanLoop:
-		for {
-			var event watch.Event
-			select {
-			case event = <-namespacesChan:
-			case <-newStateChan:
-				namespacesWatcher.Stop()
-				glog.Errorf("namespaces watch - newStateChan signal")
-				continue WatchLoop
-			}
-
-			if event.Type == watch.Error {
-				glog.Errorf("namespaces watch chan loop error: %v", event.Object)
-				namespacesWatcher.Stop()
-				break ChanLoop
-			}
-			if err := wh.NamespaceEventHandler(&event, lastWatchEventCreationTime); err != nil {
-				break ChanLoop
-			}
-		}
-		lastWatchEventCreationTime = time.Now()
-		glog.Infof("Watching over namespaces ended - timeout")
-	}
+	glog.Infof("Watching over namespaces starting")
+	namespacesWatcher := wh.watchInformer(wh.informerFactory.Core().V1().Namespaces().Informer(), "namespace")
+	glog.Infof("Watching over namespaces started")
+	wh.handleInformerEvents(namespacesWatcher, "namespace", wh.NamespaceEventHandler)
 }
-func (wh *WatchHandler) NamespaceEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
+func (wh *WatchHandler) NamespaceEventHandler(event *watch.Event) error {
 	if namespace, ok := event.Object.(*corev1.Namespace); ok {
 		namespace.ManagedFields = []metav1.ManagedFieldsEntry{}
 		switch event.Type {
-		case "ADDED":
-			if namespace.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
-				glog.Infof("namespace %s already exist, will not be reported", namespace.ObjectMeta.Name)
-				return nil
+		case watch.Added, watch.Modified:
+			found, changed := wh.UpdateNamespace(namespace)
+			if !found {
+				id := CreateID("namespace", namespace.Name)
+				wh.namespacedm.init(id)
+				wh.namespacedm.pushBack(id, namespace)
+				wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, CREATED)
+				informNewDataArrive(wh)
+			} else if changed {
+				wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, UPDATED)
+				informNewDataArrive(wh)
+			}
+		case watch.Deleted:
+			if name := wh.RemoveNamespace(namespace); name != "" {
+				wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, DELETED)
+				informNewDataArrive(wh)
 			}
-			id := CreateID()
-			wh.namespacedm.init(id)
-			wh.namespacedm.pushBack(id, namespace)
-			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, CREATED)
-		case "MODIFY":
-			wh.UpdateNamespace(namespace)
-			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, UPDATED)
-		case "DELETED":
-			wh.RemoveNamespace(namespace)
-			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, DELETED)
-		case "BOOKMARK": //only the resource version is changed but it's the same object
-			return nil
-		case "ERROR":
-			glog.Errorf("while watching over namespaces we got an error: %v", event)
-			return fmt.Errorf("while watching over namespaces we got an error")
 		}
 	} else {
 		return fmt.Errorf("got unexpected namespace from chan")
@@ -91,46 +51,38 @@ func (wh *WatchHandler) NamespaceEventHandler(event *watch.Event, lastWatchEvent
 	return nil
 }
 
-// UpdateNamespace update websocket when namespace is updated
-func (wh *WatchHandler) UpdateNamespace(namespace *corev1.Namespace) {
-	for _, id := range wh.namespacedm.getIDs() {
-		front := wh.namespacedm.front(id)
-		if front == nil || front.Value == nil {
-			continue
-		}
-		namespaceData, ok := front.Value.(*corev1.Namespace)
-		if !ok {
-			continue
-		}
-		if strings.Compare(namespaceData.Name, namespaceData.Name) != 0 {
-			continue
-		}
-
+// UpdateNamespace updates the stored namespace. Returns whether the namespace is known and whether it changed since it
+// was last reported
+func (wh *WatchHandler) UpdateNamespace(namespace *corev1.Namespace) (bool, bool) {
+	id, stored, found := wh.namespacedm.lookup("namespace", namespace.Name)
+	if !found {
+		return false, false
+	}
+	namespaceData, ok := stored.(*corev1.Namespace)
+	if !ok {
+		return false, false
+	}
+	if !isNamespaceChanged(namespaceData, namespace) {
+		return true, false
 	}
+	wh.namespacedm.updateFront(id, namespace)
+	glog.Infof("namespace %s updated", namespace.Name)
+	return true, true
+}
+
+func isNamespaceChanged(oldNamespace, newNamespace *corev1.Namespace) bool {
+	return isObjectMetaChanged(&oldNamespace.ObjectMeta, &newNamespace.ObjectMeta) ||
+		!reflect.DeepEqual(oldNamespace.Status, newNamespace.Status)
 }
 
 // RemoveNamespace update websocket when namespace is removed
 func (wh *WatchHandler) RemoveNamespace(namespace *corev1.Namespace) string {
-	ids := wh.namespacedm.getIDs()
-	for _, id := range ids {
-		front := wh.namespacedm.front(id)
-		for front != nil && front.Value == nil {
-			front = front.Next()
-		}
-		if front == nil {
-			continue
-		}
-		namespaceData, ok := front.Value.(*corev1.Namespace)
-		if !ok {
-			continue
-		}
-
-		if strings.Compare(namespaceData.ObjectMeta.Name, namespace.Name) == 0 {
-			name := namespaceData.ObjectMeta.Name
-			wh.namespacedm.remove(id)
-			glog.Infof("namespace %s removed", name)
-			return name
-		}
+	id, _, found := wh.namespacedm.lookup("namespace", namespace.Name)
+	if !found {
+		return ""
 	}
-	return ""
+	wh.namespacedm.remove(id)
+	DeleteID(id)
+	glog.Infof("namespace %s removed", namespace.Name)
+	return namespace.Name
 }
@@ -0,0 +1,31 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestNamespaceEventHandler(t *testing.T) {
+	wh := newTestWatchHandler()
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", ResourceVersion: "1"}}
+	assert.NoError(t, wh.NamespaceEventHandler(&watch.Event{Type: watch.Added, Object: namespace.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Namespace.Created))
+
+	labeled := namespace.DeepCopy()
+	labeled.ResourceVersion = "2"
+	labeled.Labels = map[string]string{"team": "a"}
+	assert.NoError(t, wh.NamespaceEventHandler(&watch.Event{Type: watch.Modified, Object: labeled}))
+	assert.Equal(t, 1, len(wh.jsonReport.Namespace.Updated))
+
+	found, changed := wh.UpdateNamespace(labeled.DeepCopy())
+	assert.True(t, found)
+	assert.False(t, changed, "the labels were stored with the update")
+
+	assert.NoError(t, wh.NamespaceEventHandler(&watch.Event{Type: watch.Deleted, Object: labeled.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Namespace.Deleted))
+	assert.Equal(t, 0, wh.namespacedm.len())
+}
@@ -0,0 +1,105 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// NetworkPolicySummary tells which network policies select a microservice, and which of its traffic they isolate.
+// A microservice no policy selects has no policies and is not isolated
+type NetworkPolicySummary struct {
+	Policies        []string `json:"policies"`
+	IngressIsolated bool     `json:"ingressIsolated"`
+	EgressIsolated  bool     `json:"egressIsolated"`
+}
+
+// NetworkPolicyWatch watch over network policies
+func (wh *WatchHandler) NetworkPolicyWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER NetworkPolicyWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over network policies starting")
+	networkPolicyWatcher := wh.watchInformer(wh.informerFactory.Networking().V1().NetworkPolicies().Informer(), "networkpolicy")
+	glog.Infof("Watching over network policies started")
+	wh.handleInformerEvents(networkPolicyWatcher, "networkpolicy", wh.networkPolicyEventHandler)
+}
+
+func (wh *WatchHandler) networkPolicyEventHandler(event *watch.Event) error {
+	policy, ok := event.Object.(*networkingv1.NetworkPolicy)
+	if !ok {
+		return fmt.Errorf("got unexpected network policy from chan")
+	}
+	if wh.reportObjectEvent("network policy", event.Type, policy, wh.networkpolicydm, NETWORKPOLICIES, isNetworkPolicyChanged) {
+		wh.updateNetworkPolicySummaries(policy.Namespace)
+	}
+	return nil
+}
+
+// updateNetworkPolicySummaries updates the network policy summary of the microservices of the namespace
+func (wh *WatchHandler) updateNetworkPolicySummaries(namespace string) {
+	wh.updateMicroServices(namespace, func(msd *MicroServiceData) bool {
+		summary := wh.getNetworkPolicySummary(msd.Pod)
+		if reflect.DeepEqual(summary, msd.NetworkPolicies) {
+			return false
+		}
+		msd.NetworkPolicies = summary
+		return true
+	})
+}
+
+// getNetworkPolicySummary returns the network policies selecting the pod, from the informer cache
+func (wh *WatchHandler) getNetworkPolicySummary(pod *core.Pod) *NetworkPolicySummary {
+	summary := &NetworkPolicySummary{Policies: []string{}}
+	policies, err := wh.informerFactory.Networking().V1().NetworkPolicies().Lister().NetworkPolicies(pod.Namespace).List(labels.Everything())
+	if err != nil {
+		glog.Errorf("failed to list network policies of namespace %s: %s", pod.Namespace, err.Error())
+		return summary
+	}
+	for _, policy := range policies {
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+		if err != nil || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		summary.Policies = append(summary.Policies, policy.Name)
+		ingress, egress := getNetworkPolicyTypes(policy)
+		summary.IngressIsolated = summary.IngressIsolated || ingress
+		summary.EgressIsolated = summary.EgressIsolated || egress
+	}
+	sort.Strings(summary.Policies)
+	return summary
+}
+
+// getNetworkPolicyTypes returns whether the policy isolates the ingress and the egress of the pods it selects.
+// Without policyTypes a policy isolates the ingress, and the egress too when it has egress rules
+func getNetworkPolicyTypes(policy *networkingv1.NetworkPolicy) (bool, bool) {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return true, len(policy.Spec.Egress) > 0
+	}
+	ingress, egress := false, false
+	for _, policyType := range policy.Spec.PolicyTypes {
+		switch policyType {
+		case networkingv1.PolicyTypeIngress:
+			ingress = true
+		case networkingv1.PolicyTypeEgress:
+			egress = true
+		}
+	}
+	return ingress, egress
+}
+
+func isNetworkPolicyChanged(oldObj, newObj watchedObject) bool {
+	oldPolicy, newPolicy := oldObj.(*networkingv1.NetworkPolicy), newObj.(*networkingv1.NetworkPolicy)
+	return isObjectMetaChanged(&oldPolicy.ObjectMeta, &newPolicy.ObjectMeta) ||
+		!reflect.DeepEqual(oldPolicy.Spec, newPolicy.Spec)
+}
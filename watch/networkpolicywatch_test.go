@@ -0,0 +1,91 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestGetNetworkPolicyTypes(t *testing.T) {
+	policy := &networkingv1.NetworkPolicy{}
+	ingress, egress := getNetworkPolicyTypes(policy)
+	assert.True(t, ingress)
+	assert.False(t, egress)
+
+	policy.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{}}
+	ingress, egress = getNetworkPolicyTypes(policy)
+	assert.True(t, ingress)
+	assert.True(t, egress)
+
+	policy.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+	ingress, egress = getNetworkPolicyTypes(policy)
+	assert.False(t, ingress)
+	assert.True(t, egress)
+}
+
+func TestNetworkPolicyEventHandler(t *testing.T) {
+	denyAll := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "deny-ingress", Namespace: "default", ResourceVersion: "1"},
+	}
+	wh := newTestWatchHandler(denyAll)
+	defer close(wh.stopChan)
+	informer := wh.informerFactory.Networking().V1().NetworkPolicies().Informer()
+	wh.informerFactory.Start(wh.stopChan)
+	wh.informerFactory.WaitForCacheSync(wh.stopChan)
+	newTestMicroService(wh, 1, "default", "web", map[string]string{"app": "web"})
+	newTestMicroService(wh, 2, "other", "web", map[string]string{"app": "web"})
+
+	assert.NoError(t, wh.networkPolicyEventHandler(&watch.Event{Type: watch.Added, Object: denyAll.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.NetworkPolicies.Created))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Updated))
+	msd := wh.jsonReport.MicroServices.Updated[0].(MicroServiceData)
+	assert.Equal(t, 1, msd.PodSpecId)
+	assert.Equal(t, &NetworkPolicySummary{Policies: []string{"deny-ingress"}, IngressIsolated: true}, msd.NetworkPolicies)
+
+	// the microservices are reported only when their summary changes
+	assert.NoError(t, wh.networkPolicyEventHandler(&watch.Event{Type: watch.Modified, Object: denyAll.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Updated))
+
+	egress := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-egress", Namespace: "default", ResourceVersion: "2"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		},
+	}
+	assert.NoError(t, informer.GetStore().Add(egress))
+	assert.NoError(t, wh.networkPolicyEventHandler(&watch.Event{Type: watch.Added, Object: egress.DeepCopy()}))
+	assert.Equal(t, 2, len(wh.jsonReport.MicroServices.Updated))
+	msd = wh.jsonReport.MicroServices.Updated[1].(MicroServiceData)
+	assert.Equal(t, &NetworkPolicySummary{Policies: []string{"deny-ingress", "web-egress"}, IngressIsolated: true, EgressIsolated: true}, msd.NetworkPolicies)
+
+	assert.NoError(t, informer.GetStore().Delete(denyAll))
+	assert.NoError(t, wh.networkPolicyEventHandler(&watch.Event{Type: watch.Deleted, Object: denyAll.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.NetworkPolicies.Deleted))
+	msd = wh.jsonReport.MicroServices.Updated[2].(MicroServiceData)
+	assert.Equal(t, &NetworkPolicySummary{Policies: []string{"web-egress"}, EgressIsolated: true}, msd.NetworkPolicies)
+
+	// a pod of another namespace is not selected
+	assert.Nil(t, wh.pdm[2].Front().Value.(MicroServiceData).NetworkPolicies)
+	assert.Equal(t, &NetworkPolicySummary{Policies: []string{}}, wh.getNetworkPolicySummary(wh.pdm[2].Front().Value.(MicroServiceData).Pod))
+
+	// the microservice of a cronjob is selected by the labels of its job template
+	cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "default", ResourceVersion: "1"}}
+	cronJob.Spec.JobTemplate.Spec.Template.Labels = map[string]string{"app": "web"}
+	assert.NoError(t, wh.cronJobEventHandler(&watch.Event{Type: watch.Added, Object: cronJob.DeepCopy()}))
+	msd = wh.jsonReport.MicroServices.Created[0].(MicroServiceData)
+	assert.Equal(t, &NetworkPolicySummary{Policies: []string{"web-egress"}, EgressIsolated: true}, msd.NetworkPolicies)
+
+	assert.NoError(t, informer.GetStore().Delete(egress))
+	assert.NoError(t, wh.networkPolicyEventHandler(&watch.Event{Type: watch.Deleted, Object: egress.DeepCopy()}))
+	updated := map[int]*NetworkPolicySummary{}
+	for _, data := range wh.jsonReport.MicroServices.Updated[3:] {
+		updated[data.(MicroServiceData).PodSpecId] = data.(MicroServiceData).NetworkPolicies
+	}
+	assert.Equal(t, &NetworkPolicySummary{Policies: []string{}}, updated[msd.PodSpecId], "the cronjob microservice is updated")
+	assert.Equal(t, &NetworkPolicySummary{Policies: []string{}}, updated[1])
+}
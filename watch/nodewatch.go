@@ -2,9 +2,9 @@ package watch
 
 import (
 	"container/list"
+	"fmt"
+	"reflect"
 	"runtime/debug"
-	"strings"
-	"time"
 
 	"github.com/golang/glog"
 	core "k8s.io/api/core/v1"
@@ -24,49 +24,44 @@ func (updateNode *NodeData) UpdateNodeData(node *core.Node) {
 	updateNode.NodeStatus = node.Status
 }
 
-func UpdateNode(node *core.Node, ndm map[int]*list.List) *NodeData {
+// UpdateNode updates the node data of the node. Returns the node data, nil if the node is not known, and whether the
+// node changed since it was last reported
+func UpdateNode(node *core.Node, ndm map[int]*list.List) (*NodeData, bool) {
+	_, front := lookupList(ndm, "node", node.ObjectMeta.Name)
+	if front == nil {
+		return nil, false
+	}
+	nd := front.Value.(*NodeData)
+	if !isNodeStatusChanged(&nd.NodeStatus, &node.Status) {
+		return nd, false
+	}
+	nd.UpdateNodeData(node)
+	glog.Infof("node %s updated", nd.Name)
+	return nd, true
+}
 
-	var nd *NodeData
-	for _, v := range ndm {
-		if v == nil || v.Len() == 0 {
-			continue
-		}
-		if strings.Compare(v.Front().Value.(*NodeData).Name, node.ObjectMeta.Name) == 0 {
-			v.Front().Value.(*NodeData).UpdateNodeData(node)
-			glog.Infof("node %s updated", v.Front().Value.(*NodeData).Name)
-			nd = v.Front().Value.(*NodeData)
-			break
-		}
-		if strings.Compare(v.Front().Value.(*NodeData).Name, node.ObjectMeta.GenerateName) == 0 {
-			v.Front().Value.(*NodeData).UpdateNodeData(node)
-			glog.Infof("node %s updated", v.Front().Value.(*NodeData).Name)
-			nd = v.Front().Value.(*NodeData)
-			break
-		}
+// isNodeStatusChanged compares the node statuses, ignoring the heartbeats the kubelet keeps sending
+func isNodeStatusChanged(oldStatus, newStatus *core.NodeStatus) bool {
+	return !reflect.DeepEqual(withoutHeartbeats(oldStatus), withoutHeartbeats(newStatus))
+}
+
+func withoutHeartbeats(status *core.NodeStatus) *core.NodeStatus {
+	s := status.DeepCopy()
+	for i := range s.Conditions {
+		s.Conditions[i].LastHeartbeatTime = metav1.Time{}
 	}
-	return nd
+	return s
 }
 
 func RemoveNode(node *core.Node, ndm map[int]*list.List) string {
-
-	var nodeName string
-	for _, v := range ndm {
-		if v == nil || v.Len() == 0 {
-			continue
-		}
-		if strings.Compare(v.Front().Value.(*NodeData).Name, node.ObjectMeta.Name) == 0 {
-			v.Remove(v.Front())
-			glog.Infof("node %s updated", v.Front().Value.(*NodeData).Name)
-			nodeName = v.Front().Value.(*NodeData).Name
-			break
-		}
-		if strings.Compare(v.Front().Value.(*NodeData).Name, node.ObjectMeta.GenerateName) == 0 {
-			v.Remove(v.Front())
-			glog.Infof("node %s updated", v.Front().Value.(*NodeData).Name)
-			nodeName = v.Front().Value.(*NodeData).Name
-			break
-		}
+	id, front := lookupList(ndm, "node", node.ObjectMeta.Name)
+	if front == nil {
+		return ""
 	}
+	nodeName := front.Value.(*NodeData).Name
+	delete(ndm, id)
+	DeleteID(id)
+	glog.Infof("node %s removed", nodeName)
 	return nodeName
 }
 
@@ -77,84 +72,48 @@ func (wh *WatchHandler) NodeWatch() {
 			glog.Errorf("RECOVER NodeWatch. error: %v, stack: %s", err, debug.Stack())
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-	for {
-		wh.clusterAPIServerVersion = wh.getClusterVersion()
-		wh.cloudVendor = wh.checkInstanceMetadataAPIVendor()
-		if wh.cloudVendor != "" {
-			wh.clusterAPIServerVersion.GitVersion += ";" + wh.cloudVendor
-		}
-		glog.Infof("K8s Cloud Vendor : %s", wh.cloudVendor)
+	wh.clusterAPIServerVersion = wh.getClusterVersion()
+	wh.cloudVendor = wh.checkInstanceMetadataAPIVendor()
+	if wh.cloudVendor != "" {
+		wh.clusterAPIServerVersion.GitVersion += ";" + wh.cloudVendor
+	}
+	glog.Infof("K8s Cloud Vendor : %s", wh.cloudVendor)
 
-		glog.Infof("Watching over nodes starting")
-		nodesWatcher, err := wh.RestAPIClient.CoreV1().Nodes().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			glog.Errorf("cannot watch over nodes. %v", err)
-			time.Sleep(3 * time.Second)
-			continue
-		}
-		wh.handleNodeWatch(nodesWatcher, newStateChan, &lastWatchEventCreationTime)
+	glog.Infof("Watching over nodes starting")
+	nodesWatcher := wh.watchInformer(wh.informerFactory.Core().V1().Nodes().Informer(), "node")
+	glog.Infof("Watching over nodes started")
+	wh.handleInformerEvents(nodesWatcher, "node", wh.nodeEventHandler)
+}
 
+func (wh *WatchHandler) nodeEventHandler(event *watch.Event) error {
+	node, ok := event.Object.(*core.Node)
+	if !ok {
+		return fmt.Errorf("got unexpected node from chan")
 	}
-}
-func (wh *WatchHandler) handleNodeWatch(nodesWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
-	nodesChan := nodesWatcher.ResultChan()
-	for {
-		var event watch.Event
-		select {
-		case event = <-nodesChan:
-		case <-newStateChan:
-			nodesWatcher.Stop()
-			glog.Errorf("Node watch - newStateChan signal")
-			*lastWatchEventCreationTime = time.Now()
-			return
-		}
-		if event.Type == watch.Error {
-			glog.Errorf("Node watch chan loop error: %v", event.Object)
-			nodesWatcher.Stop()
-			*lastWatchEventCreationTime = time.Now()
-			return
-		}
-		if node, ok := event.Object.(*core.Node); ok {
-			node.ManagedFields = []metav1.ManagedFieldsEntry{}
-			switch event.Type {
-			case "ADDED":
-				if node.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
-					glog.Infof("node %s already exist, will not be reported", node.ObjectMeta.Name)
-					continue
-				}
-				id := CreateID()
-				if wh.ndm[id] == nil {
-					wh.ndm[id] = list.New()
-				}
-				nd := &NodeData{Name: node.ObjectMeta.Name,
-					NodeStatus: node.Status,
-				}
-				wh.ndm[id].PushBack(nd)
-				informNewDataArrive(wh)
-				wh.jsonReport.AddToJsonFormat(nd, NODE, CREATED)
-			case "MODIFY":
-				updateNode := UpdateNode(node, wh.ndm)
-				informNewDataArrive(wh)
-				wh.jsonReport.AddToJsonFormat(updateNode, NODE, UPDATED)
-			case "DELETED":
-				name := RemoveNode(node, wh.ndm)
-				informNewDataArrive(wh)
-				wh.jsonReport.AddToJsonFormat(name, NODE, DELETED)
-			case "BOOKMARK": //only the resource version is changed but it's the same workload
-				continue
-			case "ERROR":
-				glog.Errorf("while watching over nodes we got an error: %v", event)
-				*lastWatchEventCreationTime = time.Now()
-				return
+	node.ManagedFields = []metav1.ManagedFieldsEntry{}
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		nd, changed := UpdateNode(node, wh.ndm)
+		if nd == nil {
+			id := CreateID("node", node.ObjectMeta.Name)
+			nd = &NodeData{Name: node.ObjectMeta.Name,
+				NodeStatus: node.Status,
 			}
-		} else {
-			*lastWatchEventCreationTime = time.Now()
-			return
+			wh.ndm[id] = list.New()
+			wh.ndm[id].PushBack(nd)
+			wh.jsonReport.AddToJsonFormat(nd, NODE, CREATED)
+			informNewDataArrive(wh)
+		} else if changed {
+			wh.jsonReport.AddToJsonFormat(nd, NODE, UPDATED)
+			informNewDataArrive(wh)
+		}
+	case watch.Deleted:
+		if name := RemoveNode(node, wh.ndm); name != "" {
+			wh.jsonReport.AddToJsonFormat(name, NODE, DELETED)
+			informNewDataArrive(wh)
 		}
 	}
+	return nil
 }
 
 func (wh *WatchHandler) checkInstanceMetadataAPIVendor() string {
@@ -0,0 +1,51 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestNodeEventHandler(t *testing.T) {
+	wh := newTestWatchHandler()
+	node := &core.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", ResourceVersion: "1"},
+		Status: core.NodeStatus{Conditions: []core.NodeCondition{
+			{Type: core.NodeReady, Status: core.ConditionTrue, LastHeartbeatTime: metav1.NewTime(time.Now())},
+		}},
+	}
+	assert.NoError(t, wh.nodeEventHandler(&watch.Event{Type: watch.Added, Object: node.DeepCopy()}))
+	assert.Equal(t, 1, wh.jsonReport.Nodes.Len())
+	assert.Equal(t, 1, len(wh.jsonReport.Nodes.Created))
+
+	// a heartbeat is not a change
+	heartbeat := node.DeepCopy()
+	heartbeat.ResourceVersion = "2"
+	heartbeat.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(time.Now().Add(time.Minute))
+	assert.NoError(t, wh.nodeEventHandler(&watch.Event{Type: watch.Modified, Object: heartbeat}))
+	assert.Equal(t, 0, len(wh.jsonReport.Nodes.Updated))
+
+	notReady := heartbeat.DeepCopy()
+	notReady.ResourceVersion = "3"
+	notReady.Status.Conditions[0].Status = core.ConditionFalse
+	assert.NoError(t, wh.nodeEventHandler(&watch.Event{Type: watch.Modified, Object: notReady}))
+	assert.Equal(t, 1, len(wh.jsonReport.Nodes.Updated))
+	assert.Equal(t, core.ConditionFalse, wh.jsonReport.Nodes.Updated[0].(*NodeData).Conditions[0].Status)
+
+	// the same object added again after a re-list is not reported twice
+	assert.NoError(t, wh.nodeEventHandler(&watch.Event{Type: watch.Added, Object: notReady.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Nodes.Created))
+	assert.Equal(t, 1, len(wh.jsonReport.Nodes.Updated))
+
+	assert.NoError(t, wh.nodeEventHandler(&watch.Event{Type: watch.Deleted, Object: notReady.DeepCopy()}))
+	assert.Equal(t, []interface{}{"node-1"}, wh.jsonReport.Nodes.Deleted)
+	assert.Equal(t, 0, len(wh.ndm))
+
+	// unknown nodes are not reported as deleted
+	assert.NoError(t, wh.nodeEventHandler(&watch.Event{Type: watch.Deleted, Object: notReady.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Nodes.Deleted))
+}
@@ -0,0 +1,53 @@
+package watch
+
+import (
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// watchedObject is a typed object of a watcher reporting the objects as they are
+type watchedObject interface {
+	runtime.Object
+	metav1.Object
+}
+
+// reportObjectEvent stores the object of the event in dm, and reports it as jtype when it's new, changed or deleted.
+// isChanged compares the stored object with the new one. Returns whether the object was reported
+func (wh *WatchHandler) reportObjectEvent(kind string, eventType watch.EventType, obj watchedObject, dm *resourceMap, jtype JsonType, isChanged func(oldObj, newObj watchedObject) bool) bool {
+	// cluster scoped objects have no namespace
+	if obj.GetNamespace() != "" && !wh.isNamespaceWatched(obj.GetNamespace()) {
+		return false
+	}
+	obj.SetManagedFields(nil)
+	switch eventType {
+	case watch.Added, watch.Modified:
+		id, stored, found := dm.lookup(kind, obj.GetNamespace(), obj.GetName())
+		if !found {
+			id = CreateID(kind, obj.GetNamespace(), obj.GetName())
+			dm.init(id)
+			dm.pushBack(id, obj)
+			wh.jsonReport.AddToJsonFormat(obj, jtype, CREATED)
+		} else if isChanged(stored.(watchedObject), obj) {
+			dm.updateFront(id, obj)
+			glog.Infof("%s %s updated", kind, obj.GetName())
+			wh.jsonReport.AddToJsonFormat(obj, jtype, UPDATED)
+		} else {
+			return false
+		}
+	case watch.Deleted:
+		id, _, found := dm.lookup(kind, obj.GetNamespace(), obj.GetName())
+		if !found {
+			return false
+		}
+		dm.remove(id)
+		DeleteID(id)
+		glog.Infof("%s %s removed", kind, obj.GetName())
+		wh.jsonReport.AddToJsonFormat(obj, jtype, DELETED)
+	default:
+		return false
+	}
+	informNewDataArrive(wh)
+	return true
+}
@@ -0,0 +1,338 @@
+package watch
+
+import (
+	"expvar"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// maxOwnerChainLength stops the walk up the owners of a pod, in case of an ownership loop
+const maxOwnerChainLength = 10
+
+// ownerCacheMetrics are the counters of the owner chains cache: hits, misses, invalidations and the owners fetched
+// from the API server, the ones not in an informer cache yet. They are served at /debug/vars with the probes
+var ownerCacheMetrics = expvar.NewMap("ownerCache")
+
+func init() {
+	ownerCacheMetrics.Set("hitRate", expvar.Func(func() interface{} {
+		hits, misses := getMetric(ownerCacheMetrics, "hits"), getMetric(ownerCacheMetrics, "misses")
+		if hits+misses == 0 {
+			return 0.0
+		}
+		return float64(hits) / float64(hits+misses)
+	}))
+}
+
+func getMetric(metrics *expvar.Map, name string) int64 {
+	if value, ok := metrics.Get(name).(*expvar.Int); ok {
+		return value.Value()
+	}
+	return 0
+}
+
+// OwnerReference is an owner in the ownership chain of a pod
+type OwnerReference struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid"`
+}
+
+// ownerResolver walks the owner references of the pods up to their top owner, whatever the controllers. The
+// resources of the owners are found with the discovery, and the owners are read from the informer caches, watched
+// from their first lookup. The resolved chains are cached until an owner in them changes its owners or is deleted
+type ownerResolver struct {
+	client                 dynamic.Interface
+	mapper                 meta.ResettableRESTMapper
+	informerFactory        informers.SharedInformerFactory
+	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+	stopChan               <-chan struct{}
+	// informers are the informers of the owner resources, the typed ones when there are
+	informers map[schema.GroupVersionResource]cache.SharedIndexInformer
+	// chains are the resolved owner chains, by UID of their first owner
+	chains map[types.UID][]OwnerReference
+	// generation changes with every invalidation, a chain resolved meanwhile may be stale and isn't cached
+	generation uint64
+	mutex      sync.Mutex
+}
+
+func newOwnerResolver(client dynamic.Interface, mapper meta.ResettableRESTMapper, informerFactory informers.SharedInformerFactory,
+	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory, stopChan <-chan struct{}) *ownerResolver {
+	return &ownerResolver{
+		client:                 client,
+		mapper:                 mapper,
+		informerFactory:        informerFactory,
+		dynamicInformerFactory: dynamicInformerFactory,
+		stopChan:               stopChan,
+		informers:              make(map[schema.GroupVersionResource]cache.SharedIndexInformer),
+		chains:                 make(map[types.UID][]OwnerReference),
+	}
+}
+
+// resolve returns the owner chain starting with the owner reference, the top owner last. It fails when the first
+// owner can't be fetched, the chain stops at an upper owner that can't
+func (resolver *ownerResolver) resolve(namespace string, ownerReference *metav1.OwnerReference) ([]OwnerReference, error) {
+	chain, generation, ok := resolver.getChain(ownerReference.UID)
+	if ok {
+		ownerCacheMetrics.Add("hits", 1)
+		return chain, nil
+	}
+	ownerCacheMetrics.Add("misses", 1)
+	chain = []OwnerReference{newOwnerReference(ownerReference)}
+	visited := map[types.UID]bool{ownerReference.UID: true}
+	complete := true
+	for current := ownerReference; len(chain) < maxOwnerChainLength; {
+		owner, err := resolver.getOwner(namespace, current)
+		if err != nil {
+			if len(chain) == 1 {
+				return nil, err
+			}
+			glog.Warningf("failed to resolve the owner of %s %s/%s: %s", current.Kind, namespace, current.Name, err.Error())
+			complete = false
+			break
+		}
+		current = getControllerReference(owner.GetOwnerReferences())
+		if current == nil {
+			break
+		}
+		if visited[current.UID] {
+			glog.Warningf("ownership loop at %s %s/%s", current.Kind, namespace, current.Name)
+			break
+		}
+		if cached, _, ok := resolver.getChain(current.UID); ok {
+			chain = append(chain, cached...)
+			break
+		}
+		visited[current.UID] = true
+		chain = append(chain, newOwnerReference(current))
+	}
+	if complete {
+		resolver.setChain(chain, generation)
+	}
+	return chain, nil
+}
+
+// resolveObject returns the owner chain of the object, starting with the object, when its kind is the kind of an
+// owner resolved before. The objects of the other kinds own no pod, their informers aren't started for them
+func (resolver *ownerResolver) resolveObject(object *core.ObjectReference) ([]OwnerReference, bool) {
+	gv, err := schema.ParseGroupVersion(object.APIVersion)
+	if err != nil || object.UID == "" {
+		return nil, false
+	}
+	mapping, err := resolver.mapper.RESTMapping(gv.WithKind(object.Kind).GroupKind(), gv.Version)
+	if err != nil {
+		return nil, false
+	}
+	resolver.mutex.Lock()
+	_, ok := resolver.informers[mapping.Resource]
+	resolver.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+	chain, err := resolver.resolve(object.Namespace, &metav1.OwnerReference{APIVersion: object.APIVersion, Kind: object.Kind, Name: object.Name, UID: object.UID})
+	if err != nil {
+		return nil, false
+	}
+	return chain, true
+}
+
+// getChain returns the cached chain and the current generation
+func (resolver *ownerResolver) getChain(uid types.UID) ([]OwnerReference, uint64, bool) {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+	chain, ok := resolver.chains[uid]
+	return chain, resolver.generation, ok
+}
+
+// setChain caches the chain, and the chains of the upper owners it ends with, unless an owner was invalidated since
+// the generation
+func (resolver *ownerResolver) setChain(chain []OwnerReference, generation uint64) {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+	if resolver.generation != generation {
+		return
+	}
+	for i := range chain {
+		resolver.chains[chain[i].UID] = chain[i:]
+	}
+}
+
+// invalidate forgets the chains the owner is in
+func (resolver *ownerResolver) invalidate(uid types.UID) {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+	resolver.generation++
+	invalidated := false
+	for first, chain := range resolver.chains {
+		for i := range chain {
+			if chain[i].UID == uid {
+				delete(resolver.chains, first)
+				invalidated = true
+				break
+			}
+		}
+	}
+	if invalidated {
+		ownerCacheMetrics.Add("invalidations", 1)
+	}
+}
+
+// OnAdd is called for the owners listed by the informers, no chain can be in the cache for a new owner
+func (resolver *ownerResolver) OnAdd(obj interface{}) {}
+
+// OnUpdate invalidates the chains of an owner that changed its owners, adopted or orphaned
+func (resolver *ownerResolver) OnUpdate(oldObj, newObj interface{}) {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		return
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		return
+	}
+	if !reflect.DeepEqual(oldMeta.GetOwnerReferences(), newMeta.GetOwnerReferences()) {
+		resolver.invalidate(newMeta.GetUID())
+	}
+}
+
+// OnDelete invalidates the chains of a deleted owner
+func (resolver *ownerResolver) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if objMeta, err := meta.Accessor(obj); err == nil {
+		resolver.invalidate(objMeta.GetUID())
+	}
+}
+
+// getOwner fetches the owner of the reference, an owner recreated with the same name isn't the referenced one
+func (resolver *ownerResolver) getOwner(namespace string, ownerReference *metav1.OwnerReference) (metav1.Object, error) {
+	owner, _, err := resolver.getObject(namespace, ownerReference.APIVersion, ownerReference.Kind, ownerReference.Name)
+	if err != nil {
+		return nil, err
+	}
+	ownerMeta, err := meta.Accessor(owner)
+	if err != nil {
+		return nil, err
+	}
+	if ownerMeta.GetUID() != ownerReference.UID {
+		gv, _ := schema.ParseGroupVersion(ownerReference.APIVersion)
+		return nil, errors.NewNotFound(schema.GroupResource{Group: gv.Group, Resource: ownerReference.Kind}, ownerReference.Name)
+	}
+	return ownerMeta, nil
+}
+
+// getOwnerData returns a copy of an object of any kind, without its managed fields
+func (resolver *ownerResolver) getOwnerData(namespace, apiVersion, kind, name string) (runtime.Object, error) {
+	object, gvk, err := resolver.getObject(namespace, apiVersion, kind, name)
+	if err != nil {
+		return nil, err
+	}
+	object = object.DeepCopyObject()
+	if objMeta, err := meta.Accessor(object); err == nil {
+		objMeta.SetManagedFields(nil)
+	}
+	object.GetObjectKind().SetGroupVersionKind(gvk)
+	return object, nil
+}
+
+// getObject returns an object of any kind, from the informer cache of its resource, or from the API server while the
+// informer didn't sync. The returned object is shared with the informer cache. The discovery is refreshed once for a
+// kind it doesn't know, which may be of a custom resource installed since
+func (resolver *ownerResolver) getObject(namespace, apiVersion, kind, name string) (runtime.Object, schema.GroupVersionKind, error) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, schema.GroupVersionKind{}, err
+	}
+	gvk := gv.WithKind(kind)
+	mapping, err := resolver.mapper.RESTMapping(gvk.GroupKind(), gv.Version)
+	if meta.IsNoMatchError(err) {
+		resolver.mapper.Reset()
+		mapping, err = resolver.mapper.RESTMapping(gvk.GroupKind(), gv.Version)
+	}
+	if err != nil {
+		return nil, gvk, fmt.Errorf("failed to find the resource of %s %s: %s", apiVersion, kind, err.Error())
+	}
+	namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+	if informer := resolver.getInformer(mapping.Resource); informer.HasSynced() {
+		key := name
+		if namespaced {
+			key = namespace + "/" + name
+		}
+		object, exists, err := informer.GetIndexer().GetByKey(key)
+		if err != nil {
+			return nil, gvk, err
+		}
+		if !exists {
+			return nil, gvk, errors.NewNotFound(mapping.Resource.GroupResource(), name)
+		}
+		if robj, ok := object.(runtime.Object); ok {
+			return robj, gvk, nil
+		}
+	}
+	ownerCacheMetrics.Add("apiCalls", 1)
+	var client dynamic.ResourceInterface = resolver.client.Resource(mapping.Resource)
+	if namespaced {
+		client = resolver.client.Resource(mapping.Resource).Namespace(namespace)
+	}
+	object, err := client.Get(globalHTTPContext, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, gvk, err
+	}
+	return object, gvk, nil
+}
+
+// getInformer returns the informer of the owner resource, started on the first call
+func (resolver *ownerResolver) getInformer(gvr schema.GroupVersionResource) cache.SharedIndexInformer {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+	if informer, ok := resolver.informers[gvr]; ok {
+		return informer
+	}
+	var informer cache.SharedIndexInformer
+	if genericInformer, err := resolver.informerFactory.ForResource(gvr); err == nil {
+		informer = genericInformer.Informer()
+	} else {
+		informer = resolver.dynamicInformerFactory.ForResource(gvr).Informer()
+	}
+	setWatchErrorHandler(informer, gvr.Resource)
+	informer.AddEventHandler(resolver)
+	resolver.informers[gvr] = informer
+	resolver.informerFactory.Start(resolver.stopChan)
+	resolver.dynamicInformerFactory.Start(resolver.stopChan)
+	return informer
+}
+
+// getControllerReference returns the controller of the object, its first owner when none is the controller
+func getControllerReference(ownerReferences []metav1.OwnerReference) *metav1.OwnerReference {
+	if controllerReference := metav1.GetControllerOfNoCopy(&metav1.ObjectMeta{OwnerReferences: ownerReferences}); controllerReference != nil {
+		return controllerReference
+	}
+	if len(ownerReferences) > 0 {
+		return &ownerReferences[0]
+	}
+	return nil
+}
+
+func newOwnerReference(ownerReference *metav1.OwnerReference) OwnerReference {
+	return OwnerReference{
+		APIVersion: ownerReference.APIVersion,
+		Kind:       ownerReference.Kind,
+		Name:       ownerReference.Name,
+		UID:        ownerReference.UID,
+	}
+}
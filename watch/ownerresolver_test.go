@@ -0,0 +1,218 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+)
+
+var rolloutGroupVersion = schema.GroupVersion{Group: "argoproj.io", Version: "v1alpha1"}
+
+func newTestOwnerReference(apiVersion, kind, name string, controller bool) metav1.OwnerReference {
+	return metav1.OwnerReference{APIVersion: apiVersion, Kind: kind, Name: name, UID: types.UID(kind + "-" + name), Controller: &controller}
+}
+
+func newTestRollout(name string) *unstructured.Unstructured {
+	rollout := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(2)}}}
+	rollout.SetAPIVersion(rolloutGroupVersion.String())
+	rollout.SetKind("Rollout")
+	rollout.SetNamespace("default")
+	rollout.SetName(name)
+	rollout.SetUID(types.UID("Rollout-" + name))
+	return rollout
+}
+
+func newTestReplicaSet(name string, ownerReferences ...metav1.OwnerReference) *appsv1.ReplicaSet {
+	return &appsv1.ReplicaSet{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID("ReplicaSet-" + name), OwnerReferences: ownerReferences},
+	}
+}
+
+// newTestOwnerResolver returns a resolver knowing the Argo rollouts, the objects are the ones of the dynamic client,
+// the typed ones are listed by the informers of the watch handler
+func newTestOwnerResolver(wh *WatchHandler, objects ...runtime.Object) (*ownerResolver, *dynamicfake.FakeDynamicClient) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme.Scheme,
+		map[schema.GroupVersionResource]string{rolloutGroupVersion.WithResource("rollouts"): "RolloutList"}, objects...)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(rolloutGroupVersion.WithKind("Rollout"), meta.RESTScopeNamespace)
+	resolver := newOwnerResolver(client, meta.MultiRESTMapper{mapper, newTestRESTMapper()}, wh.informerFactory, newDynamicSharedInformerFactory(client), wh.stopChan)
+	return resolver, client
+}
+
+// waitForOwnerInformers waits for the informers the resolver started to list the owners
+func waitForOwnerInformers(t *testing.T, resolver *ownerResolver) {
+	resolver.mutex.Lock()
+	synced := []cache.InformerSynced{}
+	for _, informer := range resolver.informers {
+		synced = append(synced, informer.HasSynced)
+	}
+	resolver.mutex.Unlock()
+	assert.True(t, cache.WaitForCacheSync(resolver.stopChan, synced...))
+}
+
+func isChainCached(resolver *ownerResolver, uid types.UID) bool {
+	_, _, ok := resolver.getChain(uid)
+	return ok
+}
+
+func TestResolveOwnerChain(t *testing.T) {
+	rolloutReference := newTestOwnerReference(rolloutGroupVersion.String(), "Rollout", "web", true)
+	replicaSetReference := newTestOwnerReference("apps/v1", "ReplicaSet", "web-1", true)
+	replicaSet := newTestReplicaSet("web-1", rolloutReference)
+	wh := newTestWatchHandler(replicaSet)
+	defer close(wh.stopChan)
+	resolver, _ := newTestOwnerResolver(wh, newTestRollout("web"), replicaSet)
+
+	// the owners are fetched from the API server until the informers listed them
+	apiCalls := getMetric(ownerCacheMetrics, "apiCalls")
+	chain, err := resolver.resolve("default", &replicaSetReference)
+	assert.NoError(t, err)
+	assert.Equal(t, []OwnerReference{
+		{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-1", UID: "ReplicaSet-web-1"},
+		{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "web", UID: "Rollout-web"},
+	}, chain)
+	assert.Equal(t, apiCalls+2, getMetric(ownerCacheMetrics, "apiCalls"))
+	waitForOwnerInformers(t, resolver)
+
+	// the chains are cached by UID, the upper owners included
+	hits := getMetric(ownerCacheMetrics, "hits")
+	cached, err := resolver.resolve("default", &replicaSetReference)
+	assert.NoError(t, err)
+	assert.Equal(t, chain, cached)
+	cached, err = resolver.resolve("default", &rolloutReference)
+	assert.NoError(t, err)
+	assert.Equal(t, chain[1:], cached)
+	assert.Equal(t, hits+2, getMetric(ownerCacheMetrics, "hits"))
+
+	// an orphaned owner invalidates its chains, they are resolved again from the informer caches
+	apiCalls = getMetric(ownerCacheMetrics, "apiCalls")
+	replicaSet.OwnerReferences = nil
+	_, err = wh.RestAPIClient.AppsV1().ReplicaSets("default").Update(globalHTTPContext, replicaSet, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return !isChainCached(resolver, replicaSetReference.UID) }, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, isChainCached(resolver, rolloutReference.UID))
+	assert.Eventually(t, func() bool {
+		chain, err = resolver.resolve("default", &replicaSetReference)
+		return err == nil && len(chain) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, apiCalls, getMetric(ownerCacheMetrics, "apiCalls"))
+}
+
+func TestResolveOwnerChainDeletedOwner(t *testing.T) {
+	rolloutReference := newTestOwnerReference(rolloutGroupVersion.String(), "Rollout", "web", true)
+	replicaSetReference := newTestOwnerReference("apps/v1", "ReplicaSet", "web-1", true)
+	replicaSet := newTestReplicaSet("web-1", rolloutReference)
+	wh := newTestWatchHandler(replicaSet)
+	defer close(wh.stopChan)
+	resolver, client := newTestOwnerResolver(wh, newTestRollout("web"), replicaSet)
+	_, err := resolver.resolve("default", &replicaSetReference)
+	assert.NoError(t, err)
+	waitForOwnerInformers(t, resolver)
+
+	assert.NoError(t, client.Resource(rolloutGroupVersion.WithResource("rollouts")).Namespace("default").Delete(globalHTTPContext, "web", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool { return !isChainCached(resolver, replicaSetReference.UID) }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, isChainCached(resolver, rolloutReference.UID))
+
+	// the chain stops at the deleted rollout, and isn't cached
+	chain, err := resolver.resolve("default", &replicaSetReference)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(chain))
+	assert.Equal(t, "Rollout", chain[1].Kind)
+	assert.False(t, isChainCached(resolver, replicaSetReference.UID))
+}
+
+func TestResolveOwnerChainMissingOwners(t *testing.T) {
+	replicaSetReference := newTestOwnerReference("apps/v1", "ReplicaSet", "web-1", true)
+	replicaSet := newTestReplicaSet("web-1")
+	wh := newTestWatchHandler(replicaSet)
+	defer close(wh.stopChan)
+	resolver, _ := newTestOwnerResolver(wh, replicaSet)
+
+	missingReference := newTestOwnerReference("apps/v1", "ReplicaSet", "web-2", true)
+	_, err := resolver.resolve("default", &missingReference)
+	assert.True(t, apierrors.IsNotFound(err))
+	waitForOwnerInformers(t, resolver)
+	_, err = resolver.resolve("default", &missingReference)
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// an owner recreated with the same name isn't the owner
+	recreatedReference := replicaSetReference
+	recreatedReference.UID = "recreated"
+	_, err = resolver.resolve("default", &recreatedReference)
+	assert.True(t, apierrors.IsNotFound(err))
+
+	unknownReference := newTestOwnerReference("example.com/v1", "Unknown", "web", true)
+	_, err = resolver.resolve("default", &unknownReference)
+	assert.Error(t, err)
+}
+
+func TestResolveOwnerChainLoop(t *testing.T) {
+	first := newTestOwnerReference("apps/v1", "ReplicaSet", "first", true)
+	second := newTestOwnerReference("apps/v1", "ReplicaSet", "second", true)
+	replicaSets := []runtime.Object{newTestReplicaSet("first", second), newTestReplicaSet("second", first)}
+	wh := newTestWatchHandler(replicaSets...)
+	defer close(wh.stopChan)
+	resolver, _ := newTestOwnerResolver(wh, replicaSets...)
+
+	chain, err := resolver.resolve("default", &first)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(chain))
+}
+
+func TestGetControllerReference(t *testing.T) {
+	owner := newTestOwnerReference("v1", "ConfigMap", "owner", false)
+	controller := newTestOwnerReference("apps/v1", "ReplicaSet", "controller", true)
+	assert.Nil(t, getControllerReference(nil))
+	assert.Equal(t, "owner", getControllerReference([]metav1.OwnerReference{owner}).Name)
+	assert.Equal(t, "controller", getControllerReference([]metav1.OwnerReference{owner, controller}).Name)
+}
+
+func TestGetAncestorOfPod(t *testing.T) {
+	replicaSet := newTestReplicaSet("web-1", newTestOwnerReference(rolloutGroupVersion.String(), "Rollout", "web", true))
+	wh := newTestWatchHandler(replicaSet)
+	defer close(wh.stopChan)
+	wh.owners, _ = newTestOwnerResolver(wh, newTestRollout("web"), replicaSet)
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            "web-1-abcde",
+		Namespace:       "default",
+		OwnerReferences: []metav1.OwnerReference{newTestOwnerReference("apps/v1", "ReplicaSet", "web-1", true)},
+	}}
+
+	od, err := GetAncestorOfPod(pod, wh)
+	assert.NoError(t, err)
+	assert.Equal(t, "web", od.Name)
+	assert.Equal(t, "Rollout", od.Kind)
+	assert.Equal(t, 2, len(od.OwnerChain))
+	assert.Equal(t, map[string]interface{}{"replicas": float64(2)}, extractPodSpecFromOwner(od.OwnerData))
+
+	// the owner data is a copy of the cached owner
+	waitForOwnerInformers(t, wh.owners)
+	od, err = GetAncestorOfPod(pod, wh)
+	assert.NoError(t, err)
+	assert.Equal(t, "Rollout", od.OwnerData.(*unstructured.Unstructured).GetKind())
+	assert.Equal(t, map[string]interface{}{"replicas": float64(2)}, extractPodSpecFromOwner(od.OwnerData))
+
+	// the static pods are their own owners
+	pod.OwnerReferences = []metav1.OwnerReference{newTestOwnerReference("v1", "Node", "node-1", true)}
+	od, err = GetAncestorOfPod(pod, wh)
+	assert.NoError(t, err)
+	assert.Equal(t, OwnerDet{Name: "web-1-abcde", Kind: "Pod"}, od)
+
+	pod.OwnerReferences = []metav1.OwnerReference{newTestOwnerReference("apps/v1", "ReplicaSet", "web-2", true)}
+	_, err = GetAncestorOfPod(pod, wh)
+	assert.Error(t, err)
+}
@@ -2,7 +2,7 @@ package watch
 
 import (
 	"container/list"
-	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,23 +12,30 @@ import (
 	"time"
 
 	"github.com/golang/glog"
-	appsv1 "k8s.io/api/apps/v1"
-	batchv1 "k8s.io/api/batch/v1"
-	"k8s.io/api/batch/v1beta1"
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
+// podTemplateHashLabels are the labels the controllers set on their pods with the hash of their pod template
+var podTemplateHashLabels = []string{"pod-template-hash", "controller-revision-hash", "rollouts-pod-template-hash"}
+
+// podTemplateHashLength is the length of the hash of the pod spec of the owners not labeling their pods with one
+const podTemplateHashLength = 10
+
+// podEntry is a pod in pdm, with the ID of its microservice and its element in the list of the microservice
+type podEntry struct {
+	id      int
+	element *list.Element
+}
+
 type OwnerDet struct {
 	Name      string      `json:"name"`
 	Kind      string      `json:"kind"`
 	OwnerData interface{} `json:"ownerData,omitempty"`
-}
-type CRDOwnerData struct {
-	metav1.TypeMeta
+	// OwnerChain are the owners of the pod, from its controller up to the top owner, the one of Name and Kind
+	OwnerChain []OwnerReference `json:"ownerChain,omitempty"`
 }
 type OwnerDetNameAndKindOnly struct {
 	Name string `json:"name"`
@@ -36,9 +43,17 @@ type OwnerDetNameAndKindOnly struct {
 }
 
 type MicroServiceData struct {
-	*core.Pod `json:",inline"`
-	Owner     OwnerDet `json:"uptreeOwner"`
-	PodSpecId int      `json:"podSpecId"`
+	*core.Pod                 `json:",inline"`
+	Owner                     OwnerDet                   `json:"uptreeOwner"`
+	PodSpecId                 int                        `json:"podSpecId"`
+	NetworkPolicies           *NetworkPolicySummary      `json:"networkPolicies,omitempty"`
+	ServiceAccountPermissions *ServiceAccountPermissions `json:"serviceAccountPermissions,omitempty"`
+	Volumes                   []VolumeData               `json:"volumes,omitempty"`
+	Capacity                  *CapacityContext           `json:"capacity,omitempty"`
+	Posture                   *PostureSummary            `json:"posture,omitempty"`
+	// Revision is set by the collector with the deltas on, the microservice changes with its derived data as well as
+	// with its pod, whose resourceVersion stays the same
+	Revision string `json:"revision,omitempty"`
 }
 
 type PodDataForExistMicroService struct {
@@ -65,23 +80,16 @@ var scanNotificationCandidateList []*ScanNewImageData
 func (wh *WatchHandler) PodWatch() {
 	defer func() {
 		if err := recover(); err != nil {
-			glog.Errorf("RECOVER ListenerAndSender. %v, stack: %s", err, debug.Stack())
+			glog.Errorf("RECOVER PodWatch. %v, stack: %s", err, debug.Stack())
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	collectorCreationTime = time.Now()
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-	for {
-		glog.Infof("Watching over pods starting")
-		podsWatcher, err := wh.RestAPIClient.CoreV1().Pods("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			glog.Errorf("Watch error: %s", err.Error())
-			time.Sleep(3 * time.Second)
-			continue
-		}
-		wh.handlePodWatch(podsWatcher, newStateChan, &lastWatchEventCreationTime)
+	if collectorCreationTime.IsZero() {
+		collectorCreationTime = time.Now()
 	}
+	glog.Infof("Watching over pods starting")
+	podsWatcher := wh.watchInformer(wh.informerFactory.Core().V1().Pods().Informer(), "pod")
+	glog.Infof("Watching over pods started")
+	wh.handleInformerEvents(podsWatcher, "pod", wh.podEventHandler)
 }
 func isPodAlreadyExistInScanCandidateList(od *OwnerDet, pod *core.Pod) (bool, int) {
 	for i, data := range scanNotificationCandidateList {
@@ -159,148 +167,100 @@ func checkNotificationCandidateList(pod *core.Pod, od *OwnerDet, podStatus strin
 	return false
 }
 
-func (wh *WatchHandler) handlePodWatch(podsWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
-	for {
-		var event watch.Event
-		var chanActive bool
-		select {
-		case event, chanActive = <-podsWatcher.ResultChan():
-			if !chanActive {
-				glog.Error("Pod watch chan loop error inactive channel")
-				podsWatcher.Stop()
-				*lastWatchEventCreationTime = time.Now()
-				return
-			}
-		case <-newStateChan:
-			podsWatcher.Stop()
-			glog.Errorf("pod watch - newStateChan signal")
-			*lastWatchEventCreationTime = time.Now()
-			return
-		}
-		if event.Type == watch.Error {
-			glog.Errorf("Pod watch chan loop error: %v", event.Object)
-			podsWatcher.Stop()
-			*lastWatchEventCreationTime = time.Now()
-			return
-		}
-		pod, ok := event.Object.(*core.Pod)
-		if !ok {
-			glog.Errorf("Watch error: cannot convert to core.Pod: %v", event)
-			continue
-		}
-		if !wh.isNamespaceWatched(pod.Namespace) {
-			continue
+func (wh *WatchHandler) podEventHandler(event *watch.Event) error {
+	pod, ok := event.Object.(*core.Pod)
+	if !ok {
+		return fmt.Errorf("cannot convert to core.Pod: %v", event)
+	}
+	if !wh.isNamespaceWatched(pod.Namespace) {
+		return nil
+	}
+	wh.pdmMutex.Lock()
+	defer wh.pdmMutex.Unlock()
+	pod.ManagedFields = []metav1.ManagedFieldsEntry{}
+	podName := pod.ObjectMeta.Name
+	if podName == "" {
+		podName = pod.ObjectMeta.GenerateName
+	}
+	podStatus := getPodStatus(pod)
+	glog.Infof("event.Type %s. name: %s, status: %s", event.Type, podName, podStatus)
+	od, err := GetAncestorOfPod(pod, wh)
+	if err != nil {
+		return fmt.Errorf("%s, ignoring pod report", err.Error())
+	}
+	wh.updateImages(event.Type, pod, &od)
+	switch event.Type {
+	case watch.Added:
+		if wh.IsPodExist(pod) {
+			glog.Infof("pod %s already reported", podName)
+			return nil
 		}
-		pod.ManagedFields = []metav1.ManagedFieldsEntry{}
-		podName := pod.ObjectMeta.Name
-		if podName == "" {
-			podName = pod.ObjectMeta.GenerateName
+		id := microServiceID(pod.ObjectMeta.Namespace, &od, pod.ObjectMeta.Labels)
+		if wh.pdm[id] == nil {
+			// when a new pod microservice (a new pod that is running first in the cluster) is found
+			// we want to scan its vulnerabilities so we will use the trigger mechanism to do it
+			nms := MicroServiceData{Pod: pod, Owner: od, PodSpecId: id}
+			wh.setMicroServiceDerivedData(&nms)
+			wh.addMicroService(nms)
+			wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, CREATED)
+			wh.removeReplacedMicroServices(id, pod.Namespace, &od)
+			wh.notifyMicroServiceChanged(pod.Namespace)
+		} else if wh.pdm[id].Len() <= 1 {
+			// the microservice of a workload scaled to zero is kept, it's reported with the spec of its new first pod
+			nms := MicroServiceData{Pod: pod, Owner: od, PodSpecId: id}
+			wh.setMicroServiceDerivedData(&nms)
+			wh.setMicroService(nms)
+			wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, UPDATED)
+			wh.notifyMicroServiceChanged(pod.Namespace)
+		}
+
+		newPod := PodDataForExistMicroService{
+			PodName:   podName,
+			NodeName:  pod.Spec.NodeName,
+			PodIP:     pod.Status.PodIP,
+			Namespace: pod.ObjectMeta.Namespace,
+			Owner: OwnerDetNameAndKindOnly{
+				Name: od.Name,
+				Kind: od.Kind,
+			},
+			PodStatus:         podStatus,
+			CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339),
+		}
+		wh.addPodData(id, newPod)
+		wh.jsonReport.AddToJsonFormat(newPod, PODS, CREATED)
+		informNewDataArrive(wh)
+		if pod.CreationTimestamp.Time.After(collectorCreationTime) {
+			addPodScanNotificationCandidateList(&od, pod)
+		}
+	case watch.Modified:
+		if checkNotificationCandidateList(pod, &od, podStatus) {
+			if err := wh.notifyUpdates.notifyNewMicroServiceCreatedInTheCluster(pod.Namespace, od.Kind, od.Name); err != nil {
+				glog.Errorf("failed to notify updates. reason: %v", err)
+			}
+		}
+		if pod.DeletionTimestamp != nil { // the pod is terminating
+			return nil
 		}
-		podStatus := getPodStatus(pod)
-		glog.Infof("event.Type %s. name: %s, status: %s", event.Type, podName, podStatus)
-		od, err := GetAncestorOfPod(pod, wh)
-		if err != nil {
-			glog.Errorf("%s, ignoring pod report", err.Error())
-			*lastWatchEventCreationTime = time.Now()
-			break
-		}
-		switch event.Type {
-		case watch.Added:
-			if pod.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
-				glog.Infof("pod %s already exist, will not be reported", podName)
-				continue
-			}
-			first := true
-			id, runningPodNum := isPodSpecAlreadyExist(&od, pod.Namespace, wh.pdm)
-			if runningPodNum <= 1 {
-				// when a new pod microservice (a new pod that is running first in the cluster) is found
-				// we want to scan its vulnerabilities so we will use the trigger mechanism to do it
-				wh.pdm[id] = list.New()
-				nms := MicroServiceData{Pod: pod, Owner: od, PodSpecId: id}
-				wh.pdm[id].PushBack(nms)
-				if wh.isNamespaceWatched(pod.Namespace) {
-					wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, CREATED)
-				}
-
-			} else { // Check if pod is already reported
-				if wh.pdm[id].Front() != nil {
-					element := wh.pdm[id].Front().Next()
-					for element != nil {
-						if element.Value.(PodDataForExistMicroService).PodName == podName {
-							first = false
-							break
-						}
-						element = element.Next()
-					}
-				}
+		podSpecID, newPodData := wh.updatePod(pod, podStatus)
+		if newPodData != nil {
+			glog.Infof("Modified. name: %s, status: %s, uid: %s", podName, podStatus, pod.GetUID())
+			if strings.Contains(strings.ToLower(podStatus), "crashloop") {
+				wh.printPodLogs(pod)
 			}
-			if !first {
-				*lastWatchEventCreationTime = time.Now()
-				break
-			}
-
-			newPod := PodDataForExistMicroService{
-				PodName:   podName,
-				NodeName:  pod.Spec.NodeName,
-				PodIP:     pod.Status.PodIP,
-				Namespace: pod.ObjectMeta.Namespace,
-				Owner: OwnerDetNameAndKindOnly{
-					Name: od.Name,
-					Kind: od.Kind,
-				},
-				PodStatus:         podStatus,
-				CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339),
-			}
-			wh.pdm[id].PushBack(newPod)
-			if wh.isNamespaceWatched(pod.Namespace) {
-				wh.jsonReport.AddToJsonFormat(newPod, PODS, CREATED)
-				informNewDataArrive(wh)
-			}
-			if pod.CreationTimestamp.Time.After(collectorCreationTime) {
-				addPodScanNotificationCandidateList(&od, pod)
-			}
-		case watch.Modified:
-			if checkNotificationCandidateList(pod, &od, podStatus) {
-				if err := wh.notifyUpdates.notifyNewMicroServiceCreatedInTheCluster(pod.Namespace, od.Kind, od.Name); err != nil {
-					glog.Errorf("failed to notify updates. reason: %v", err)
-				}
-			}
-			if !wh.isNamespaceWatched(pod.Namespace) {
-				continue
-			}
-			if pod.DeletionTimestamp != nil { // the pod is terminating
-				*lastWatchEventCreationTime = time.Now()
-				break
-			}
-			podSpecID, newPodData := wh.updatePod(pod, wh.pdm, podStatus)
-			if podSpecID > -2 {
-				glog.Infof("Modified. name: %s, status: %s, uid: %s", podName, podStatus, pod.GetUID())
-				if strings.Contains(strings.ToLower(podStatus), "crashloop") {
-					wh.printPodLogs(pod)
-				}
-				wh.jsonReport.AddToJsonFormat(newPodData, PODS, UPDATED)
-			}
-			if podSpecID > -1 {
-				wh.jsonReport.AddToJsonFormat(wh.pdm[podSpecID].Front().Value.(MicroServiceData), MICROSERVICES, UPDATED)
-			}
-			if podSpecID > -2 {
-				informNewDataArrive(wh)
-			}
-		case watch.Deleted:
-			removePodScanNotificationCandidateList(&od, pod)
-			if !wh.isNamespaceWatched(pod.Namespace) {
-				continue
-			}
-			wh.DeletePod(pod, podName)
-		case watch.Bookmark:
-			glog.Infof("Bookmark. name: %s, status: %s", podName, podStatus)
-		case watch.Error:
-			removePodScanNotificationCandidateList(&od, pod)
-			glog.Infof("Error. name: %s, status: %s", podName, podStatus)
-			*lastWatchEventCreationTime = time.Now()
-			return
+			wh.jsonReport.AddToJsonFormat(*newPodData, PODS, UPDATED)
+		}
+		if podSpecID > -1 {
+			wh.jsonReport.AddToJsonFormat(wh.pdm[podSpecID].Front().Value.(MicroServiceData), MICROSERVICES, UPDATED)
+			wh.notifyMicroServiceChanged(pod.Namespace)
 		}
+		if newPodData != nil || podSpecID > -1 {
+			informNewDataArrive(wh)
+		}
+	case watch.Deleted:
+		removePodScanNotificationCandidateList(&od, pod)
+		wh.DeletePod(pod, podName)
 	}
+	return nil
 }
 
 // print all container logs. In case the RestartCount of one of the containers is greater than 2, skipping the print
@@ -348,7 +308,7 @@ func (wh *WatchHandler) printPodLogs(pod *core.Pod) {
 // DeletePod delete a pod
 func (wh *WatchHandler) DeletePod(pod *core.Pod, podName string) {
 	podStatus := "Terminating"
-	podSpecID, removeMicroServiceAsWell, owner := wh.RemovePod(pod, wh.pdm)
+	podSpecID, removeMicroServiceAsWell, owner := wh.RemovePod(pod)
 	if podSpecID == -1 {
 		return
 	}
@@ -362,29 +322,139 @@ func (wh *WatchHandler) DeletePod(pod *core.Pod, podName string) {
 		glog.Infof("remove %s.%s", owner.Kind, owner.Name)
 		nms := MicroServiceData{Pod: pod, Owner: owner, PodSpecId: podSpecID}
 		wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, DELETED)
+		wh.notifyMicroServiceChanged(pod.Namespace)
 	}
 	informNewDataArrive(wh)
 }
 
-// IsPodExist check
-func IsPodExist(pod *core.Pod, pdm map[int]*list.List) bool {
-	for _, v := range pdm {
-		if v == nil || v.Len() == 0 {
+// IsPodExist tells if the pod is in pdm, the caller holds pdmMutex
+func (wh *WatchHandler) IsPodExist(pod *core.Pod) bool {
+	_, ok := wh.pods[podKey(pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)]
+	return ok
+}
+
+// addMicroService adds the microservice to pdm, without pods, the caller holds pdmMutex
+func (wh *WatchHandler) addMicroService(msd MicroServiceData) {
+	wh.pdm[msd.PodSpecId] = list.New()
+	wh.pdm[msd.PodSpecId].PushBack(msd)
+	wh.indexMicroService(&msd, true)
+}
+
+// setMicroService replaces the microservice in pdm, whose owners may change with its first pod, the caller holds
+// pdmMutex
+func (wh *WatchHandler) setMicroService(msd MicroServiceData) {
+	v := wh.pdm[msd.PodSpecId]
+	if stored, ok := v.Front().Value.(MicroServiceData); ok {
+		wh.indexMicroService(&stored, false)
+	}
+	v.Front().Value = msd
+	wh.indexMicroService(&msd, true)
+}
+
+// removeMicroService removes the microservice from pdm and releases its ID, the caller holds pdmMutex
+func (wh *WatchHandler) removeMicroService(id int) {
+	if v := wh.pdm[id]; v != nil && v.Front() != nil {
+		if msd, ok := v.Front().Value.(MicroServiceData); ok {
+			wh.indexMicroService(&msd, false)
+		}
+	}
+	delete(wh.pdm, id)
+	DeleteID(id)
+}
+
+// indexMicroService adds the microservice to ownerIDs, or removes it, the caller holds pdmMutex
+func (wh *WatchHandler) indexMicroService(msd *MicroServiceData, add bool) {
+	if msd.Pod == nil {
+		return
+	}
+	keys := []string{ownerKey(msd.Pod.Namespace, msd.Owner.Kind, msd.Owner.Name)}
+	for _, owner := range msd.Owner.OwnerChain {
+		keys = append(keys, ownerKey(msd.Pod.Namespace, owner.Kind, owner.Name))
+	}
+	for _, key := range keys {
+		if add {
+			if wh.ownerIDs[key] == nil {
+				wh.ownerIDs[key] = make(map[int]bool)
+			}
+			wh.ownerIDs[key][msd.PodSpecId] = true
 			continue
 		}
-		if v.Front().Value.(MicroServiceData).Pod.ObjectMeta.Name == pod.ObjectMeta.Name {
-			return true
+		delete(wh.ownerIDs[key], msd.PodSpecId)
+		if len(wh.ownerIDs[key]) == 0 {
+			delete(wh.ownerIDs, key)
 		}
-		if v.Front().Value.(MicroServiceData).Pod.ObjectMeta.GenerateName == pod.ObjectMeta.Name {
-			return true
+	}
+}
+
+// getOwnedMicroServiceID returns the ID of the microservice the owner is in the owner chain of, the one with pods when
+// the owner has several, the caller holds pdmMutex
+func (wh *WatchHandler) getOwnedMicroServiceID(namespace, kind, name string) (int, bool) {
+	ownedID, ownedHasPods, found := 0, false, false
+	for id := range wh.ownerIDs[ownerKey(namespace, kind, name)] {
+		hasPods := wh.pdm[id].Len() > 1
+		if !found || (hasPods && !ownedHasPods) || (hasPods == ownedHasPods && id < ownedID) {
+			ownedID, ownedHasPods, found = id, hasPods, true
 		}
-		for e := ids.Ids.Front().Next(); e != nil; e = e.Next() {
-			if e.Value.(PodDataForExistMicroService).PodName == pod.ObjectMeta.Name {
-				return true
-			}
+	}
+	return ownedID, found
+}
+
+func ownerKey(namespace, kind, name string) string {
+	return namespace + "/" + kind + "/" + name
+}
+
+// addPodData adds the pod data to the microservice of the ID, the caller holds pdmMutex
+func (wh *WatchHandler) addPodData(id int, podData PodDataForExistMicroService) {
+	element := wh.pdm[id].PushBack(podData)
+	wh.pods[podKey(podData.Namespace, podData.PodName)] = podEntry{id: id, element: element}
+}
+
+func podKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// microServiceID returns the ID of the microservice of the pods of the owner, with the labels. The pods of an owner
+// created from the same template are the same microservice, whose ID stays the same across the restarts of the
+// collector. The microservices of the owners reported without their pods, like the cronjobs, get their ID from here
+// as well, so it's the one of their pods
+func microServiceID(namespace string, od *OwnerDet, podLabels map[string]string) int {
+	return CreateID("microservice", namespace, od.Kind, od.Name, getPodTemplateHash(podLabels, od))
+}
+
+// getPodTemplateHash returns the hash of the template the pods were created from, the one their controller labels
+// them with, or else a hash of the pod template of their owner. A pod without owner has none
+func getPodTemplateHash(podLabels map[string]string, od *OwnerDet) string {
+	for _, label := range podTemplateHashLabels {
+		if hash, ok := podLabels[label]; ok {
+			return hash
 		}
 	}
-	return false
+	if od.Kind == "Pod" || od.OwnerData == nil {
+		return ""
+	}
+	template, err := json.Marshal(extractPodTemplateFromOwner(od.OwnerData))
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(HashByteArray(template))[:podTemplateHashLength]
+}
+
+// extractPodTemplateFromOwner returns the pod template in the spec of the owner, the one of the job template of a
+// cronjob, or the whole spec of the owners without one
+func extractPodTemplateFromOwner(ownerData interface{}) interface{} {
+	spec, ok := extractPodSpecFromOwner(ownerData).(map[string]interface{})
+	if !ok {
+		return ownerData
+	}
+	if jobTemplate, ok := spec["jobTemplate"].(map[string]interface{}); ok {
+		if jobSpec, ok := jobTemplate["spec"].(map[string]interface{}); ok {
+			spec = jobSpec
+		}
+	}
+	if template, ok := spec["template"]; ok {
+		return template
+	}
+	return spec
 }
 
 func extractPodSpecFromOwner(ownerData interface{}) interface{} {
@@ -405,384 +475,294 @@ func extractPodSpecFromOwner(ownerData interface{}) interface{} {
 	return ownerData
 }
 
-func isPodSpecAlreadyExist(podOwner *OwnerDet, namespace string, pdm map[int]*list.List) (int, int) {
-	newSpec := extractPodSpecFromOwner(podOwner.OwnerData)
-	for _, v := range pdm {
-		if v == nil || v.Len() <= 1 {
-			continue
-		}
-		p := v.Front().Value.(MicroServiceData)
-		existsSpec := extractPodSpecFromOwner(p.Owner.OwnerData)
-		// In addition, in case we didn't change the podspec of the OwnerReference of the pod, we cant count on the owner labels changes
-		//  but on the labels / volumes of the actual pod we got to identify the changes
-		if p.ObjectMeta.Namespace == namespace && reflect.DeepEqual(newSpec, existsSpec) {
-			return v.Front().Value.(MicroServiceData).PodSpecId, v.Len()
-		}
-	}
-	return CreateID(), 0
-}
-
 // GetOwnerData - get the data of pod owner
 func GetOwnerData(name string, kind string, apiVersion string, namespace string, wh *WatchHandler) interface{} {
 	switch kind {
 	case "Deployment":
-		options := metav1.GetOptions{}
-		depDet, err := wh.RestAPIClient.AppsV1().Deployments(namespace).Get(globalHTTPContext, name, options)
+		depCached, err := wh.informerFactory.Apps().V1().Deployments().Lister().Deployments(namespace).Get(name)
 		if err != nil {
 			glog.Errorf("GetOwnerData Deployments: %s", err.Error())
 			return nil
 		}
+		depDet := depCached.DeepCopy()
 		depDet.TypeMeta.Kind = kind
 		depDet.TypeMeta.APIVersion = apiVersion
 		depDet.ManagedFields = []metav1.ManagedFieldsEntry{}
 		return depDet
 	case "DeamonSet", "DaemonSet":
-		options := metav1.GetOptions{}
-		daemSetDet, err := wh.RestAPIClient.AppsV1().DaemonSets(namespace).Get(globalHTTPContext, name, options)
+		daemSetCached, err := wh.informerFactory.Apps().V1().DaemonSets().Lister().DaemonSets(namespace).Get(name)
 		if err != nil {
 			glog.Errorf("GetOwnerData DaemonSets: %s", err.Error())
 			return nil
 		}
+		daemSetDet := daemSetCached.DeepCopy()
 		daemSetDet.TypeMeta.Kind = kind
 		daemSetDet.TypeMeta.APIVersion = apiVersion
 		daemSetDet.ManagedFields = []metav1.ManagedFieldsEntry{}
 		return daemSetDet
 	case "StatefulSet":
-		options := metav1.GetOptions{}
-		statSetDet, err := wh.RestAPIClient.AppsV1().StatefulSets(namespace).Get(globalHTTPContext, name, options)
+		statSetCached, err := wh.informerFactory.Apps().V1().StatefulSets().Lister().StatefulSets(namespace).Get(name)
 		if err != nil {
 			glog.Errorf("GetOwnerData StatefulSets: %s", err.Error())
 			return nil
 		}
+		statSetDet := statSetCached.DeepCopy()
 		statSetDet.TypeMeta.Kind = kind
 		statSetDet.TypeMeta.APIVersion = apiVersion
 		statSetDet.ManagedFields = []metav1.ManagedFieldsEntry{}
 		return statSetDet
 	case "Job":
-		options := metav1.GetOptions{}
-		jobDet, err := wh.RestAPIClient.BatchV1().Jobs(namespace).Get(globalHTTPContext, name, options)
+		jobCached, err := wh.informerFactory.Batch().V1().Jobs().Lister().Jobs(namespace).Get(name)
 		if err != nil {
 			glog.Errorf("GetOwnerData Jobs: %s", err.Error())
 			return nil
 		}
+		jobDet := jobCached.DeepCopy()
 		jobDet.TypeMeta.Kind = kind
 		jobDet.TypeMeta.APIVersion = apiVersion
 		jobDet.ManagedFields = []metav1.ManagedFieldsEntry{}
 		return jobDet
 	case "CronJob":
-		options := metav1.GetOptions{}
-		cronJobDet, err := wh.RestAPIClient.BatchV1beta1().CronJobs(namespace).Get(globalHTTPContext, name, options)
+		cronJobCached, err := wh.informerFactory.Batch().V1().CronJobs().Lister().CronJobs(namespace).Get(name)
 		if err != nil {
 			glog.Errorf("GetOwnerData CronJobs: %s", err.Error())
 			return nil
 		}
+		cronJobDet := cronJobCached.DeepCopy()
 		cronJobDet.TypeMeta.Kind = kind
 		cronJobDet.TypeMeta.APIVersion = apiVersion
 		cronJobDet.ManagedFields = []metav1.ManagedFieldsEntry{}
 		return cronJobDet
 	case "Pod":
-		options := metav1.GetOptions{}
-		podDet, err := wh.RestAPIClient.CoreV1().Pods(namespace).Get(globalHTTPContext, name, options)
+		podCached, err := wh.informerFactory.Core().V1().Pods().Lister().Pods(namespace).Get(name)
 		if err != nil {
 			glog.Errorf("GetOwnerData Pods: %s", err.Error())
 			return nil
 		}
+		podDet := podCached.DeepCopy()
 		podDet.TypeMeta.Kind = kind
 		podDet.TypeMeta.APIVersion = apiVersion
 		podDet.ManagedFields = []metav1.ManagedFieldsEntry{}
 		return podDet
 
 	default:
-		if wh.extensionsClient == nil {
+		if wh.owners == nil {
 			return nil
 		}
-		options := metav1.ListOptions{}
-		crds, err := wh.extensionsClient.CustomResourceDefinitions().List(context.Background(), options)
+		owner, err := wh.owners.getOwnerData(namespace, apiVersion, kind, name)
 		if err != nil {
-			glog.Errorf("GetOwnerData CustomResourceDefinitions: %s", err.Error())
+			glog.Errorf("GetOwnerData %s: %s", kind, err.Error())
 			return nil
 		}
-		for crdIdx := range crds.Items {
-			if crds.Items[crdIdx].Status.AcceptedNames.Kind == kind {
-				return CRDOwnerData{
-					metav1.TypeMeta{Kind: crds.Items[crdIdx].Kind,
-						APIVersion: apiVersion,
-					}}
-			}
-		}
+		return owner
 	}
-
-	return nil
 }
 
 func GetAncestorFromLocalPodsList(pod *core.Pod, wh *WatchHandler) (*OwnerDet, error) {
-	for _, v := range wh.pdm {
-		if v == nil || v.Front() == nil {
-			glog.Infof("found nil element in list of pods. pod name: %s, generateName: %s, namespace: %s", pod.GetName(), pod.GetGenerateName(), pod.GetNamespace())
-			continue
-		}
-		element := v.Front().Next()
-		for element != nil {
-			if strings.Compare(element.Value.(PodDataForExistMicroService).PodName, pod.ObjectMeta.Name) == 0 {
-				pdm := v.Front().Value.(MicroServiceData)
-				return &pdm.Owner, nil
-			}
-			element = element.Next()
-		}
+	if entry, ok := wh.pods[podKey(pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)]; ok {
+		msd := wh.pdm[entry.id].Front().Value.(MicroServiceData)
+		return &msd.Owner, nil
 	}
 	return nil, fmt.Errorf("error getting owner reference")
 }
 
+// GetAncestorOfPod returns the top owner of the pod, following the controllers of the owners whatever their kind.
+// A pod without owner, or a static pod, owned by its node, is its own owner
 func GetAncestorOfPod(pod *core.Pod, wh *WatchHandler) (OwnerDet, error) {
-	od := OwnerDet{}
-
-	if pod.OwnerReferences != nil {
-		switch pod.OwnerReferences[0].Kind {
-		case "Node":
-			od.Name = pod.ObjectMeta.Name
-			od.Kind = "Pod"
-			od.OwnerData = GetOwnerData(pod.ObjectMeta.Name, od.Kind, pod.APIVersion, pod.ObjectMeta.Namespace, wh)
-			if crd, ok := od.OwnerData.(CRDOwnerData); ok {
-				od.Kind = crd.Kind
-			}
-		case "ReplicaSet":
-			repItem, err := wh.RestAPIClient.AppsV1().ReplicaSets(pod.ObjectMeta.Namespace).Get(globalHTTPContext, pod.OwnerReferences[0].Name, metav1.GetOptions{})
-			if err != nil {
-				if localOD, inner_err := GetAncestorFromLocalPodsList(pod, wh); inner_err == nil {
-					return *localOD, nil
-				}
-				return od, fmt.Errorf("error getting owner reference: %s", err.Error())
-			}
-			if repItem.OwnerReferences != nil {
-				od.Name = repItem.OwnerReferences[0].Name
-				od.Kind = repItem.OwnerReferences[0].Kind
-				//meanwhile owner reference must be in the same namespace, so owner reference doesn't have the namespace field(may be changed in the future)
-				od.OwnerData = GetOwnerData(repItem.OwnerReferences[0].Name, repItem.OwnerReferences[0].Kind, repItem.OwnerReferences[0].APIVersion, pod.ObjectMeta.Namespace, wh)
-			} else {
-				depInt := wh.RestAPIClient.AppsV1().Deployments(pod.ObjectMeta.Namespace)
-				selector, err := metav1.LabelSelectorAsSelector(repItem.Spec.Selector)
-				if err != nil {
-					return od, fmt.Errorf("error getting owner reference: %s", err.Error())
-				}
-
-				options := metav1.ListOptions{}
-				depList, _ := depInt.List(globalHTTPContext, options)
-				for _, item := range depList.Items {
-					if selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
-						continue
-					} else {
-						od.Name = item.ObjectMeta.Name
-						od.Kind = item.Kind
-						od.OwnerData = GetOwnerData(od.Name, od.Kind, item.TypeMeta.APIVersion, pod.ObjectMeta.Namespace, wh)
-						break
-					}
-				}
-			}
-		case "Job":
-			od.Name = pod.OwnerReferences[0].Name
-			od.Kind = pod.OwnerReferences[0].Kind
-			//meanwhile owner reference must be in the same namespace, so owner reference doesn't have the namespace field(may be changed in the future)
-			od.OwnerData = GetOwnerData(pod.OwnerReferences[0].Name, pod.OwnerReferences[0].Kind, pod.OwnerReferences[0].APIVersion, pod.ObjectMeta.Namespace, wh)
-			jobItem, err := wh.RestAPIClient.BatchV1().Jobs(pod.ObjectMeta.Namespace).Get(globalHTTPContext, pod.OwnerReferences[0].Name, metav1.GetOptions{})
-			if err != nil {
-				if localOD, inner_err := GetAncestorFromLocalPodsList(pod, wh); inner_err == nil {
-					return *localOD, nil
-				}
-				glog.Error(err)
-				return od, err
-			}
-			if jobItem.OwnerReferences != nil {
-				od.Name = jobItem.OwnerReferences[0].Name
-				od.Kind = jobItem.OwnerReferences[0].Kind
-				//meanwhile owner reference must be in the same namespace, so owner reference doesn't have the namespace field(may be changed in the future)
-				od.OwnerData = GetOwnerData(jobItem.OwnerReferences[0].Name, jobItem.OwnerReferences[0].Kind, jobItem.OwnerReferences[0].APIVersion, pod.ObjectMeta.Namespace, wh)
-				break
-			}
-
-			depList, _ := wh.RestAPIClient.BatchV1beta1().CronJobs(pod.ObjectMeta.Namespace).List(globalHTTPContext, metav1.ListOptions{})
-			selector, err := metav1.LabelSelectorAsSelector(jobItem.Spec.Selector)
-			if err != nil {
-				glog.Errorf("LabelSelectorAsSelector: %s", err.Error())
-				return od, fmt.Errorf("error getting owner reference")
-			}
-
-			for _, item := range depList.Items {
-				if selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
-					continue
-				} else if item.Kind != "" && item.ObjectMeta.Name != "" {
-					od.Name = item.ObjectMeta.Name
-					od.Kind = item.Kind
-					od.OwnerData = GetOwnerData(od.Name, od.Kind, item.TypeMeta.APIVersion, pod.ObjectMeta.Namespace, wh)
-					break
-				}
-			}
-
-		default: // POD
-			od.Name = pod.OwnerReferences[0].Name
-			od.Kind = pod.OwnerReferences[0].Kind
-			od.OwnerData = GetOwnerData(pod.OwnerReferences[0].Name, pod.OwnerReferences[0].Kind, pod.OwnerReferences[0].APIVersion, pod.ObjectMeta.Namespace, wh)
+	od := OwnerDet{Name: pod.ObjectMeta.Name, Kind: "Pod"}
+	ownerReference := getControllerReference(pod.OwnerReferences)
+	if ownerReference == nil || ownerReference.Kind == "Node" {
+		od.OwnerData = GetOwnerData(od.Name, od.Kind, pod.APIVersion, pod.ObjectMeta.Namespace, wh)
+		return od, nil
+	}
+	chain, err := wh.owners.resolve(pod.ObjectMeta.Namespace, ownerReference)
+	if err != nil {
+		if localOD, innerErr := GetAncestorFromLocalPodsList(pod, wh); innerErr == nil {
+			return *localOD, nil
 		}
-	} else {
-		od.Name = pod.ObjectMeta.Name
-		od.Kind = "Pod"
-		od.OwnerData = GetOwnerData(pod.ObjectMeta.Name, od.Kind, pod.APIVersion, pod.ObjectMeta.Namespace, wh)
-		if crd, ok := od.OwnerData.(CRDOwnerData); ok {
-			od.Kind = crd.Kind
+		// the pod is going away with its owner
+		if errors.IsNotFound(err) {
+			return od, fmt.Errorf("error getting owner reference: %s", err.Error())
 		}
+		glog.Warningf("failed to resolve the owners of pod %s/%s: %s", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name, err.Error())
+		chain = []OwnerReference{newOwnerReference(ownerReference)}
 	}
+	top := chain[len(chain)-1]
+	od.Name = top.Name
+	od.Kind = top.Kind
+	od.OwnerChain = chain
+	//meanwhile owner reference must be in the same namespace, so owner reference doesn't have the namespace field(may be changed in the future)
+	od.OwnerData = GetOwnerData(top.Name, top.Kind, top.APIVersion, pod.ObjectMeta.Namespace, wh)
 	return od, nil
 }
 
-func (wh *WatchHandler) updatePod(pod *core.Pod, pdm map[int]*list.List, podStatus string) (int, PodDataForExistMicroService) {
-	id := -2
-	podDataForExistMicroService := PodDataForExistMicroService{}
-	for _, v := range pdm {
+// updatePod updates the stored pod data. Returns the updated pod data, nil when it didn't change, and the pod spec ID
+// of the microservice when the microservice changed as well, -1 otherwise
+func (wh *WatchHandler) updatePod(pod *core.Pod, podStatus string) (int, *PodDataForExistMicroService) {
+	entry, ok := wh.pods[podKey(pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)]
+	if !ok {
+		return -1, nil
+	}
+	v := wh.pdm[entry.id]
+	storedPodData := entry.element.Value.(PodDataForExistMicroService)
+	var updatedPodData *PodDataForExistMicroService
+	podDataForExistMicroService := PodDataForExistMicroService{PodName: pod.ObjectMeta.Name, NodeName: pod.Spec.NodeName, PodIP: pod.Status.PodIP, Namespace: pod.ObjectMeta.Namespace, Owner: storedPodData.Owner, PodStatus: podStatus, CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339)}
+	if podDataForExistMicroService != storedPodData {
+		entry.element.Value = podDataForExistMicroService
+		updatedPodData = &podDataForExistMicroService
+	}
+	// the microservice is reported with the spec of its first pod
+	msd := v.Front().Value.(MicroServiceData)
+	if msd.Pod.ObjectMeta.Name == pod.ObjectMeta.Name && isPodSpecChanged(msd.Pod, pod) {
+		msd.Pod = pod
+		wh.setMicroServiceDerivedData(&msd)
+		v.Front().Value = msd
+		return msd.PodSpecId, updatedPodData
+	}
+	return -1, updatedPodData
+}
+
+// setMicroServiceDerivedData sets the data of the microservice derived from the other watched objects
+func (wh *WatchHandler) setMicroServiceDerivedData(msd *MicroServiceData) {
+	msd.NetworkPolicies = wh.getNetworkPolicySummary(msd.Pod)
+	msd.ServiceAccountPermissions = wh.getServiceAccountPermissions(msd.Pod)
+	msd.Volumes = wh.getVolumes(msd.Pod)
+	msd.Capacity = wh.getCapacityContext(msd)
+	msd.Posture = wh.getPostureSummary(msd.Pod)
+}
+
+// updateMicroServices calls update with the microservices of the namespace, of all the namespaces when it's empty,
+// and reports the microservices update changed
+func (wh *WatchHandler) updateMicroServices(namespace string, update func(msd *MicroServiceData) bool) {
+	wh.pdmMutex.Lock()
+	defer wh.pdmMutex.Unlock()
+	changed := false
+	for _, v := range wh.pdm {
 		if v == nil || v.Front() == nil {
-			glog.Infof("found nil element in list of pods. pod name: %s, generateName: %s, namespace: %s", pod.GetName(), pod.GetGenerateName(), pod.GetNamespace())
 			continue
 		}
-		element := v.Front().Next()
-		for element != nil {
-			if strings.Compare(element.Value.(PodDataForExistMicroService).PodName, pod.ObjectMeta.Name) == 0 {
-				// newOwner := GetAncestorOfPod(pod, wh)
-
-				if reflect.DeepEqual(*v.Front().Value.(MicroServiceData).Pod, *pod) {
-					if err := DeepCopy(*pod, *v.Front().Value.(MicroServiceData).Pod); err != nil {
-						glog.Errorf("error in DeepCopy 'Pod' in UpdatePod")
-						id = -1
-					} else {
-						id = v.Front().Value.(MicroServiceData).PodSpecId
-					}
-				} else {
-					id = -1
-				}
-				podDataForExistMicroService = PodDataForExistMicroService{PodName: pod.ObjectMeta.Name, NodeName: pod.Spec.NodeName, PodIP: pod.Status.PodIP, Namespace: pod.ObjectMeta.Namespace, PodStatus: podStatus, CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339)}
-
-				if err := DeepCopy(element.Value.(PodDataForExistMicroService).Owner, &podDataForExistMicroService.Owner); err != nil {
-					glog.Errorf("error in DeepCopy 'Owner' in UpdatePod")
-				}
-
-				if err := DeepCopyObj(podDataForExistMicroService, element.Value.(PodDataForExistMicroService)); err != nil {
-					glog.Errorf("error in DeepCopy 'PodDataForExistMicroService' in UpdatePod")
-				}
-				break
-			}
-			element = element.Next()
+		msd, ok := v.Front().Value.(MicroServiceData)
+		if !ok || msd.Pod == nil || (namespace != "" && msd.Pod.Namespace != namespace) {
+			continue
 		}
+		if !update(&msd) {
+			continue
+		}
+		v.Front().Value = msd
+		wh.jsonReport.AddToJsonFormat(msd, MICROSERVICES, UPDATED)
+		changed = true
+	}
+	if changed {
+		informNewDataArrive(wh)
 	}
-	return id, podDataForExistMicroService
 }
 
-func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kind, namespace string) bool {
+// isPodSpecChanged compares the parts of the pod describing the microservice, the status is reported with the pod data
+func isPodSpecChanged(oldPod, newPod *core.Pod) bool {
+	return isObjectMetaChanged(&oldPod.ObjectMeta, &newPod.ObjectMeta) || !reflect.DeepEqual(oldPod.Spec, newPod.Spec)
+}
+
+// isMicroServiceNeedToBeRemoved tells if the owner of the microservice was deleted. The owners are looked up in the
+// informer caches the workload watchers are served from, a workload scaled to zero keeps its microservices
+func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(kind, namespace, name string) bool {
+	var err error
 	switch kind {
 	case "Deployment":
-		options := metav1.GetOptions{}
-		name := ownerData.(*appsv1.Deployment).ObjectMeta.Name
-		mic, err := wh.RestAPIClient.AppsV1().Deployments(namespace).Get(globalHTTPContext, name, options)
-		if errors.IsNotFound(err) {
-			return true
-		}
-		v, _ := json.Marshal(mic)
-		glog.Infof("Removing pod but not Deployment: %s", string(v))
-
+		_, err = wh.informerFactory.Apps().V1().Deployments().Lister().Deployments(namespace).Get(name)
 	case "DeamonSet", "DaemonSet":
-		options := metav1.GetOptions{}
-		name := ownerData.(*appsv1.DaemonSet).ObjectMeta.Name
-		mic, err := wh.RestAPIClient.AppsV1().DaemonSets(namespace).Get(globalHTTPContext, name, options)
-		if errors.IsNotFound(err) {
-			return true
-		}
-		v, _ := json.Marshal(mic)
-		glog.Infof("Removing pod but not DaemonSet: %s", string(v))
+		_, err = wh.informerFactory.Apps().V1().DaemonSets().Lister().DaemonSets(namespace).Get(name)
+	case "StatefulSet":
+		_, err = wh.informerFactory.Apps().V1().StatefulSets().Lister().StatefulSets(namespace).Get(name)
+	case "Job":
+		_, err = wh.informerFactory.Batch().V1().Jobs().Lister().Jobs(namespace).Get(name)
+	case "CronJob":
+		_, err = wh.informerFactory.Batch().V1().CronJobs().Lister().CronJobs(namespace).Get(name)
+	case "Pod":
+		_, err = wh.informerFactory.Core().V1().Pods().Lister().Pods(namespace).Get(name)
+	default:
+		return false
+	}
+	if errors.IsNotFound(err) {
+		return true
+	}
+	glog.Infof("Removing pod but not %s", kind)
+	return false
+}
 
-	case "StatefulSets":
-		options := metav1.GetOptions{}
-		name := ownerData.(*appsv1.StatefulSet).ObjectMeta.Name
-		mic, err := wh.RestAPIClient.AppsV1().StatefulSets(namespace).Get(globalHTTPContext, name, options)
+// isTemplateReplaced tells if the microservice, left without pods, won't get pods from its template again: the
+// controller its pods were created by, like a replica set, was deleted, or another template of its owner has pods,
+// after a rollout. The template of a cronjob stays until the cronjob changes it. The caller holds pdmMutex
+func (wh *WatchHandler) isTemplateReplaced(id int, msd *MicroServiceData) bool {
+	namespace := msd.ObjectMeta.Namespace
+	if msd.Owner.Kind == "CronJob" && wh.cronJobIDs[podKey(namespace, msd.Owner.Name)] == id {
+		return false
+	}
+	if len(msd.Owner.OwnerChain) > 1 {
+		controller := msd.Owner.OwnerChain[0]
+		_, err := wh.owners.getOwner(namespace, &metav1.OwnerReference{APIVersion: controller.APIVersion, Kind: controller.Kind, Name: controller.Name, UID: controller.UID})
 		if errors.IsNotFound(err) {
 			return true
 		}
-		v, _ := json.Marshal(mic)
-		glog.Infof("Removing pod but not StatefulSet: %s", string(v))
-	case "Job":
-		options := metav1.GetOptions{}
-		name := ownerData.(*batchv1.Job).ObjectMeta.Name
-		mic, err := wh.RestAPIClient.BatchV1().Jobs(namespace).Get(globalHTTPContext, name, options)
-		if errors.IsNotFound(err) {
-			return true
+	}
+	for otherID := range wh.ownerIDs[ownerKey(namespace, msd.Owner.Kind, msd.Owner.Name)] {
+		v := wh.pdm[otherID]
+		if otherID == id || v.Len() <= 1 {
+			continue
 		}
-		v, _ := json.Marshal(mic)
-		glog.Infof("Removing pod but not Job: %s", string(v))
-	case "CronJob":
-		options := metav1.GetOptions{}
-		cronJob, ok := ownerData.(*v1beta1.CronJob)
-		if !ok {
-			glog.Errorf("cant convert to v1beta1.CronJob")
+		if other, ok := v.Front().Value.(MicroServiceData); ok && isSameOwner(&other, namespace, &msd.Owner) {
 			return true
 		}
-		mic, err := wh.RestAPIClient.BatchV1beta1().CronJobs(namespace).Get(globalHTTPContext, cronJob.ObjectMeta.Name, options)
-		if errors.IsNotFound(err) {
-			return true
+	}
+	return false
+}
+
+// removeReplacedMicroServices removes the microservices of the owner left without pods, their template was replaced
+// by the one of the new microservice of the ID. The caller holds pdmMutex
+func (wh *WatchHandler) removeReplacedMicroServices(id int, namespace string, od *OwnerDet) {
+	if od.Kind == "Pod" || od.Kind == "CronJob" {
+		return
+	}
+	for otherID := range wh.ownerIDs[ownerKey(namespace, od.Kind, od.Name)] {
+		v := wh.pdm[otherID]
+		if otherID == id || v.Len() != 1 {
+			continue
 		}
-		v, _ := json.Marshal(mic)
-		glog.Infof("Removing pod but not CronJob: %s", string(v))
-	case "Pod":
-		options := metav1.GetOptions{}
-		name := ownerData.(*core.Pod).ObjectMeta.Name
-		mic, err := wh.RestAPIClient.CoreV1().Pods(namespace).Get(globalHTTPContext, name, options)
-		if errors.IsNotFound(err) {
-			return true
+		msd, ok := v.Front().Value.(MicroServiceData)
+		if !ok || !isSameOwner(&msd, namespace, od) {
+			continue
 		}
-		v, _ := json.Marshal(mic)
-		glog.Infof("Removing pod but not Pod: %s", string(v))
+		wh.removeMicroService(otherID)
+		glog.Infof("remove the replaced template of %s.%s", od.Kind, od.Name)
+		wh.jsonReport.AddToJsonFormat(msd, MICROSERVICES, DELETED)
 	}
+}
 
-	return false
+// isSameOwner tells if the microservice is of the owner
+func isSameOwner(msd *MicroServiceData, namespace string, od *OwnerDet) bool {
+	return msd.Pod != nil && msd.Pod.Namespace == namespace && msd.Owner.Kind == od.Kind && msd.Owner.Name == od.Name
 }
 
 // RemovePod remove pod and check if has parents. Returns 3 elements: 1. pod spec ID, 2. is owner removed, 3. owner
-func (wh *WatchHandler) RemovePod(pod *core.Pod, pdm map[int]*list.List) (int, bool, OwnerDet) {
-	var owner OwnerDet
+func (wh *WatchHandler) RemovePod(pod *core.Pod) (int, bool, OwnerDet) {
+	key := podKey(pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
+	entry, ok := wh.pods[key]
+	if !ok {
+		return -1, false, OwnerDet{}
+	}
+	delete(wh.pods, key)
+	v := wh.pdm[entry.id]
+	v.Remove(entry.element)
+	msd := v.Front().Value.(MicroServiceData)
 	removed := false
-	podSpecID := -1
-	for id, v := range pdm {
-		for element := v.Front(); element != nil; element = element.Next() {
-			podData, ok := element.Value.(PodDataForExistMicroService)
-			if !ok {
-				continue
-			}
-			if podData.PodName == pod.ObjectMeta.Name {
-				owner = v.Front().Value.(MicroServiceData).Owner
-				v.Remove(element)
-				podSpecID = id
-				if v.Len() <= 1 {
-					msd := v.Front().Value.(MicroServiceData)
-					removed = wh.isMicroServiceNeedToBeRemoved(msd.Owner.OwnerData, msd.Owner.Kind, msd.ObjectMeta.Namespace)
-					if removed {
-						v.Remove(v.Front())
-						delete(pdm, id)
-					}
-				}
-			}
-			if element.Value.(PodDataForExistMicroService).PodName == pod.ObjectMeta.GenerateName {
-				owner = v.Front().Value.(MicroServiceData).Owner
-				v.Remove(element)
-				if v.Len() <= 1 {
-					msd := v.Front().Value.(MicroServiceData)
-					removed := wh.isMicroServiceNeedToBeRemoved(msd.Owner.OwnerData, msd.Owner.Kind, msd.ObjectMeta.Namespace)
-					if removed {
-						v.Remove(v.Front())
-						delete(pdm, id)
-					}
-				}
-				podSpecID = v.Front().Value.(MicroServiceData).PodSpecId
-			}
-
+	if v.Len() <= 1 {
+		removed = wh.isMicroServiceNeedToBeRemoved(msd.Owner.Kind, msd.ObjectMeta.Namespace, msd.Owner.Name) || wh.isTemplateReplaced(entry.id, &msd)
+		if removed {
+			wh.removeMicroService(entry.id)
 		}
-
 	}
-	return podSpecID, removed, owner
+	return entry.id, removed, msd.Owner
 }
+
 func getPodStatus(pod *core.Pod) string {
 	containerStatuses := pod.Status.ContainerStatuses
 	status := ""
@@ -3,11 +3,17 @@ package watch
 import (
 	_ "embed"
 
+	"container/list"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
 	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 )
 
 //go:embed testdata/pod.json
@@ -318,3 +324,121 @@ func TestMicroserviceChangedSomethingButItsImage(t *testing.T) {
 	exist, _ = isPodAlreadyExistInScanCandidateList(&od, &pod)
 	assert.True(t, exist, "pod should exist")
 }
+
+func TestUpdatePod(t *testing.T) {
+	wh := newTestWatchHandler()
+	pod := &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx-1", Namespace: "default", ResourceVersion: "1"},
+		Spec:       core.PodSpec{NodeName: "node-1"},
+	}
+	wh.pdm[1] = list.New()
+	wh.pdm[1].PushBack(MicroServiceData{Pod: pod.DeepCopy(), PodSpecId: 1})
+	wh.addPodData(1, PodDataForExistMicroService{PodName: pod.Name, NodeName: "node-1", Namespace: pod.Namespace, PodStatus: "Pending", CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339)})
+
+	podSpecID, podData := wh.updatePod(pod.DeepCopy(), "Pending")
+	assert.Equal(t, -1, podSpecID)
+	assert.Nil(t, podData, "nothing changed")
+
+	podSpecID, podData = wh.updatePod(pod.DeepCopy(), "Running")
+	assert.Equal(t, -1, podSpecID)
+	assert.Equal(t, "Running", podData.PodStatus)
+	assert.Equal(t, "Running", wh.pdm[1].Back().Value.(PodDataForExistMicroService).PodStatus)
+
+	labeled := pod.DeepCopy()
+	labeled.Labels = map[string]string{"app": "nginx"}
+	podSpecID, podData = wh.updatePod(labeled, "Running")
+	assert.Equal(t, 1, podSpecID)
+	assert.Nil(t, podData)
+	assert.Equal(t, "nginx", wh.pdm[1].Front().Value.(MicroServiceData).Labels["app"])
+
+	otherNamespace := pod.DeepCopy()
+	otherNamespace.Namespace = "other"
+	podSpecID, podData = wh.updatePod(otherNamespace, "Failed")
+	assert.Equal(t, -1, podSpecID)
+	assert.Nil(t, podData)
+}
+
+func TestGetPodTemplateHash(t *testing.T) {
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", Labels: map[string]string{"pod-template-hash": "5d4f8b7c9"}}}
+	assert.Equal(t, "5d4f8b7c9", getPodTemplateHash(pod.Labels, &OwnerDet{Name: "web", Kind: "Deployment"}))
+
+	pod.Labels = nil
+	assert.Equal(t, "", getPodTemplateHash(pod.Labels, &OwnerDet{Name: "web-1", Kind: "Pod"}))
+	job := map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{"restartPolicy": "Never"}}}}
+	hash := getPodTemplateHash(pod.Labels, &OwnerDet{Name: "backup", Kind: "Job", OwnerData: job})
+	assert.Equal(t, podTemplateHashLength, len(hash))
+	assert.Equal(t, hash, getPodTemplateHash(pod.Labels, &OwnerDet{Name: "backup", Kind: "Job", OwnerData: job}))
+}
+
+func TestPodEventHandlerIDs(t *testing.T) {
+	wh := newTestWatchHandler()
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", ResourceVersion: "1"}}
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Added, Object: pod.DeepCopy()}))
+	assert.True(t, wh.IsPodExist(pod))
+	id := CreateID("microservice", "default", "Pod", "web-1", "")
+	assert.NotNil(t, wh.pdm[id], "the ID is derived from the identity of the microservice")
+	assert.Equal(t, id, wh.pdm[id].Front().Value.(MicroServiceData).PodSpecId)
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Created))
+
+	// a pod reported again is not added twice
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Added, Object: pod.DeepCopy()}))
+	assert.Equal(t, 2, wh.pdm[id].Len())
+	assert.Equal(t, 1, len(wh.jsonReport.Pods.Created))
+
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Deleted, Object: pod.DeepCopy()}))
+	assert.False(t, wh.IsPodExist(pod))
+	assert.Nil(t, wh.pdm[id])
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Deleted))
+	_, ok := getID("microservice", "default", "Pod", "web-1", "")
+	assert.False(t, ok, "the ID of the removed microservice is released")
+}
+
+func newTestRolloutPod(replicaSet string) *core.Pod {
+	return &core.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            replicaSet + "-abcde",
+		Namespace:       "default",
+		Labels:          map[string]string{"pod-template-hash": replicaSet},
+		OwnerReferences: []metav1.OwnerReference{newTestOwnerReference("apps/v1", "ReplicaSet", replicaSet, true)},
+	}}
+}
+
+func TestPodEventHandlerRollout(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "Deployment-web"}}
+	deploymentReference := newTestOwnerReference("apps/v1", "Deployment", "web", true)
+	wh := newTestWatchHandler(deployment, newTestReplicaSet("web-1", deploymentReference), newTestReplicaSet("web-2", deploymentReference), newTestReplicaSet("web-3", deploymentReference))
+	defer close(wh.stopChan)
+	wh.informerFactory.Apps().V1().Deployments().Informer()
+	wh.informerFactory.Start(wh.stopChan)
+	wh.informerFactory.WaitForCacheSync(wh.stopChan)
+	id := func(replicaSet string) int {
+		return CreateID("microservice", "default", "Deployment", "web", replicaSet)
+	}
+
+	// a rolling update, the pods of the new template start before the old ones stop
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Added, Object: newTestRolloutPod("web-1")}))
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Added, Object: newTestRolloutPod("web-2")}))
+	assert.NotNil(t, wh.pdm[id("web-1")])
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Deleted, Object: newTestRolloutPod("web-1")}))
+	assert.Nil(t, wh.pdm[id("web-1")], "the microservice of the old template is removed with its last pod")
+	assert.NotNil(t, wh.pdm[id("web-2")])
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Deleted))
+	assert.Equal(t, id("web-1"), wh.jsonReport.MicroServices.Deleted[0].(MicroServiceData).PodSpecId)
+
+	// a recreate, the old pods stop first, the deployment may be scaled to zero meanwhile
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Deleted, Object: newTestRolloutPod("web-2")}))
+	assert.NotNil(t, wh.pdm[id("web-2")], "the microservice of a deployment scaled to zero is kept")
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Added, Object: newTestRolloutPod("web-3")}))
+	assert.Nil(t, wh.pdm[id("web-2")], "the microservice of the old template is removed with the first pod of the new one")
+	assert.Equal(t, 2, len(wh.jsonReport.MicroServices.Deleted))
+	assert.Equal(t, id("web-2"), wh.jsonReport.MicroServices.Deleted[1].(MicroServiceData).PodSpecId)
+
+	// the replica set of the template is deleted
+	assert.NoError(t, wh.RestAPIClient.AppsV1().ReplicaSets("default").Delete(globalHTTPContext, "web-3", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		_, err := wh.informerFactory.Apps().V1().ReplicaSets().Lister().ReplicaSets("default").Get("web-3")
+		return apierrors.IsNotFound(err)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, wh.podEventHandler(&watch.Event{Type: watch.Deleted, Object: newTestRolloutPod("web-3")}))
+	assert.Nil(t, wh.pdm[id("web-3")])
+	assert.Equal(t, 3, len(wh.jsonReport.MicroServices.Deleted))
+}
@@ -0,0 +1,125 @@
+package watch
+
+import (
+	"reflect"
+	"sort"
+
+	core "k8s.io/api/core/v1"
+)
+
+// PostureSummary is the security posture of a microservice, computed from its pod spec and its service account.
+// The lists are the names of the containers, init containers included, and are empty when none is concerned
+type PostureSummary struct {
+	Privileged  []string `json:"privileged"`
+	HostPID     bool     `json:"hostPID"`
+	HostIPC     bool     `json:"hostIPC"`
+	HostNetwork bool     `json:"hostNetwork"`
+	// HostPaths are the paths of the hostPath volumes
+	HostPaths []string `json:"hostPaths"`
+	// AddedCapabilities are the capabilities added to the containers, by container
+	AddedCapabilities map[string][]core.Capability `json:"addedCapabilities"`
+	// RunAsNonRoot is set when all the containers must run as a non root user
+	RunAsNonRoot bool `json:"runAsNonRoot"`
+	// ReadOnlyRootFilesystem is set when all the containers have a read only root filesystem
+	ReadOnlyRootFilesystem bool `json:"readOnlyRootFilesystem"`
+	// MissingResourceLimits are the containers without CPU or memory limit
+	MissingResourceLimits []string `json:"missingResourceLimits"`
+	// AutomountServiceAccountToken is set when the token of the service account is mounted in the pods
+	AutomountServiceAccountToken bool `json:"automountServiceAccountToken"`
+}
+
+// updatePostureSummaries updates the posture summary of the microservices of the namespace
+func (wh *WatchHandler) updatePostureSummaries(namespace string) {
+	wh.updateMicroServices(namespace, func(msd *MicroServiceData) bool {
+		posture := wh.getPostureSummary(msd.Pod)
+		if reflect.DeepEqual(posture, msd.Posture) {
+			return false
+		}
+		msd.Posture = posture
+		return true
+	})
+}
+
+// getPostureSummary returns the posture summary of the pod, the automount of the service account token is read
+// from the service account in the informer cache when the pod spec doesn't set it
+func (wh *WatchHandler) getPostureSummary(pod *core.Pod) *PostureSummary {
+	spec := &pod.Spec
+	posture := &PostureSummary{
+		Privileged:                   []string{},
+		HostPID:                      spec.HostPID,
+		HostIPC:                      spec.HostIPC,
+		HostNetwork:                  spec.HostNetwork,
+		HostPaths:                    []string{},
+		AddedCapabilities:            map[string][]core.Capability{},
+		RunAsNonRoot:                 true,
+		ReadOnlyRootFilesystem:       true,
+		MissingResourceLimits:        []string{},
+		AutomountServiceAccountToken: wh.isServiceAccountTokenMounted(pod),
+	}
+	for i := range spec.Volumes {
+		if spec.Volumes[i].HostPath != nil {
+			posture.HostPaths = append(posture.HostPaths, spec.Volumes[i].HostPath.Path)
+		}
+	}
+	sort.Strings(posture.HostPaths)
+	containers := make([]core.Container, 0, len(spec.InitContainers)+len(spec.Containers))
+	containers = append(containers, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	for i := range containers {
+		container := &containers[i]
+		securityContext := container.SecurityContext
+		if securityContext == nil {
+			securityContext = &core.SecurityContext{}
+		}
+		if securityContext.Privileged != nil && *securityContext.Privileged {
+			posture.Privileged = append(posture.Privileged, container.Name)
+		}
+		if securityContext.Capabilities != nil && len(securityContext.Capabilities.Add) > 0 {
+			posture.AddedCapabilities[container.Name] = securityContext.Capabilities.Add
+		}
+		if !isRunAsNonRoot(spec.SecurityContext, securityContext) {
+			posture.RunAsNonRoot = false
+		}
+		if securityContext.ReadOnlyRootFilesystem == nil || !*securityContext.ReadOnlyRootFilesystem {
+			posture.ReadOnlyRootFilesystem = false
+		}
+		if container.Resources.Limits.Cpu().IsZero() || container.Resources.Limits.Memory().IsZero() {
+			posture.MissingResourceLimits = append(posture.MissingResourceLimits, container.Name)
+		}
+	}
+	return posture
+}
+
+// isRunAsNonRoot tells if the container must run as a non root user, the container settings override the pod ones
+func isRunAsNonRoot(podSecurityContext *core.PodSecurityContext, securityContext *core.SecurityContext) bool {
+	runAsNonRoot, runAsUser := securityContext.RunAsNonRoot, securityContext.RunAsUser
+	if podSecurityContext != nil {
+		if runAsNonRoot == nil {
+			runAsNonRoot = podSecurityContext.RunAsNonRoot
+		}
+		if runAsUser == nil {
+			runAsUser = podSecurityContext.RunAsUser
+		}
+	}
+	if runAsUser != nil {
+		return *runAsUser != 0
+	}
+	return runAsNonRoot != nil && *runAsNonRoot
+}
+
+// isServiceAccountTokenMounted tells if the token is mounted, the pod spec overrides the service account, and it's
+// mounted when neither sets it
+func (wh *WatchHandler) isServiceAccountTokenMounted(pod *core.Pod) bool {
+	if pod.Spec.AutomountServiceAccountToken != nil {
+		return *pod.Spec.AutomountServiceAccountToken
+	}
+	name := pod.Spec.ServiceAccountName
+	if name == "" {
+		name = defaultServiceAccountName
+	}
+	serviceAccount, err := wh.informerFactory.Core().V1().ServiceAccounts().Lister().ServiceAccounts(pod.Namespace).Get(name)
+	if err != nil || serviceAccount.AutomountServiceAccountToken == nil {
+		return true
+	}
+	return *serviceAccount.AutomountServiceAccountToken
+}
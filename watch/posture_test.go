@@ -0,0 +1,110 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestGetPostureSummary(t *testing.T) {
+	wh := newTestWatchHandler()
+	privileged, readOnly, nonRoot, root := true, true, true, int64(0)
+	limits := core.ResourceList{core.ResourceCPU: resource.MustParse("100m"), core.ResourceMemory: resource.MustParse("64Mi")}
+	pod := &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "default"},
+		Spec: core.PodSpec{
+			HostNetwork:     true,
+			SecurityContext: &core.PodSecurityContext{RunAsNonRoot: &nonRoot},
+			Volumes:         []core.Volume{{Name: "proc", VolumeSource: core.VolumeSource{HostPath: &core.HostPathVolumeSource{Path: "/proc"}}}},
+			InitContainers: []core.Container{{
+				Name:            "init",
+				SecurityContext: &core.SecurityContext{Privileged: &privileged, ReadOnlyRootFilesystem: &readOnly},
+				Resources:       core.ResourceRequirements{Limits: limits},
+			}},
+			Containers: []core.Container{{
+				Name:            "agent",
+				SecurityContext: &core.SecurityContext{ReadOnlyRootFilesystem: &readOnly, Capabilities: &core.Capabilities{Add: []core.Capability{"NET_ADMIN"}}},
+			}},
+		},
+	}
+	assert.Equal(t, &PostureSummary{
+		Privileged:                   []string{"init"},
+		HostNetwork:                  true,
+		HostPaths:                    []string{"/proc"},
+		AddedCapabilities:            map[string][]core.Capability{"agent": {"NET_ADMIN"}},
+		RunAsNonRoot:                 true,
+		ReadOnlyRootFilesystem:       true,
+		MissingResourceLimits:        []string{"agent"},
+		AutomountServiceAccountToken: true,
+	}, wh.getPostureSummary(pod))
+
+	// the container settings override the pod ones
+	pod.Spec.Containers[0].SecurityContext.RunAsUser = &root
+	pod.Spec.Containers = append(pod.Spec.Containers, core.Container{Name: "sidecar", Resources: core.ResourceRequirements{Limits: limits}})
+	posture := wh.getPostureSummary(pod)
+	assert.False(t, posture.RunAsNonRoot)
+	assert.False(t, posture.ReadOnlyRootFilesystem)
+	assert.Equal(t, []string{"agent"}, posture.MissingResourceLimits)
+}
+
+func TestServiceAccountUpdatesPosture(t *testing.T) {
+	automount := false
+	serviceAccount := &core.ServiceAccount{
+		ObjectMeta:                   metav1.ObjectMeta{Name: "default", Namespace: "default", ResourceVersion: "1"},
+		AutomountServiceAccountToken: &automount,
+	}
+	wh := newTestWatchHandler()
+	defer close(wh.stopChan)
+	informer := wh.informerFactory.Core().V1().ServiceAccounts().Informer()
+	wh.informerFactory.Start(wh.stopChan)
+	wh.informerFactory.WaitForCacheSync(wh.stopChan)
+	newTestMicroService(wh, 1, "default", "web", nil)
+
+	assert.NoError(t, informer.GetStore().Add(serviceAccount))
+	assert.NoError(t, wh.serviceAccountEventHandler(&watch.Event{Type: watch.Added, Object: serviceAccount.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Updated))
+	assert.False(t, wh.jsonReport.MicroServices.Updated[0].(MicroServiceData).Posture.AutomountServiceAccountToken)
+
+	// the microservice is reported only when its posture changes
+	serviceAccount.ResourceVersion = "2"
+	serviceAccount.Labels = map[string]string{"team": "web"}
+	assert.NoError(t, informer.GetStore().Update(serviceAccount))
+	assert.NoError(t, wh.serviceAccountEventHandler(&watch.Event{Type: watch.Modified, Object: serviceAccount.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.serviceaccountdm.getIDs()))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Updated))
+}
+
+func TestCronJobPosture(t *testing.T) {
+	automount := false
+	serviceAccount := &core.ServiceAccount{
+		ObjectMeta:                   metav1.ObjectMeta{Name: "default", Namespace: "default", ResourceVersion: "1"},
+		AutomountServiceAccountToken: &automount,
+	}
+	wh := newTestWatchHandler(serviceAccount)
+	defer close(wh.stopChan)
+	wh.informerFactory.Core().V1().ServiceAccounts().Informer()
+	wh.informerFactory.Start(wh.stopChan)
+	wh.informerFactory.WaitForCacheSync(wh.stopChan)
+
+	cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "default", ResourceVersion: "1"}}
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers = []core.Container{{Name: "report"}}
+	assert.NoError(t, wh.cronJobEventHandler(&watch.Event{Type: watch.Added, Object: cronJob.DeepCopy()}))
+	posture := wh.jsonReport.MicroServices.Created[0].(MicroServiceData).Posture
+	assert.False(t, posture.AutomountServiceAccountToken)
+	assert.Equal(t, []string{"report"}, posture.MissingResourceLimits)
+
+	// the pods of the changed template are a new microservice, with its own derived data
+	cronJob.ResourceVersion = "2"
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.HostNetwork = true
+	assert.NoError(t, wh.cronJobEventHandler(&watch.Event{Type: watch.Modified, Object: cronJob.DeepCopy()}))
+	msd := wh.jsonReport.MicroServices.Created[1].(MicroServiceData)
+	assert.True(t, msd.Posture.HostNetwork)
+	assert.False(t, msd.Posture.AutomountServiceAccountToken)
+	assert.NotNil(t, msd.NetworkPolicies)
+	assert.NotNil(t, msd.Capacity)
+}
@@ -0,0 +1,303 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// the groups every service account is a member of
+const (
+	allServiceAccountsGroup    = "system:serviceaccounts"
+	serviceAccountsGroupPrefix = "system:serviceaccounts:"
+	allAuthenticatedGroup      = "system:authenticated"
+	serviceAccountUserPrefix   = "system:serviceaccount:"
+	defaultServiceAccountName  = "default"
+)
+
+// ServiceAccountPermissions are the RBAC rules granted to the service account of a microservice
+type ServiceAccountPermissions struct {
+	ServiceAccountName string          `json:"serviceAccountName"`
+	Rules              []EffectiveRule `json:"rules"`
+}
+
+// EffectiveRule is a rule granted to a service account, with the role and the binding granting it
+type EffectiveRule struct {
+	rbacv1.PolicyRule `json:",inline"`
+	// Namespace is where the rule applies, empty when it applies to the whole cluster
+	Namespace   string `json:"namespace,omitempty"`
+	RoleKind    string `json:"roleKind"`
+	RoleName    string `json:"roleName"`
+	BindingKind string `json:"bindingKind"`
+	BindingName string `json:"bindingName"`
+}
+
+// RoleWatch watch over roles
+func (wh *WatchHandler) RoleWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER RoleWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over roles starting")
+	roleWatcher := wh.watchInformer(wh.informerFactory.Rbac().V1().Roles().Informer(), "role")
+	glog.Infof("Watching over roles started")
+	wh.handleInformerEvents(roleWatcher, "role", wh.roleEventHandler)
+}
+
+// ClusterRoleWatch watch over cluster roles
+func (wh *WatchHandler) ClusterRoleWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER ClusterRoleWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over cluster roles starting")
+	clusterRoleWatcher := wh.watchInformer(wh.informerFactory.Rbac().V1().ClusterRoles().Informer(), "clusterrole")
+	glog.Infof("Watching over cluster roles started")
+	wh.handleInformerEvents(clusterRoleWatcher, "clusterrole", wh.clusterRoleEventHandler)
+}
+
+// RoleBindingWatch watch over role bindings
+func (wh *WatchHandler) RoleBindingWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER RoleBindingWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over role bindings starting")
+	roleBindingWatcher := wh.watchInformer(wh.informerFactory.Rbac().V1().RoleBindings().Informer(), "rolebinding")
+	glog.Infof("Watching over role bindings started")
+	wh.handleInformerEvents(roleBindingWatcher, "rolebinding", wh.roleBindingEventHandler)
+}
+
+// ClusterRoleBindingWatch watch over cluster role bindings
+func (wh *WatchHandler) ClusterRoleBindingWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER ClusterRoleBindingWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over cluster role bindings starting")
+	clusterRoleBindingWatcher := wh.watchInformer(wh.informerFactory.Rbac().V1().ClusterRoleBindings().Informer(), "clusterrolebinding")
+	glog.Infof("Watching over cluster role bindings started")
+	wh.handleInformerEvents(clusterRoleBindingWatcher, "clusterrolebinding", wh.clusterRoleBindingEventHandler)
+}
+
+// ServiceAccountWatch watch over service accounts
+func (wh *WatchHandler) ServiceAccountWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER ServiceAccountWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over service accounts starting")
+	serviceAccountWatcher := wh.watchInformer(wh.informerFactory.Core().V1().ServiceAccounts().Informer(), "serviceaccount")
+	glog.Infof("Watching over service accounts started")
+	wh.handleInformerEvents(serviceAccountWatcher, "serviceaccount", wh.serviceAccountEventHandler)
+}
+
+func (wh *WatchHandler) roleEventHandler(event *watch.Event) error {
+	role, ok := event.Object.(*rbacv1.Role)
+	if !ok {
+		return fmt.Errorf("got unexpected role from chan")
+	}
+	if wh.reportObjectEvent("role", event.Type, role, wh.roledm, ROLES, isRoleChanged) {
+		wh.updateServiceAccountPermissions(role.Namespace)
+	}
+	return nil
+}
+
+func (wh *WatchHandler) clusterRoleEventHandler(event *watch.Event) error {
+	clusterRole, ok := event.Object.(*rbacv1.ClusterRole)
+	if !ok {
+		return fmt.Errorf("got unexpected cluster role from chan")
+	}
+	if wh.reportObjectEvent("cluster role", event.Type, clusterRole, wh.clusterroledm, CLUSTERROLES, isClusterRoleChanged) {
+		wh.updateServiceAccountPermissions("")
+	}
+	return nil
+}
+
+func (wh *WatchHandler) roleBindingEventHandler(event *watch.Event) error {
+	roleBinding, ok := event.Object.(*rbacv1.RoleBinding)
+	if !ok {
+		return fmt.Errorf("got unexpected role binding from chan")
+	}
+	if wh.reportObjectEvent("role binding", event.Type, roleBinding, wh.rolebindingdm, ROLEBINDINGS, isRoleBindingChanged) {
+		wh.updateServiceAccountPermissions(roleBinding.Namespace)
+	}
+	return nil
+}
+
+func (wh *WatchHandler) clusterRoleBindingEventHandler(event *watch.Event) error {
+	clusterRoleBinding, ok := event.Object.(*rbacv1.ClusterRoleBinding)
+	if !ok {
+		return fmt.Errorf("got unexpected cluster role binding from chan")
+	}
+	if wh.reportObjectEvent("cluster role binding", event.Type, clusterRoleBinding, wh.clusterrolebindingdm, CLUSTERROLEBINDINGS, isClusterRoleBindingChanged) {
+		wh.updateServiceAccountPermissions("")
+	}
+	return nil
+}
+
+func (wh *WatchHandler) serviceAccountEventHandler(event *watch.Event) error {
+	serviceAccount, ok := event.Object.(*core.ServiceAccount)
+	if !ok {
+		return fmt.Errorf("got unexpected service account from chan")
+	}
+	if wh.reportObjectEvent("service account", event.Type, serviceAccount, wh.serviceaccountdm, SERVICEACCOUNTS, isServiceAccountChanged) {
+		// the service account tells if its token is mounted in the pods
+		wh.updatePostureSummaries(serviceAccount.Namespace)
+	}
+	return nil
+}
+
+// updateServiceAccountPermissions updates the permissions of the microservices of the namespace, of all the namespaces
+// when it's empty
+func (wh *WatchHandler) updateServiceAccountPermissions(namespace string) {
+	wh.updateMicroServices(namespace, func(msd *MicroServiceData) bool {
+		permissions := wh.getServiceAccountPermissions(msd.Pod)
+		if reflect.DeepEqual(permissions, msd.ServiceAccountPermissions) {
+			return false
+		}
+		msd.ServiceAccountPermissions = permissions
+		return true
+	})
+}
+
+// getServiceAccountPermissions returns the rules granted to the service account of the pod, from the informers cache.
+// The rules of the cluster role bindings come first, each binding in the order of its name
+func (wh *WatchHandler) getServiceAccountPermissions(pod *core.Pod) *ServiceAccountPermissions {
+	name := pod.Spec.ServiceAccountName
+	if name == "" {
+		name = defaultServiceAccountName
+	}
+	permissions := &ServiceAccountPermissions{ServiceAccountName: name, Rules: []EffectiveRule{}}
+	rbacInformers := wh.informerFactory.Rbac().V1()
+
+	clusterRoleBindings, err := rbacInformers.ClusterRoleBindings().Lister().List(labels.Everything())
+	if err != nil {
+		glog.Errorf("failed to list cluster role bindings: %s", err.Error())
+	}
+	sort.Slice(clusterRoleBindings, func(i, j int) bool { return clusterRoleBindings[i].Name < clusterRoleBindings[j].Name })
+	for _, binding := range clusterRoleBindings {
+		if isServiceAccountSubject(binding.Subjects, "", pod.Namespace, name) {
+			permissions.Rules = append(permissions.Rules, wh.getRoleRules(binding.RoleRef, "", "ClusterRoleBinding", binding.Name)...)
+		}
+	}
+
+	roleBindings, err := rbacInformers.RoleBindings().Lister().RoleBindings(pod.Namespace).List(labels.Everything())
+	if err != nil {
+		glog.Errorf("failed to list role bindings of namespace %s: %s", pod.Namespace, err.Error())
+	}
+	sort.Slice(roleBindings, func(i, j int) bool { return roleBindings[i].Name < roleBindings[j].Name })
+	for _, binding := range roleBindings {
+		if isServiceAccountSubject(binding.Subjects, binding.Namespace, pod.Namespace, name) {
+			permissions.Rules = append(permissions.Rules, wh.getRoleRules(binding.RoleRef, binding.Namespace, "RoleBinding", binding.Name)...)
+		}
+	}
+	return permissions
+}
+
+// getRoleRules returns the rules of the role a binding refers to. A cluster role bound by a role binding applies to the
+// namespace of the binding only
+func (wh *WatchHandler) getRoleRules(roleRef rbacv1.RoleRef, namespace, bindingKind, bindingName string) []EffectiveRule {
+	var rules []rbacv1.PolicyRule
+	switch roleRef.Kind {
+	case "Role":
+		role, err := wh.informerFactory.Rbac().V1().Roles().Lister().Roles(namespace).Get(roleRef.Name)
+		if err != nil {
+			return nil
+		}
+		rules = role.Rules
+	case "ClusterRole":
+		clusterRole, err := wh.informerFactory.Rbac().V1().ClusterRoles().Lister().Get(roleRef.Name)
+		if err != nil {
+			return nil
+		}
+		rules = clusterRole.Rules
+	default:
+		return nil
+	}
+	effectiveRules := make([]EffectiveRule, 0, len(rules))
+	for i := range rules {
+		effectiveRules = append(effectiveRules, EffectiveRule{
+			PolicyRule:  rules[i],
+			Namespace:   namespace,
+			RoleKind:    roleRef.Kind,
+			RoleName:    roleRef.Name,
+			BindingKind: bindingKind,
+			BindingName: bindingName,
+		})
+	}
+	return effectiveRules
+}
+
+// isServiceAccountSubject tells if the service account is one of the subjects of a binding, by itself, by its user
+// name or by one of its groups
+func isServiceAccountSubject(subjects []rbacv1.Subject, bindingNamespace, namespace, name string) bool {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			subjectNamespace := subject.Namespace
+			if subjectNamespace == "" {
+				subjectNamespace = bindingNamespace
+			}
+			if subject.Name == name && subjectNamespace == namespace {
+				return true
+			}
+		case rbacv1.UserKind:
+			if subject.Name == serviceAccountUserPrefix+namespace+":"+name {
+				return true
+			}
+		case rbacv1.GroupKind:
+			if subject.Name == allServiceAccountsGroup || subject.Name == serviceAccountsGroupPrefix+namespace || subject.Name == allAuthenticatedGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isRoleChanged(oldObj, newObj watchedObject) bool {
+	oldRole, newRole := oldObj.(*rbacv1.Role), newObj.(*rbacv1.Role)
+	return isObjectMetaChanged(&oldRole.ObjectMeta, &newRole.ObjectMeta) ||
+		!reflect.DeepEqual(oldRole.Rules, newRole.Rules)
+}
+
+func isClusterRoleChanged(oldObj, newObj watchedObject) bool {
+	oldClusterRole, newClusterRole := oldObj.(*rbacv1.ClusterRole), newObj.(*rbacv1.ClusterRole)
+	return isObjectMetaChanged(&oldClusterRole.ObjectMeta, &newClusterRole.ObjectMeta) ||
+		!reflect.DeepEqual(oldClusterRole.Rules, newClusterRole.Rules) ||
+		!reflect.DeepEqual(oldClusterRole.AggregationRule, newClusterRole.AggregationRule)
+}
+
+func isRoleBindingChanged(oldObj, newObj watchedObject) bool {
+	oldRoleBinding, newRoleBinding := oldObj.(*rbacv1.RoleBinding), newObj.(*rbacv1.RoleBinding)
+	return isObjectMetaChanged(&oldRoleBinding.ObjectMeta, &newRoleBinding.ObjectMeta) ||
+		!reflect.DeepEqual(oldRoleBinding.Subjects, newRoleBinding.Subjects) ||
+		oldRoleBinding.RoleRef != newRoleBinding.RoleRef
+}
+
+func isClusterRoleBindingChanged(oldObj, newObj watchedObject) bool {
+	oldClusterRoleBinding, newClusterRoleBinding := oldObj.(*rbacv1.ClusterRoleBinding), newObj.(*rbacv1.ClusterRoleBinding)
+	return isObjectMetaChanged(&oldClusterRoleBinding.ObjectMeta, &newClusterRoleBinding.ObjectMeta) ||
+		!reflect.DeepEqual(oldClusterRoleBinding.Subjects, newClusterRoleBinding.Subjects) ||
+		oldClusterRoleBinding.RoleRef != newClusterRoleBinding.RoleRef
+}
+
+func isServiceAccountChanged(oldObj, newObj watchedObject) bool {
+	oldServiceAccount, newServiceAccount := oldObj.(*core.ServiceAccount), newObj.(*core.ServiceAccount)
+	return isObjectMetaChanged(&oldServiceAccount.ObjectMeta, &newServiceAccount.ObjectMeta) ||
+		!reflect.DeepEqual(oldServiceAccount.Secrets, newServiceAccount.Secrets) ||
+		!reflect.DeepEqual(oldServiceAccount.ImagePullSecrets, newServiceAccount.ImagePullSecrets) ||
+		!reflect.DeepEqual(oldServiceAccount.AutomountServiceAccountToken, newServiceAccount.AutomountServiceAccountToken)
+}
@@ -0,0 +1,98 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestIsServiceAccountSubject(t *testing.T) {
+	assert.True(t, isServiceAccountSubject([]rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "web"}}, "default", "default", "web"))
+	assert.False(t, isServiceAccountSubject([]rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "web"}}, "other", "default", "web"))
+	assert.True(t, isServiceAccountSubject([]rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "web", Namespace: "default"}}, "", "default", "web"))
+	assert.True(t, isServiceAccountSubject([]rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "system:serviceaccount:default:web"}}, "", "default", "web"))
+	assert.True(t, isServiceAccountSubject([]rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:default"}}, "", "default", "web"))
+	assert.False(t, isServiceAccountSubject([]rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:other"}}, "", "default", "web"))
+	assert.False(t, isServiceAccountSubject([]rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "admin"}}, "", "default", "web"))
+}
+
+func TestServiceAccountPermissions(t *testing.T) {
+	readPods := rbacv1.PolicyRule{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}
+	readNodes := rbacv1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"nodes"}}
+	clusterRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "node-reader"}, Rules: []rbacv1.PolicyRule{readNodes}}
+	clusterRoleBinding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-node-reader"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "web", Namespace: "default"}},
+		RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "node-reader"},
+	}
+	role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "pod-reader", Namespace: "default"}, Rules: []rbacv1.PolicyRule{readPods}}
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-pod-reader", Namespace: "default"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "web"}},
+		RoleRef:    rbacv1.RoleRef{Kind: "Role", Name: "pod-reader"},
+	}
+	wh := newTestWatchHandler(clusterRole, clusterRoleBinding, role, roleBinding)
+	defer close(wh.stopChan)
+	rbacInformers := wh.informerFactory.Rbac().V1()
+	rbacInformers.ClusterRoles().Informer()
+	rbacInformers.ClusterRoleBindings().Informer()
+	rbacInformers.Roles().Informer()
+	rbacInformers.RoleBindings().Informer()
+	wh.informerFactory.Start(wh.stopChan)
+	wh.informerFactory.WaitForCacheSync(wh.stopChan)
+
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}, Spec: core.PodSpec{ServiceAccountName: "web"}}
+	assert.Equal(t, &ServiceAccountPermissions{
+		ServiceAccountName: "web",
+		Rules: []EffectiveRule{
+			{PolicyRule: readNodes, RoleKind: "ClusterRole", RoleName: "node-reader", BindingKind: "ClusterRoleBinding", BindingName: "web-node-reader"},
+			{PolicyRule: readPods, Namespace: "default", RoleKind: "Role", RoleName: "pod-reader", BindingKind: "RoleBinding", BindingName: "web-pod-reader"},
+		},
+	}, wh.getServiceAccountPermissions(pod))
+
+	other := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"}}
+	assert.Equal(t, &ServiceAccountPermissions{ServiceAccountName: "default", Rules: []EffectiveRule{}}, wh.getServiceAccountPermissions(other))
+
+	// the microservices are updated when the bindings change
+	newTestMicroService(wh, 1, "default", "web", nil)
+	msd := wh.pdm[1].Front().Value.(MicroServiceData)
+	msd.Pod.Spec.ServiceAccountName = "web"
+	wh.setMicroService(msd)
+	assert.NoError(t, wh.roleBindingEventHandler(&watch.Event{Type: watch.Added, Object: roleBinding.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.RoleBindings.Created))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Updated))
+	assert.Equal(t, 2, len(wh.jsonReport.MicroServices.Updated[0].(MicroServiceData).ServiceAccountPermissions.Rules))
+
+	assert.NoError(t, wh.roleBindingEventHandler(&watch.Event{Type: watch.Modified, Object: roleBinding.DeepCopy()}))
+	assert.Nil(t, wh.jsonReport.RoleBindings.Updated)
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Updated))
+
+	assert.NoError(t, rbacInformers.RoleBindings().Informer().GetStore().Delete(roleBinding))
+	assert.NoError(t, wh.roleBindingEventHandler(&watch.Event{Type: watch.Deleted, Object: roleBinding.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.RoleBindings.Deleted))
+	assert.Equal(t, 2, len(wh.jsonReport.MicroServices.Updated))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Updated[1].(MicroServiceData).ServiceAccountPermissions.Rules))
+	assert.Equal(t, 0, wh.rolebindingdm.len())
+}
+
+func TestServiceAccountEventHandler(t *testing.T) {
+	wh := newTestWatchHandler()
+	serviceAccount := &core.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", ResourceVersion: "1"}}
+	assert.NoError(t, wh.serviceAccountEventHandler(&watch.Event{Type: watch.Added, Object: serviceAccount.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.ServiceAccounts.Created))
+
+	automount := false
+	changed := serviceAccount.DeepCopy()
+	changed.ResourceVersion = "2"
+	changed.AutomountServiceAccountToken = &automount
+	assert.NoError(t, wh.serviceAccountEventHandler(&watch.Event{Type: watch.Modified, Object: changed}))
+	assert.Equal(t, 1, len(wh.jsonReport.ServiceAccounts.Updated))
+
+	assert.NoError(t, wh.serviceAccountEventHandler(&watch.Event{Type: watch.Deleted, Object: changed.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.ServiceAccounts.Deleted))
+	assert.Equal(t, 0, wh.serviceaccountdm.len())
+}
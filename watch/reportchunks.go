@@ -0,0 +1,130 @@
+package watch
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+)
+
+// reportChunkOverhead is the size of the keys and brackets around the objects of a kind in a chunk
+const reportChunkOverhead = 64
+
+// splitObjects appends the objects of data to new chunks of up to maxSize, set puts the objects into a chunk
+func splitObjects(chunks []*jsonFormat, data *ObjectData, newChunk func() *jsonFormat, chunkBaseSize, maxSize int, set func(chunk *jsonFormat, data *ObjectData)) ([]*jsonFormat, error) {
+	var chunkData *ObjectData
+	size := 0
+	for _, stype := range []StateType{CREATED, DELETED, UPDATED} {
+		for _, obj := range data.byState(stype) {
+			rawObj, err := json.Marshal(obj)
+			if err != nil {
+				return nil, err
+			}
+			if chunkBaseSize+len(rawObj) > maxSize {
+				glog.Warningf("object of %d bytes is bigger than the maximum report size", len(rawObj))
+			}
+			if chunkData == nil || size+len(rawObj)+1 > maxSize {
+				chunk := newChunk()
+				chunkData = &ObjectData{}
+				set(chunk, chunkData)
+				chunks = append(chunks, chunk)
+				size = chunkBaseSize
+			}
+			chunkData.AddToJsonFormatByState(json.RawMessage(rawObj), stype)
+			size += len(rawObj) + 1
+		}
+	}
+	return chunks, nil
+}
+
+// marshalReports marshals the report, numbered after lastSequenceNumber. A report bigger than maxSize is split into
+// chunks, every chunk has its own sequence number, and they all share a report ID and carry their part number
+func (jsonReport *jsonFormat) marshalReports(lastSequenceNumber uint64, maxSize int) ([][]byte, error) {
+	jsonReport.SequenceNumber = lastSequenceNumber + 1
+	report, err := json.Marshal(jsonReport)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 || len(report) <= maxSize {
+		return [][]byte{report}, nil
+	}
+
+	chunks, err := jsonReport.split(maxSize)
+	if err != nil {
+		return nil, err
+	}
+	reportID := uuid.NewString()
+	reports := make([][]byte, 0, len(chunks))
+	for i := range chunks {
+		chunks[i].ReportID = reportID
+		chunks[i].PartNum = i + 1
+		chunks[i].PartsCount = len(chunks)
+		chunks[i].SequenceNumber = lastSequenceNumber + uint64(i) + 1
+		chunk, err := json.Marshal(chunks[i])
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, chunk)
+	}
+	glog.Infof("report %s of %d bytes is split into %d chunks", reportID, len(report), len(chunks))
+	return reports, nil
+}
+
+func (jsonReport *jsonFormat) newChunk() *jsonFormat {
+	return &jsonFormat{
+		SessionID:   jsonReport.SessionID,
+		FirstReport: jsonReport.FirstReport,
+	}
+}
+
+// split puts the objects of the report into chunks of up to maxSize, each chunk holds the objects of a single kind or resource.
+// An object bigger than maxSize gets a chunk of its own
+func (jsonReport *jsonFormat) split(maxSize int) ([]*jsonFormat, error) {
+	// the header of the biggest chunk, with the cluster info and the chunk fields
+	header := jsonReport.newChunk()
+	header.ClusterAPIServerVersion = jsonReport.ClusterAPIServerVersion
+	header.CloudVendor = jsonReport.CloudVendor
+	header.SequenceNumber = math.MaxUint64
+	header.ReportID = uuid.Nil.String()
+	header.PartNum = math.MaxInt32
+	header.PartsCount = math.MaxInt32
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	chunkBaseSize := len(headerData) + reportChunkOverhead
+
+	var chunks []*jsonFormat
+	for _, jtype := range reportKinds {
+		jtype := jtype
+		chunks, err = splitObjects(chunks, *jsonReport.objectData(jtype), jsonReport.newChunk, chunkBaseSize, maxSize, func(chunk *jsonFormat, data *ObjectData) {
+			*chunk.objectData(jtype) = data
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	resources := make([]string, 0, len(jsonReport.Resources))
+	for resource := range jsonReport.Resources {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		resource := resource
+		chunks, err = splitObjects(chunks, jsonReport.Resources[resource], jsonReport.newChunk, chunkBaseSize+len(resource), maxSize, func(chunk *jsonFormat, data *ObjectData) {
+			chunk.Resources = map[string]*ObjectData{resource: data}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(chunks) == 0 {
+		chunks = append(chunks, jsonReport.newChunk())
+	}
+	// the cluster info is sent once, with the first chunk
+	chunks[0].ClusterAPIServerVersion = jsonReport.ClusterAPIServerVersion
+	chunks[0].CloudVendor = jsonReport.CloudVendor
+	return chunks, nil
+}
@@ -0,0 +1,71 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+func TestMarshalReports(t *testing.T) {
+	jsonReport := jsonFormat{SessionID: "session", FirstReport: true, ClusterAPIServerVersion: &version.Info{GitVersion: "v1.24.3"}}
+	for i := 0; i < 20; i++ {
+		jsonReport.AddToJsonFormat(map[string]string{"name": fmt.Sprintf("pod-%02d", i), "padding": "0123456789012345678901234567890123456789"}, PODS, CREATED)
+	}
+	jsonReport.AddToJsonFormat(map[string]string{"name": "node"}, NODE, UPDATED)
+
+	reports, err := jsonReport.marshalReports(10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(reports), "no limit")
+
+	reports, err = jsonReport.marshalReports(10, 1000)
+	assert.NoError(t, err)
+	assert.Greater(t, len(reports), 2)
+
+	pods := 0
+	reportID := ""
+	for i := range reports {
+		assert.LessOrEqual(t, len(reports[i]), 1000)
+		chunk := jsonFormat{}
+		assert.NoError(t, json.Unmarshal(reports[i], &chunk))
+		assert.Equal(t, i+1, chunk.PartNum)
+		assert.Equal(t, len(reports), chunk.PartsCount)
+		assert.Equal(t, uint64(11+i), chunk.SequenceNumber)
+		assert.Equal(t, "session", chunk.SessionID)
+		assert.True(t, chunk.FirstReport)
+		if i == 0 {
+			reportID = chunk.ReportID
+			assert.NotNil(t, chunk.ClusterAPIServerVersion)
+			assert.Equal(t, 1, chunk.Nodes.Len())
+			assert.Nil(t, chunk.Pods, "a chunk holds a single kind")
+		} else {
+			assert.Nil(t, chunk.ClusterAPIServerVersion)
+			pods += chunk.Pods.Len()
+		}
+		assert.Equal(t, reportID, chunk.ReportID)
+	}
+	assert.Equal(t, 20, pods)
+}
+
+func TestMarshalReportsResources(t *testing.T) {
+	jsonReport := jsonFormat{SessionID: "session"}
+	for i := 0; i < 10; i++ {
+		jsonReport.AddResourceToJsonFormat("argoproj.io/v1alpha1/rollouts", map[string]string{"name": fmt.Sprintf("rollout-%02d", i), "padding": "0123456789012345678901234567890123456789"}, CREATED)
+	}
+	jsonReport.AddResourceToJsonFormat("cert-manager.io/v1/certificates", map[string]string{"name": "certificate"}, UPDATED)
+
+	reports, err := jsonReport.marshalReports(0, 600)
+	assert.NoError(t, err)
+	assert.Greater(t, len(reports), 2)
+	rollouts := 0
+	for i := range reports {
+		assert.LessOrEqual(t, len(reports[i]), 600)
+		chunk := jsonFormat{}
+		assert.NoError(t, json.Unmarshal(reports[i], &chunk))
+		assert.Equal(t, 1, len(chunk.Resources), "a chunk holds a single resource")
+		rollouts += chunk.Resources["argoproj.io/v1alpha1/rollouts"].Len()
+	}
+	assert.Equal(t, 10, rollouts)
+}
@@ -0,0 +1,118 @@
+package watch
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const mergePatchType = "merge"
+
+// ObjectDelta is reported instead of an updated object when delta mode is on. The patch is a JSON merge patch (RFC 7386)
+// to apply on the version of the object with the base resourceVersion, which is the version reported before. The
+// microservices are identified by their podSpecId, and versioned by their revision
+type ObjectDelta struct {
+	UID                 types.UID       `json:"uid"`
+	PodSpecId           int             `json:"podSpecId,omitempty"`
+	Name                string          `json:"name"`
+	Namespace           string          `json:"namespace,omitempty"`
+	ResourceVersion     string          `json:"resourceVersion"`
+	BaseResourceVersion string          `json:"baseResourceVersion"`
+	PatchType           string          `json:"patchType"`
+	Patch               json.RawMessage `json:"patch"`
+}
+
+type reportedObject struct {
+	resourceVersion string
+	data            []byte
+}
+
+// reportDeltas keeps the last reported version of every object, per kind and UID, or pod spec ID for the microservices
+type reportDeltas struct {
+	reported map[JsonType]map[string]reportedObject
+	// revision is the last revision of the reported microservices
+	revision uint64
+	mutex    sync.Mutex
+}
+
+func newReportDeltas() *reportDeltas {
+	return &reportDeltas{reported: make(map[JsonType]map[string]reportedObject)}
+}
+
+// reset forgets all reported objects, so the next report of each object is the full object
+func (rd *reportDeltas) reset() {
+	if rd == nil {
+		return
+	}
+	rd.mutex.Lock()
+	defer rd.mutex.Unlock()
+	rd.reported = make(map[JsonType]map[string]reportedObject)
+}
+
+// toReport returns what to report for the object: the full object when it's reported for the first time,
+// a delta against the previously reported version on updates
+func (rd *reportDeltas) toReport(data interface{}, jtype JsonType, stype StateType) interface{} {
+	if rd == nil {
+		return data
+	}
+	msd, isMicroService := data.(MicroServiceData)
+	if isMicroService && msd.Pod == nil {
+		return data
+	}
+	objMeta, err := meta.Accessor(data)
+	if err != nil || (objMeta.GetUID() == "" && !isMicroService) {
+		// objects without identity are always reported in full
+		return data
+	}
+	key := string(objMeta.GetUID())
+	if isMicroService {
+		// the microservice of a template outlives its pods
+		key = strconv.Itoa(msd.PodSpecId)
+	}
+	rd.mutex.Lock()
+	defer rd.mutex.Unlock()
+	if rd.reported[jtype] == nil {
+		rd.reported[jtype] = make(map[string]reportedObject)
+	}
+	if stype == DELETED {
+		delete(rd.reported[jtype], key)
+		return data
+	}
+	resourceVersion := objMeta.GetResourceVersion()
+	if isMicroService {
+		rd.revision++
+		msd.Revision = strconv.FormatUint(rd.revision, 10)
+		resourceVersion = msd.Revision
+		data = msd
+	}
+	current, err := json.Marshal(data)
+	if err != nil {
+		glog.Errorf("failed to marshal %s for delta report: %s", objMeta.GetName(), err.Error())
+		return data
+	}
+	previous, ok := rd.reported[jtype][key]
+	rd.reported[jtype][key] = reportedObject{resourceVersion: resourceVersion, data: current}
+	if stype != UPDATED || !ok {
+		return data
+	}
+	patch, err := jsonpatch.CreateMergePatch(previous.data, current)
+	if err != nil {
+		glog.Errorf("failed to create patch of %s, reporting the full object: %s", objMeta.GetName(), err.Error())
+		return data
+	}
+	return ObjectDelta{
+		UID:                 objMeta.GetUID(),
+		PodSpecId:           msd.PodSpecId,
+		Name:                objMeta.GetName(),
+		Namespace:           objMeta.GetNamespace(),
+		ResourceVersion:     resourceVersion,
+		BaseResourceVersion: previous.resourceVersion,
+		PatchType:           mergePatchType,
+		Patch:               patch,
+	}
+}
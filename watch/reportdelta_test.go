@@ -0,0 +1,116 @@
+package watch
+
+import (
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReportDeltas(t *testing.T) {
+	report := jsonFormat{deltas: newReportDeltas()}
+	service := &core.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: "1234", ResourceVersion: "1"},
+		Spec:       core.ServiceSpec{Ports: []core.ServicePort{{Port: 80}}},
+	}
+	report.AddToJsonFormat(service.DeepCopy(), SERVICES, CREATED)
+	assert.IsType(t, &core.Service{}, report.Services.Created[0], "first report is the full object")
+
+	updated := service.DeepCopy()
+	updated.ResourceVersion = "2"
+	updated.Spec.Ports[0].Port = 8080
+	report.AddToJsonFormat(updated.DeepCopy(), SERVICES, UPDATED)
+	delta, ok := report.Services.Updated[0].(ObjectDelta)
+	assert.True(t, ok, "update should be reported as delta")
+	assert.Equal(t, "1", delta.BaseResourceVersion)
+	assert.Equal(t, "2", delta.ResourceVersion)
+	assert.Equal(t, mergePatchType, delta.PatchType)
+
+	// applying the patch on the reported version gives the updated object
+	original, _ := json.Marshal(service)
+	patched, err := jsonpatch.MergePatch(original, delta.Patch)
+	assert.NoError(t, err)
+	patchedService := core.Service{}
+	assert.NoError(t, json.Unmarshal(patched, &patchedService))
+	assert.Equal(t, int32(8080), patchedService.Spec.Ports[0].Port)
+	assert.Equal(t, "2", patchedService.ResourceVersion)
+
+	// after a resync the full object is reported again
+	report.deltas.reset()
+	report.AddToJsonFormat(updated.DeepCopy(), SERVICES, UPDATED)
+	assert.IsType(t, &core.Service{}, report.Services.Updated[1])
+
+	report.AddToJsonFormat(updated.DeepCopy(), SERVICES, DELETED)
+	report.AddToJsonFormat(updated.DeepCopy(), SERVICES, UPDATED)
+	assert.IsType(t, &core.Service{}, report.Services.Updated[2], "deleted objects are forgotten")
+}
+
+func TestReportDeltasDisabled(t *testing.T) {
+	report := jsonFormat{}
+	service := &core.Service{ObjectMeta: metav1.ObjectMeta{Name: "nginx", UID: "1234", ResourceVersion: "1"}}
+	report.AddToJsonFormat(service, SERVICES, CREATED)
+	report.AddToJsonFormat(service, SERVICES, UPDATED)
+	assert.Equal(t, service, report.Services.Updated[0])
+
+	// objects without UID are reported in full
+	report.deltas = newReportDeltas()
+	report.AddToJsonFormat(&NodeData{Name: "node-1"}, NODE, CREATED)
+	report.AddToJsonFormat(&NodeData{Name: "node-1"}, NODE, UPDATED)
+	assert.IsType(t, &NodeData{}, report.Nodes.Updated[0])
+}
+
+func TestReportDeltasDroppedReports(t *testing.T) {
+	report := jsonFormat{deltas: newReportDeltas()}
+	spool, err := newReportSpool(&spoolConfig{})
+	assert.NoError(t, err)
+	spool.onDrop = report.deltas.reset
+	spool.maxSize = 1
+	service := &core.Service{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: "1234", ResourceVersion: "1"}}
+	report.AddToJsonFormat(service.DeepCopy(), SERVICES, CREATED)
+	assert.NoError(t, spool.push([]byte("created")))
+
+	// the report of the created service is dropped, the update is not a delta against it
+	assert.NoError(t, spool.push([]byte("next")))
+	updated := service.DeepCopy()
+	updated.ResourceVersion = "2"
+	report.AddToJsonFormat(updated, SERVICES, UPDATED)
+	assert.IsType(t, &core.Service{}, report.Services.Updated[0])
+}
+
+func TestReportDeltasMicroServices(t *testing.T) {
+	report := jsonFormat{deltas: newReportDeltas()}
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", UID: "1234", ResourceVersion: "1"}}
+	msd := MicroServiceData{Pod: pod, PodSpecId: 7}
+	report.AddToJsonFormat(msd, MICROSERVICES, CREATED)
+	created, ok := report.MicroServices.Created[0].(MicroServiceData)
+	assert.True(t, ok, "first report is the full object")
+	assert.Equal(t, "1", created.Revision)
+
+	// the derived data changed, the pod didn't
+	msd.Volumes = []VolumeData{{Name: "data", Type: "emptyDir"}}
+	report.AddToJsonFormat(msd, MICROSERVICES, UPDATED)
+	delta, ok := report.MicroServices.Updated[0].(ObjectDelta)
+	assert.True(t, ok, "update should be reported as delta")
+	assert.Equal(t, 7, delta.PodSpecId)
+	assert.Equal(t, "1", delta.BaseResourceVersion)
+	assert.Equal(t, "2", delta.ResourceVersion)
+	original, _ := json.Marshal(created)
+	patched, err := jsonpatch.MergePatch(original, delta.Patch)
+	assert.NoError(t, err)
+	patchedMicroService := MicroServiceData{}
+	assert.NoError(t, json.Unmarshal(patched, &patchedMicroService))
+	assert.Equal(t, msd.Volumes, patchedMicroService.Volumes)
+	assert.Equal(t, "2", patchedMicroService.Revision)
+
+	// the microservice is reported with the spec of another pod, it's still the same microservice
+	msd.Pod = &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-2", Namespace: "default", UID: "5678", ResourceVersion: "1"}}
+	report.AddToJsonFormat(msd, MICROSERVICES, UPDATED)
+	delta, ok = report.MicroServices.Updated[1].(ObjectDelta)
+	assert.True(t, ok)
+	assert.Equal(t, 7, delta.PodSpecId)
+	assert.Equal(t, "2", delta.BaseResourceVersion)
+	assert.Equal(t, "3", delta.ResourceVersion)
+}
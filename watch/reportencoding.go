@@ -0,0 +1,143 @@
+package watch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	encodingQueryParamKey    = "encoding"
+	compressionQueryParamKey = "compression"
+)
+
+const (
+	jsonReportFormat      = "json"
+	cborReportFormat      = "cbor"
+	gzipReportCompression = "gzip"
+)
+
+// reportEncoding is the encoding of the reports on the event receiver websocket. The reports keep the JSON data model
+// in every format, so the server decodes jsonFormat, MicroServiceData, PodDataForExistMicroService and NodeData
+// with the same field names
+type reportEncoding struct {
+	// Format of the reports, json or cbor. Default: json
+	Format string `json:"format,omitempty"`
+	// Compression of the reports payload, gzip or none. Default: none
+	Compression string `json:"compression,omitempty"`
+	// PermessageDeflate negotiates the websocket compression extension
+	PermessageDeflate bool `json:"permessageDeflate,omitempty"`
+}
+
+func (encoding *reportEncoding) validate() error {
+	switch encoding.Format {
+	case "", jsonReportFormat, cborReportFormat:
+	default:
+		return fmt.Errorf("unknown report format '%s'", encoding.Format)
+	}
+	switch encoding.Compression {
+	case "", "none", gzipReportCompression:
+	default:
+		return fmt.Errorf("unknown report compression '%s'", encoding.Compression)
+	}
+	return nil
+}
+
+func (encoding *reportEncoding) isCBOR() bool {
+	return encoding.Format == cborReportFormat
+}
+
+func (encoding *reportEncoding) isGzip() bool {
+	return encoding.Compression == gzipReportCompression
+}
+
+// addQueryParams advertises the encoding to the server
+func (encoding *reportEncoding) addQueryParams(q url.Values) {
+	if encoding.isCBOR() {
+		q.Add(encodingQueryParamKey, cborReportFormat)
+	}
+	if encoding.isGzip() {
+		q.Add(compressionQueryParamKey, gzipReportCompression)
+	}
+}
+
+// encode encodes a JSON report, and returns it with the type of the websocket message carrying it
+func (encoding *reportEncoding) encode(report []byte) ([]byte, int, error) {
+	messageType := websocket.TextMessage
+	var err error
+	if encoding.isCBOR() {
+		if report, err = jsonToCBOR(report); err != nil {
+			return nil, 0, fmt.Errorf("failed to encode report as cbor: %s", err.Error())
+		}
+		messageType = websocket.BinaryMessage
+	}
+	if encoding.isGzip() {
+		buf := &bytes.Buffer{}
+		writer := gzip.NewWriter(buf)
+		if _, err := writer.Write(report); err != nil {
+			return nil, 0, fmt.Errorf("failed to compress report: %s", err.Error())
+		}
+		if err := writer.Close(); err != nil {
+			return nil, 0, fmt.Errorf("failed to compress report: %s", err.Error())
+		}
+		report = buf.Bytes()
+		messageType = websocket.BinaryMessage
+	}
+	return report, messageType, nil
+}
+
+// cborEncMode is the core deterministic encoding of RFC 8949: the map keys are sorted, so equal documents are
+// encoded the same, and the floats are in their shortest exact form
+var cborEncMode, _ = cbor.CoreDetEncOptions().EncMode()
+
+// jsonToCBOR encodes a JSON document as CBOR (RFC 8949)
+func jsonToCBOR(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	value, err := cborValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return cborEncMode.Marshal(value)
+}
+
+// cborValue replaces the JSON numbers of the value by integers when they are, and by floats otherwise
+func cborValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return u, nil
+		}
+		return v.Float64()
+	case []interface{}:
+		for i := range v {
+			item, err := cborValue(v[i])
+			if err != nil {
+				return nil, err
+			}
+			v[i] = item
+		}
+	case map[string]interface{}:
+		for key := range v {
+			item, err := cborValue(v[key])
+			if err != nil {
+				return nil, err
+			}
+			v[key] = item
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,102 @@
+package watch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"math"
+	"net/url"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJsonToCBOR(t *testing.T) {
+	// RFC 8949 appendix A examples
+	tests := map[string]string{
+		`0`:                        "00",
+		`23`:                       "17",
+		`24`:                       "1818",
+		`1000`:                     "1903e8",
+		`1000000`:                  "1a000f4240",
+		`1000000000000`:            "1b000000e8d4a51000",
+		`18446744073709551615`:     "1bffffffffffffffff",
+		`-1`:                       "20",
+		`-1000`:                    "3903e7",
+		`1.1`:                      "fb3ff199999999999a",
+		`false`:                    "f4",
+		`true`:                     "f5",
+		`null`:                     "f6",
+		`"IETF"`:                   "6449455446",
+		`[1,[2,3],[4,5]]`:          "8301820203820405",
+		`{"b":[2,3],"a":1}`:        "a26161016162820203",
+		`{"a":"A","b":"B","c":""}`: "a36161614161626142616360",
+		// the shortest keys first, and the floats in their shortest exact form
+		`{"aa":1,"b":2}`: "a261620262616101",
+		`0.5`:            "f93800",
+	}
+	for jsonValue, expected := range tests {
+		cbor, err := jsonToCBOR([]byte(jsonValue))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, hex.EncodeToString(cbor), jsonValue)
+	}
+	_, err := jsonToCBOR([]byte(`{"a":`))
+	assert.Error(t, err)
+}
+
+func TestJsonToCBORReferenceDecoder(t *testing.T) {
+	tests := map[string]interface{}{
+		`1.1`:                     1.1,
+		`0.5`:                     0.5,
+		`-2.5e-7`:                 -2.5e-7,
+		`1e300`:                   1e300,
+		`-1`:                      int64(-1),
+		`-1000`:                   int64(-1000),
+		`-9223372036854775808`:    int64(math.MinInt64),
+		`9223372036854775807`:     uint64(math.MaxInt64),
+		`9223372036854775808`:     uint64(math.MaxInt64 + 1),
+		`18446744073709551615`:    uint64(math.MaxUint64),
+		`18446744073709551616`:    float64(math.MaxUint64),
+		`-9223372036854775809`:    float64(math.MinInt64),
+		`{"a":[-1,2.5,"x",null]}`: map[interface{}]interface{}{"a": []interface{}{int64(-1), 2.5, "x", nil}},
+	}
+	for jsonValue, expected := range tests {
+		data, err := jsonToCBOR([]byte(jsonValue))
+		assert.NoError(t, err)
+		var decoded interface{}
+		assert.NoError(t, cbor.Unmarshal(data, &decoded), jsonValue)
+		assert.Equal(t, expected, decoded, jsonValue)
+	}
+}
+
+func TestReportEncoding(t *testing.T) {
+	report := []byte(`{"firstReport":true}`)
+
+	encoding := reportEncoding{}
+	assert.NoError(t, encoding.validate())
+	data, messageType, err := encoding.encode(report)
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, messageType)
+	assert.Equal(t, report, data)
+
+	encoding = reportEncoding{Format: cborReportFormat, Compression: gzipReportCompression}
+	assert.NoError(t, encoding.validate())
+	data, messageType, err = encoding.encode(report)
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.BinaryMessage, messageType)
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	cbor, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "a16b66697273745265706f7274f5", hex.EncodeToString(cbor))
+
+	q := url.Values{}
+	encoding.addQueryParams(q)
+	assert.Equal(t, "compression=gzip&encoding=cbor", q.Encode())
+
+	assert.Error(t, (&reportEncoding{Format: "protobuf"}).validate())
+	assert.Error(t, (&reportEncoding{Compression: "lz4"}).validate())
+}
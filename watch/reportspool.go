@@ -0,0 +1,322 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	spoolFileSuffix        = ".report"
+	defaultSpoolMaxSizeMB  = 100
+	defaultSpoolMaxAgeMins = 6 * 60
+)
+
+type spoolConfig struct {
+	// Dir keeps the undelivered reports, a directory under the temp dir by default
+	Dir string `json:"dir,omitempty"`
+	// MaxSizeMB is the total size of the undelivered reports, the oldest are dropped above it
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+	// MaxAgeMinutes is the time an undelivered report is kept
+	MaxAgeMinutes int `json:"maxAgeMinutes,omitempty"`
+}
+
+type spoolItem struct {
+	seq     uint64
+	created time.Time
+	size    int64
+	// data is kept in memory when the spool has no directory
+	data []byte
+	// header identifies the report in the acks of the server
+	header reportHeader
+	// sent reports wait in the spool for their ack
+	sent bool
+}
+
+// reportHeader is the position of the report in the report stream
+type reportHeader struct {
+	SessionID      string `json:"sessionID"`
+	SequenceNumber uint64 `json:"sequenceNumber"`
+}
+
+func readReportHeader(report []byte) reportHeader {
+	header := reportHeader{}
+	if err := json.Unmarshal(report, &header); err != nil {
+		glog.Errorf("failed to read report header: %s", err.Error())
+	}
+	return header
+}
+
+// createReportSpool creates the spool of the config, falling back to memory when the directory can't be used
+func createReportSpool(config spoolConfig) *reportSpool {
+	if config.Dir == "" {
+		config.Dir = filepath.Join(os.TempDir(), "kollector-reports")
+	}
+	spool, err := newReportSpool(&config)
+	if err != nil {
+		glog.Errorf("%s, keeping the undelivered reports in memory", err.Error())
+		config.Dir = ""
+		spool, _ = newReportSpool(&config)
+	}
+	return spool
+}
+
+// reportSpool is the outbound queue of the reports. A report stays in the spool until it's delivered, so it survives
+// a broken connection and, when the spool has a directory, a restart of the process
+type reportSpool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	items   []spoolItem
+	size    int64
+	nextSeq uint64
+	mutex   sync.Mutex
+	// notify is signaled when a report is pushed
+	notify chan struct{}
+	// dropped is set when undelivered reports were dropped, the server then misses some of the changes
+	dropped bool
+	// onDrop is called when undelivered reports are dropped
+	onDrop func()
+}
+
+func newReportSpool(config *spoolConfig) (*reportSpool, error) {
+	spool := &reportSpool{
+		dir:     config.Dir,
+		maxSize: int64(config.MaxSizeMB) * 1024 * 1024,
+		maxAge:  time.Duration(config.MaxAgeMinutes) * time.Minute,
+		nextSeq: 1,
+		notify:  make(chan struct{}, 1),
+	}
+	if spool.maxSize <= 0 {
+		spool.maxSize = defaultSpoolMaxSizeMB * 1024 * 1024
+	}
+	if spool.maxAge <= 0 {
+		spool.maxAge = defaultSpoolMaxAgeMins * time.Minute
+	}
+	if spool.dir == "" {
+		return spool, nil
+	}
+	if err := os.MkdirAll(spool.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory %s: %s", spool.dir, err.Error())
+	}
+	if err := spool.load(); err != nil {
+		return nil, err
+	}
+	if len(spool.items) > 0 {
+		glog.Infof("found %d undelivered reports in %s", len(spool.items), spool.dir)
+		spool.signal()
+	}
+	return spool, nil
+}
+
+// load reads the reports left by a previous run
+func (spool *reportSpool) load() error {
+	entries, err := os.ReadDir(spool.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory %s: %s", spool.dir, err.Error())
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), spoolFileSuffix+".tmp") {
+			// a report the previous run didn't finish writing
+			os.Remove(filepath.Join(spool.dir, entry.Name()))
+			continue
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), spoolFileSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), spoolFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(spool.path(seq))
+		if err != nil {
+			continue
+		}
+		spool.items = append(spool.items, spoolItem{seq: seq, created: info.ModTime(), size: info.Size(), header: readReportHeader(data)})
+		spool.size += info.Size()
+		if seq >= spool.nextSeq {
+			spool.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(spool.items, func(i, j int) bool { return spool.items[i].seq < spool.items[j].seq })
+	spool.trim()
+	return nil
+}
+
+func (spool *reportSpool) path(seq uint64) string {
+	return filepath.Join(spool.dir, fmt.Sprintf("%020d%s", seq, spoolFileSuffix))
+}
+
+// push adds a report to the end of the spool
+func (spool *reportSpool) push(report []byte) error {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	item := spoolItem{seq: spool.nextSeq, created: time.Now(), size: int64(len(report)), header: readReportHeader(report)}
+	if spool.dir == "" {
+		item.data = report
+	} else {
+		// write and rename, so a crash never leaves a partial report
+		tmpPath := spool.path(item.seq) + ".tmp"
+		if err := os.WriteFile(tmpPath, report, 0600); err != nil {
+			return fmt.Errorf("failed to spool report: %s", err.Error())
+		}
+		if err := os.Rename(tmpPath, spool.path(item.seq)); err != nil {
+			return fmt.Errorf("failed to spool report: %s", err.Error())
+		}
+	}
+	spool.nextSeq++
+	spool.items = append(spool.items, item)
+	spool.size += item.size
+	spool.trim()
+	spool.signal()
+	return nil
+}
+
+// trim drops the oldest reports while the spool is above its bounds
+func (spool *reportSpool) trim() {
+	dropped := 0
+	// the newest report is kept even when it's bigger than the spool
+	for len(spool.items) > 0 && (time.Since(spool.items[0].created) > spool.maxAge || (len(spool.items) > 1 && spool.size > spool.maxSize)) {
+		spool.removeAt(0)
+		dropped++
+	}
+	if dropped > 0 {
+		glog.Warningf("dropped %d undelivered reports, the spool is over its size or age limit", dropped)
+		spool.setDropped()
+	}
+}
+
+func (spool *reportSpool) removeAt(index int) {
+	item := spool.items[index]
+	if spool.dir != "" {
+		if err := os.Remove(spool.path(item.seq)); err != nil && !os.IsNotExist(err) {
+			glog.Errorf("failed to remove spooled report %d: %s", item.seq, err.Error())
+		}
+	}
+	spool.size -= item.size
+	spool.items = append(spool.items[:index], spool.items[index+1:]...)
+}
+
+func (spool *reportSpool) signal() {
+	select {
+	case spool.notify <- struct{}{}:
+	default:
+	}
+}
+
+// peek returns the oldest report in the spool which wasn't sent yet
+func (spool *reportSpool) peek() (uint64, []byte, bool) {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	spool.trim()
+	for i := 0; i < len(spool.items); {
+		item := spool.items[i]
+		if item.sent {
+			i++
+			continue
+		}
+		if spool.dir == "" {
+			return item.seq, item.data, true
+		}
+		data, err := os.ReadFile(spool.path(item.seq))
+		if err == nil {
+			return item.seq, data, true
+		}
+		glog.Errorf("failed to read spooled report %d, dropping it: %s", item.seq, err.Error())
+		spool.removeAt(i)
+		spool.setDropped()
+	}
+	return 0, nil, false
+}
+
+// markSent keeps a sent report in the spool until the server acks it
+func (spool *reportSpool) markSent(seq uint64) {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	for i := range spool.items {
+		if spool.items[i].seq == seq {
+			spool.items[i].sent = true
+			return
+		}
+	}
+}
+
+// ack removes the sent reports of the session up to the acked sequence number, returns how many were removed
+func (spool *reportSpool) ack(sessionID string, sequenceNumber uint64) int {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	acked := 0
+	for i := 0; i < len(spool.items); {
+		header := spool.items[i].header
+		if spool.items[i].sent && header.SessionID == sessionID && header.SequenceNumber <= sequenceNumber {
+			spool.removeAt(i)
+			acked++
+			continue
+		}
+		i++
+	}
+	return acked
+}
+
+// resend marks the unacked reports to be sent again, returns how many are resent
+func (spool *reportSpool) resend() int {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	resent := 0
+	for i := range spool.items {
+		if spool.items[i].sent {
+			spool.items[i].sent = false
+			resent++
+		}
+	}
+	if resent > 0 {
+		spool.signal()
+	}
+	return resent
+}
+
+// remove removes a delivered report
+func (spool *reportSpool) remove(seq uint64) {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	for i := range spool.items {
+		if spool.items[i].seq == seq {
+			spool.removeAt(i)
+			return
+		}
+	}
+}
+
+func (spool *reportSpool) setDropped() {
+	spool.dropped = true
+	if spool.onDrop != nil {
+		spool.onDrop()
+	}
+}
+
+// takeDropped returns whether reports were dropped since the last call
+func (spool *reportSpool) takeDropped() bool {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	dropped := spool.dropped
+	spool.dropped = false
+	return dropped
+}
+
+func (spool *reportSpool) len() int {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	return len(spool.items)
+}
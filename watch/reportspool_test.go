@@ -0,0 +1,95 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportSpool(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := newReportSpool(&spoolConfig{Dir: dir})
+	assert.NoError(t, err)
+	_, _, ok := spool.peek()
+	assert.False(t, ok)
+
+	assert.NoError(t, spool.push([]byte("first")))
+	assert.NoError(t, spool.push([]byte("second")))
+	seq, report, ok := spool.peek()
+	assert.True(t, ok)
+	assert.Equal(t, "first", string(report))
+	spool.remove(seq)
+	assert.NoError(t, spool.push([]byte("third")))
+
+	// the undelivered reports survive a restart, in order
+	spool, err = newReportSpool(&spoolConfig{Dir: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, spool.len())
+	seq, report, _ = spool.peek()
+	assert.Equal(t, "second", string(report))
+	spool.remove(seq)
+	_, report, _ = spool.peek()
+	assert.Equal(t, "third", string(report))
+
+	assert.NoError(t, spool.push([]byte("fourth")))
+	seq, _, _ = spool.peek()
+	spool.remove(seq)
+	_, report, _ = spool.peek()
+	assert.Equal(t, "fourth", string(report))
+}
+
+func TestReportSpoolLimits(t *testing.T) {
+	spool, err := newReportSpool(&spoolConfig{})
+	assert.NoError(t, err)
+	spool.maxSize = 10
+	assert.NoError(t, spool.push([]byte("12345")))
+	assert.NoError(t, spool.push([]byte("67890")))
+	assert.False(t, spool.takeDropped())
+	assert.NoError(t, spool.push([]byte("abcde")))
+	assert.Equal(t, 2, spool.len())
+	assert.True(t, spool.takeDropped())
+	assert.False(t, spool.takeDropped(), "the flag is cleared once taken")
+	_, report, _ := spool.peek()
+	assert.Equal(t, "67890", string(report))
+
+	// the newest report is kept even when it's bigger than the spool
+	assert.NoError(t, spool.push([]byte("a big report")))
+	assert.Equal(t, 1, spool.len())
+
+	dir := t.TempDir()
+	spool, err = newReportSpool(&spoolConfig{Dir: dir})
+	assert.NoError(t, err)
+	assert.NoError(t, spool.push([]byte("old")))
+	old := time.Now().Add(-2 * defaultSpoolMaxAgeMins * time.Minute)
+	assert.NoError(t, os.Chtimes(spool.path(1), old, old))
+	spool, err = newReportSpool(&spoolConfig{Dir: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, spool.len())
+	assert.True(t, spool.takeDropped())
+}
+
+func TestReportSpoolAcks(t *testing.T) {
+	spool, err := newReportSpool(&spoolConfig{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, spool.push([]byte(fmt.Sprintf(`{"sessionID":"a","sequenceNumber":%d}`, i))))
+		seq, _, ok := spool.peek()
+		assert.True(t, ok)
+		spool.markSent(seq)
+	}
+	_, _, ok := spool.peek()
+	assert.False(t, ok, "the sent reports wait for their ack")
+
+	assert.Equal(t, 0, spool.ack("b", 3))
+	assert.Equal(t, 2, spool.ack("a", 2))
+	assert.Equal(t, 1, spool.len())
+
+	// the unacked report is sent again after a reconnect
+	assert.Equal(t, 1, spool.resend())
+	_, report, ok := spool.peek()
+	assert.True(t, ok)
+	assert.Equal(t, `{"sessionID":"a","sequenceNumber":3}`, string(report))
+}
@@ -0,0 +1,86 @@
+package watch
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// resourceDiscoveryInterval is the time to wait before looking again for a resource the cluster doesn't serve, a variable
+// for the tests
+var resourceDiscoveryInterval = 10 * time.Minute
+
+// Resources returns the resources of the config, each is watched by ResourceWatch
+func (wh *WatchHandler) Resources() []schema.GroupVersionResource {
+	return wh.resources
+}
+
+// ResourceWatch watch over the objects of a resource of the config, when the cluster serves it
+func (wh *WatchHandler) ResourceWatch(gvr schema.GroupVersionResource) {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER ResourceWatch %s. error: %v, stack: %s", resourceKey(gvr), err, debug.Stack())
+		}
+	}()
+	resource := resourceKey(gvr)
+	if _, found := wh.getServedGroupVersionResource(gvr.Group, []string{gvr.Version}, gvr.Resource); !found {
+		glog.Infof("%s is not served, looking again in %s", resource, resourceDiscoveryInterval)
+		time.Sleep(resourceDiscoveryInterval)
+		return
+	}
+	glog.Infof("Watching over %s starting", resource)
+	resourceWatcher := wh.watchInformer(wh.dynamicInformerFactory.ForResource(gvr).Informer(), resource)
+	glog.Infof("Watching over %s started", resource)
+	wh.handleInformerEvents(resourceWatcher, resource, func(event *watch.Event) error {
+		return wh.resourceEventHandler(resource, event)
+	})
+}
+
+// resourceKey is the key of the resource in the resources section of the report: group/version/resource,
+// version/resource for the core group
+func resourceKey(gvr schema.GroupVersionResource) string {
+	return gvr.GroupVersion().String() + "/" + gvr.Resource
+}
+
+func (wh *WatchHandler) resourceEventHandler(resource string, event *watch.Event) error {
+	obj, ok := event.Object.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("got unexpected %s object from chan", resource)
+	}
+	// cluster scoped objects have no namespace
+	if obj.GetNamespace() != "" && !wh.isNamespaceWatched(obj.GetNamespace()) {
+		return nil
+	}
+	obj.SetManagedFields(nil)
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		id, stored, found := wh.resourcedm.lookup(obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName())
+		if !found {
+			id = CreateID(obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName())
+			wh.resourcedm.init(id)
+			wh.resourcedm.pushBack(id, obj)
+			wh.jsonReport.AddResourceToJsonFormat(resource, obj, CREATED)
+		} else if isUnstructuredChanged(stored.(*unstructured.Unstructured), obj) {
+			wh.resourcedm.updateFront(id, obj)
+			glog.Infof("%s %s updated", resource, obj.GetName())
+			wh.jsonReport.AddResourceToJsonFormat(resource, obj, UPDATED)
+		} else {
+			return nil
+		}
+		informNewDataArrive(wh)
+	case watch.Deleted:
+		if id, _, found := wh.resourcedm.lookup(obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName()); found {
+			wh.resourcedm.remove(id)
+			DeleteID(id)
+			glog.Infof("%s %s removed", resource, obj.GetName())
+			wh.jsonReport.AddResourceToJsonFormat(resource, obj, DELETED)
+			informNewDataArrive(wh)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGroupVersionResources(t *testing.T) {
+	config := &collectorConfig{Resources: []resourceConfig{
+		{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"},
+		{Version: "v1", Resource: "endpoints"},
+		{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"},
+	}}
+	resources, err := config.groupVersionResources()
+	assert.NoError(t, err)
+	assert.Equal(t, []schema.GroupVersionResource{
+		{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"},
+		{Version: "v1", Resource: "endpoints"},
+	}, resources)
+	assert.Equal(t, "argoproj.io/v1alpha1/rollouts", resourceKey(resources[0]))
+	assert.Equal(t, "v1/endpoints", resourceKey(resources[1]))
+
+	config.Resources = append(config.Resources, resourceConfig{Group: "cert-manager.io", Resource: "certificates"})
+	_, err = config.groupVersionResources()
+	assert.Error(t, err)
+}
+
+func TestResourceServed(t *testing.T) {
+	wh := newTestWatchHandler()
+	wh.RestAPIClient.(*fake.Clientset).Resources = []*metav1.APIResourceList{
+		{GroupVersion: "argoproj.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "rollouts"}}},
+	}
+	_, found := wh.getServedGroupVersionResource("argoproj.io", []string{"v1alpha1"}, "rollouts")
+	assert.True(t, found)
+	_, found = wh.getServedGroupVersionResource("argoproj.io", []string{"v1"}, "rollouts")
+	assert.False(t, found)
+	_, found = wh.getServedGroupVersionResource("cert-manager.io", []string{"v1"}, "certificates")
+	assert.False(t, found)
+}
+
+func TestResourceEventHandler(t *testing.T) {
+	wh := newTestWatchHandler()
+	rollout := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default", "resourceVersion": "1"},
+		"spec":       map[string]interface{}{"replicas": int64(2)},
+	}}
+	resource := "argoproj.io/v1alpha1/rollouts"
+	assert.NoError(t, wh.resourceEventHandler(resource, &watch.Event{Type: watch.Added, Object: rollout.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Resources[resource].Created))
+
+	sameRollout := rollout.DeepCopy()
+	sameRollout.SetResourceVersion("2")
+	assert.NoError(t, wh.resourceEventHandler(resource, &watch.Event{Type: watch.Modified, Object: sameRollout}))
+	assert.Nil(t, wh.jsonReport.Resources[resource].Updated)
+
+	scaled := sameRollout.DeepCopy()
+	assert.NoError(t, unstructured.SetNestedField(scaled.Object, int64(3), "spec", "replicas"))
+	assert.NoError(t, wh.resourceEventHandler(resource, &watch.Event{Type: watch.Modified, Object: scaled}))
+	assert.Equal(t, 1, len(wh.jsonReport.Resources[resource].Updated))
+
+	assert.NoError(t, wh.resourceEventHandler(resource, &watch.Event{Type: watch.Deleted, Object: scaled.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Resources[resource].Deleted))
+	assert.Equal(t, 0, wh.resourcedm.len())
+
+	assert.Error(t, wh.resourceEventHandler(resource, &watch.Event{Type: watch.Added, Object: &metav1.Status{}}))
+}
+
+func TestResourceWatchersWhileReporting(t *testing.T) {
+	wh := newTestWatchHandler()
+	wh.setAggregateFirstDataFlag(false)
+	const count = 100
+	var writers sync.WaitGroup
+	for _, resource := range []string{"argoproj.io/v1alpha1/rollouts", "cert-manager.io/v1/certificates"} {
+		writers.Add(1)
+		go func(resource string) {
+			defer writers.Done()
+			for i := 0; i < count; i++ {
+				obj := &unstructured.Unstructured{}
+				obj.SetAPIVersion(resource)
+				obj.SetKind("Object")
+				obj.SetNamespace("default")
+				obj.SetName(fmt.Sprintf("object-%d", i))
+				assert.NoError(t, wh.resourceEventHandler(resource, &watch.Event{Type: watch.Added, Object: obj}))
+			}
+		}(resource)
+	}
+	done := make(chan struct{})
+	go func() {
+		writers.Wait()
+		close(done)
+	}()
+
+	// the objects are reported while the watchers add them, none is lost
+	reported := 0
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		for _, data := range prepareDataToSend(wh) {
+			report := jsonFormat{}
+			assert.NoError(t, json.Unmarshal(data, &report))
+			for _, objects := range report.Resources {
+				reported += len(objects.Created)
+			}
+		}
+	}
+	assert.Equal(t, 2*count, reported)
+}
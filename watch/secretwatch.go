@@ -2,9 +2,8 @@ package watch
 
 import (
 	"fmt"
+	"reflect"
 	"runtime/debug"
-	"strings"
-	"time"
 
 	"github.com/golang/glog"
 	corev1 "k8s.io/api/core/v1"
@@ -24,45 +23,12 @@ func (wh *WatchHandler) SecretWatch() {
 			glog.Errorf("RECOVER SecretWatch. error: %v\n %s", err, string(debug.Stack()))
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-WatchLoop:
-	for {
-		glog.Infof("Watching over secrets starting")
-		secretsWatcher, err := wh.RestAPIClient.CoreV1().Secrets("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			glog.Errorf("Failed watching over secrets. %s", err.Error())
-			time.Sleep(3 * time.Second)
-			continue
-		}
-		secretsChan := secretsWatcher.ResultChan()
-		glog.Infof("Watching over secrets started")
-	ChanLoop:
-		for {
-			var event watch.Event
-			select {
-			case event = <-secretsChan:
-			case <-newStateChan:
-				secretsWatcher.Stop()
-				glog.Errorf("Secrets watch - newStateChan signal")
-				continue WatchLoop
-			}
-
-			if event.Type == watch.Error {
-				glog.Errorf("Secrets watch chan loop error: %v", event.Object)
-				secretsWatcher.Stop()
-				break ChanLoop
-			}
-			if err := wh.secretEventHandler(&event, lastWatchEventCreationTime); err != nil {
-				break ChanLoop
-			}
-		}
-		lastWatchEventCreationTime = time.Now()
-		glog.Infof("Watching over secrets ended - timeout")
-	}
+	glog.Infof("Watching over secrets starting")
+	secretsWatcher := wh.watchInformer(wh.informerFactory.Core().V1().Secrets().Informer(), "secret")
+	glog.Infof("Watching over secrets started")
+	wh.handleInformerEvents(secretsWatcher, "secret", wh.secretEventHandler)
 }
-func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
+func (wh *WatchHandler) secretEventHandler(event *watch.Event) error {
 	if secret, ok := event.Object.(*corev1.Secret); ok {
 		if !wh.isNamespaceWatched(secret.Namespace) {
 			return nil
@@ -70,30 +36,23 @@ func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCre
 		secret.ManagedFields = []metav1.ManagedFieldsEntry{}
 		removeSecretData(secret)
 		switch event.Type {
-		case "ADDED":
-			if secret.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
-				glog.Infof("secret %s already exist, will not be reported", secret.ObjectMeta.Name)
-				return nil
+		case watch.Added, watch.Modified:
+			found, changed := wh.updateSecret(secret)
+			if !found {
+				id := CreateID("secret", secret.Namespace, secret.Name)
+				wh.secretdm.init(id)
+				wh.secretdm.pushBack(id, secretData{Secret: secret})
+				wh.jsonReport.AddToJsonFormat(secret, SECRETS, CREATED)
+				informNewDataArrive(wh)
+			} else if changed {
+				wh.jsonReport.AddToJsonFormat(secret, SECRETS, UPDATED)
+				informNewDataArrive(wh)
+			}
+		case watch.Deleted:
+			if name := wh.removeSecret(secret); name != "" {
+				wh.jsonReport.AddToJsonFormat(secret, SECRETS, DELETED)
+				informNewDataArrive(wh)
 			}
-			secretdm := secretData{Secret: secret}
-			id := CreateID()
-			wh.secretdm.init(id)
-			wh.secretdm.pushBack(id, secretdm)
-			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(secret, SECRETS, CREATED)
-		case "MODIFY":
-			wh.updateSecret(secret)
-			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(secret, SECRETS, UPDATED)
-		case "DELETED":
-			wh.removeSecret(secret)
-			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(secret, SECRETS, DELETED)
-		case "BOOKMARK": //only the resource version is changed but it's the same workload
-			return nil
-		case "ERROR":
-			glog.Errorf("while watching over secrets we got an error: %v", event)
-			return fmt.Errorf("while watching over secrets we got an error")
 		}
 	} else {
 		return fmt.Errorf("got unexpected secret from chan")
@@ -101,61 +60,42 @@ func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCre
 	return nil
 }
 
-// UpdateSecret update websocket when secret is updated
-func (wh *WatchHandler) updateSecret(secret *corev1.Secret) {
-	for _, id := range wh.secretdm.getIDs() {
-		front := wh.secretdm.front(id)
-		if front == nil || front.Value == nil {
-			continue
-		}
-		secretData, ok := front.Value.(secretData)
-		if !ok || secretData.Secret == nil {
-			continue
-		}
-		if strings.Compare(secretData.Secret.Namespace, secret.Namespace) != 0 {
-			continue
-		}
-		if strings.Compare(secretData.Secret.ObjectMeta.Name, secret.ObjectMeta.Name) == 0 {
-			*secretData.Secret = *secret
-			glog.Infof("secret %s updated", secretData.Secret.ObjectMeta.Name)
-			break
-		}
-		if strings.Compare(secretData.Secret.ObjectMeta.GenerateName, secret.ObjectMeta.Name) == 0 {
-			*secretData.Secret = *secret
-			glog.Infof("secret %s updated", secretData.Secret.ObjectMeta.Name)
-			break
-		}
+// UpdateSecret updates the stored secret. Returns whether the secret is known and whether it changed since it was
+// last reported
+func (wh *WatchHandler) updateSecret(secret *corev1.Secret) (bool, bool) {
+	_, stored, found := wh.secretdm.lookup("secret", secret.Namespace, secret.Name)
+	if !found {
+		return false, false
+	}
+	secretData, ok := stored.(secretData)
+	if !ok || secretData.Secret == nil {
+		return false, false
 	}
+	if !isSecretChanged(secretData.Secret, secret) {
+		return true, false
+	}
+	*secretData.Secret = *secret
+	glog.Infof("secret %s updated", secretData.Secret.ObjectMeta.Name)
+	return true, true
+}
+
+// isSecretChanged compares secrets which data was removed
+func isSecretChanged(oldSecret, newSecret *corev1.Secret) bool {
+	return isObjectMetaChanged(&oldSecret.ObjectMeta, &newSecret.ObjectMeta) ||
+		oldSecret.Type != newSecret.Type ||
+		!reflect.DeepEqual(oldSecret.Immutable, newSecret.Immutable)
 }
 
 // RemoveSecret update websocket when secret is removed
 func (wh *WatchHandler) removeSecret(secret *corev1.Secret) string {
-	for _, id := range wh.secretdm.getIDs() {
-		front := wh.secretdm.front(id)
-		if front == nil || front.Value == nil {
-			continue
-		}
-		secretData, ok := front.Value.(secretData)
-		if !ok || secretData.Secret == nil {
-			continue
-		}
-		if strings.Compare(secretData.Secret.Namespace, secret.Namespace) != 0 {
-			continue
-		}
-		if strings.Compare(secretData.Secret.ObjectMeta.Name, secret.ObjectMeta.Name) == 0 {
-			name := secretData.Secret.ObjectMeta.Name
-			wh.secretdm.remove(id)
-			glog.Infof("secret %s removed", name)
-			return name
-		}
-		if strings.Compare(secretData.Secret.ObjectMeta.GenerateName, secret.ObjectMeta.Name) == 0 {
-			gName := secretData.Secret.ObjectMeta.Name
-			wh.secretdm.remove(id)
-			glog.Infof("secret %s removed", gName)
-			return gName
-		}
+	id, _, found := wh.secretdm.lookup("secret", secret.Namespace, secret.Name)
+	if !found {
+		return ""
 	}
-	return ""
+	wh.secretdm.remove(id)
+	DeleteID(id)
+	glog.Infof("secret %s removed", secret.Name)
+	return secret.Name
 }
 func removeSecretData(secret *corev1.Secret) {
 	secret.Data = nil
@@ -0,0 +1,37 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestSecretEventHandler(t *testing.T) {
+	wh := newTestWatchHandler()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default", ResourceVersion: "1"},
+		Data:       map[string][]byte{"token": []byte("1234")},
+	}
+	assert.NoError(t, wh.secretEventHandler(&watch.Event{Type: watch.Added, Object: secret.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Secret.Created))
+	assert.Nil(t, wh.jsonReport.Secret.Created[0].(*corev1.Secret).Data)
+
+	// the data is not reported, so changing it is not an update
+	newData := secret.DeepCopy()
+	newData.ResourceVersion = "2"
+	newData.Data["token"] = []byte("5678")
+	assert.NoError(t, wh.secretEventHandler(&watch.Event{Type: watch.Modified, Object: newData}))
+	assert.Equal(t, 0, len(wh.jsonReport.Secret.Updated))
+
+	annotated := newData.DeepCopy()
+	annotated.ResourceVersion = "3"
+	annotated.Annotations = map[string]string{"owner": "a"}
+	assert.NoError(t, wh.secretEventHandler(&watch.Event{Type: watch.Modified, Object: annotated}))
+	assert.Equal(t, 1, len(wh.jsonReport.Secret.Updated))
+
+	assert.NoError(t, wh.secretEventHandler(&watch.Event{Type: watch.Deleted, Object: annotated.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Secret.Deleted))
+}
@@ -2,13 +2,15 @@ package watch
 
 import (
 	"container/list"
+	"fmt"
+	"reflect"
 	"runtime/debug"
-	"strings"
-	"time"
+	"sort"
 
 	"github.com/golang/glog"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -23,119 +25,112 @@ func (wh *WatchHandler) ServiceWatch() {
 			glog.Errorf("RECOVER ServiceWatch. error: %v, stack: %s", err, debug.Stack())
 		}
 	}()
-	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-	for {
-		glog.Info("Watching over services starting")
-		serviceWatcher, err := wh.RestAPIClient.CoreV1().Services("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
-		if err != nil {
-			glog.Errorf("Cannot watch over services. %v", err)
-			time.Sleep(3 * time.Second)
-			lastWatchEventCreationTime = time.Now()
-			continue
-		}
-		wh.handleServiceWatch(serviceWatcher, newStateChan, &lastWatchEventCreationTime)
+	glog.Info("Watching over services starting")
+	serviceWatcher := wh.watchInformer(wh.informerFactory.Core().V1().Services().Informer(), "service")
+	glog.Infof("Watching over services started")
+	wh.handleInformerEvents(serviceWatcher, "service", wh.serviceEventHandler)
+}
 
-		glog.Infof("Watching over services ended - since we got timeout")
+// updateService updates the stored service. Returns whether the service is known and whether it changed since it was
+// last reported
+func updateService(service *core.Service, sdm map[int]*list.List) (bool, bool) {
+	_, front := lookupList(sdm, "service", service.ObjectMeta.Namespace, service.ObjectMeta.Name)
+	if front == nil {
+		return false, false
 	}
-}
-func updateService(service *core.Service, sdm map[int]*list.List) string {
-	for _, v := range sdm {
-		if v == nil || v.Len() == 0 {
-			continue
-		}
-		if strings.Compare(v.Front().Value.(serviceData).Service.ObjectMeta.Name, service.ObjectMeta.Name) == 0 {
-			*v.Front().Value.(serviceData).Service = *service
-			glog.Infof("service %s updated", v.Front().Value.(serviceData).Service.ObjectMeta.Name)
-			return v.Front().Value.(serviceData).Service.ObjectMeta.Name
-		}
-		if strings.Compare(v.Front().Value.(serviceData).Service.ObjectMeta.GenerateName, service.ObjectMeta.Name) == 0 {
-			*v.Front().Value.(serviceData).Service = *service
-			glog.Infof("service %s updated", v.Front().Value.(serviceData).Service.ObjectMeta.Name)
-			return v.Front().Value.(serviceData).Service.ObjectMeta.Name
-		}
+	storedService := front.Value.(serviceData).Service
+	if !isServiceChanged(storedService, service) {
+		return true, false
 	}
-	return ""
+	*storedService = *service
+	glog.Infof("service %s updated", storedService.ObjectMeta.Name)
+	return true, true
+}
+
+func isServiceChanged(oldService, newService *core.Service) bool {
+	return isObjectMetaChanged(&oldService.ObjectMeta, &newService.ObjectMeta) ||
+		!reflect.DeepEqual(oldService.Spec, newService.Spec) ||
+		!reflect.DeepEqual(oldService.Status, newService.Status)
 }
 
 // RemoveService update websocket when service is removed
 func removeService(service *core.Service, sdm map[int]*list.List) string {
-	for _, v := range sdm {
-		if v == nil || v.Len() == 0 {
-			continue
-		}
-		if strings.Compare(v.Front().Value.(serviceData).Service.ObjectMeta.Name, service.ObjectMeta.Name) == 0 {
-			name := v.Front().Value.(serviceData).Service.ObjectMeta.Name
-			v.Remove(v.Front())
-			glog.Infof("service %s removed", name)
-			return name
+	id, front := lookupList(sdm, "service", service.ObjectMeta.Namespace, service.ObjectMeta.Name)
+	if front == nil {
+		return ""
+	}
+	storedService := front.Value.(serviceData).Service
+	delete(sdm, id)
+	DeleteID(id)
+	glog.Infof("service %s removed", storedService.ObjectMeta.Name)
+	return storedService.ObjectMeta.Name
+}
+
+func (wh *WatchHandler) serviceEventHandler(event *watch.Event) error {
+	service, ok := event.Object.(*core.Service)
+	if !ok {
+		return fmt.Errorf("got unexpected service from chan")
+	}
+	if !wh.isNamespaceWatched(service.Namespace) {
+		return nil
+	}
+	service.ManagedFields = []metav1.ManagedFieldsEntry{}
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		found, changed := updateService(service, wh.sdm)
+		if !found {
+			id := CreateID("service", service.ObjectMeta.Namespace, service.ObjectMeta.Name)
+			wh.sdm[id] = list.New()
+			wh.sdm[id].PushBack(serviceData{Service: service})
+			wh.jsonReport.AddToJsonFormat(service, SERVICES, CREATED)
+			informNewDataArrive(wh)
+			wh.notifyMicroServiceChanged(service.Namespace)
+		} else if changed {
+			wh.jsonReport.AddToJsonFormat(service, SERVICES, UPDATED)
+			informNewDataArrive(wh)
+			wh.notifyMicroServiceChanged(service.Namespace)
 		}
-		if strings.Compare(v.Front().Value.(serviceData).Service.ObjectMeta.GenerateName, service.ObjectMeta.Name) == 0 {
-			gName := v.Front().Value.(serviceData).Service.ObjectMeta.Name
-			v.Remove(v.Front())
-			glog.Infof("service %s removed", gName)
-			return gName
+	case watch.Deleted:
+		if name := removeService(service, wh.sdm); name != "" {
+			wh.jsonReport.AddToJsonFormat(service, SERVICES, DELETED)
+			informNewDataArrive(wh)
+			wh.notifyMicroServiceChanged(service.Namespace)
 		}
 	}
-	return ""
+	return nil
 }
 
-func (wh *WatchHandler) handleServiceWatch(serviceWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
-	serviceChan := serviceWatcher.ResultChan()
-	glog.Infof("Watching over services started")
-	for {
-		var event watch.Event
-		select {
-		case event = <-serviceChan:
-		case <-newStateChan:
-			serviceWatcher.Stop()
-			glog.Errorf("Service watch - newStateChan signal")
-			*lastWatchEventCreationTime = time.Now()
-			return
+// ServiceBackend is a service receiving the traffic of a route, with the microservices behind it
+type ServiceBackend struct {
+	ServiceName string `json:"serviceName"`
+	Namespace   string `json:"namespace"`
+	Port        string `json:"port,omitempty"`
+	PodSpecIds  []int  `json:"podSpecIds"`
+}
+
+// newServiceBackend resolves the service to the microservices its selector matches
+func (wh *WatchHandler) newServiceBackend(namespace, name, port string) ServiceBackend {
+	backend := ServiceBackend{ServiceName: name, Namespace: namespace, Port: port, PodSpecIds: []int{}}
+	service, err := wh.informerFactory.Core().V1().Services().Lister().Services(namespace).Get(name)
+	if err != nil || len(service.Spec.Selector) == 0 {
+		// a missing service, or one without selector, has no known microservices
+		return backend
+	}
+	selector := labels.SelectorFromSet(service.Spec.Selector)
+	wh.pdmMutex.RLock()
+	defer wh.pdmMutex.RUnlock()
+	for id, v := range wh.pdm {
+		if v == nil || v.Front() == nil {
+			continue
 		}
-		if event.Type == watch.Error {
-			glog.Errorf("Service watch chan loop error: %v", event.Object)
-			*lastWatchEventCreationTime = time.Now()
-			return
+		msd, ok := v.Front().Value.(MicroServiceData)
+		if !ok || msd.Pod == nil || msd.Pod.Namespace != namespace {
+			continue
 		}
-		if service, ok := event.Object.(*core.Service); ok {
-			if !wh.isNamespaceWatched(service.Namespace) {
-				continue
-			}
-			service.ManagedFields = []metav1.ManagedFieldsEntry{}
-			switch event.Type {
-			case "ADDED":
-				if service.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
-					glog.Infof("service %s already exist, will not be reported", service.Name)
-					continue
-				}
-				id := CreateID()
-				if wh.sdm[id] == nil {
-					wh.sdm[id] = list.New()
-				}
-				sd := serviceData{Service: service}
-				wh.sdm[id].PushBack(sd)
-				informNewDataArrive(wh)
-				wh.jsonReport.AddToJsonFormat(service, SERVICES, CREATED)
-			case "MODIFY":
-				updateService(service, wh.sdm)
-				informNewDataArrive(wh)
-				wh.jsonReport.AddToJsonFormat(service, SERVICES, UPDATED)
-			case "DELETED":
-				removeService(service, wh.sdm)
-				informNewDataArrive(wh)
-				wh.jsonReport.AddToJsonFormat(service, SERVICES, DELETED)
-			case "BOOKMARK": //only the resource version is changed but it's the same workload
-				continue
-			case "ERROR":
-				glog.Errorf("while watching over services we got an error: %v", event)
-				*lastWatchEventCreationTime = time.Now()
-				return
-			}
-		} else {
-			*lastWatchEventCreationTime = time.Now()
-			return
+		if selector.Matches(labels.Set(msd.Pod.Labels)) {
+			backend.PodSpecIds = append(backend.PodSpecIds, id)
 		}
 	}
+	sort.Ints(backend.PodSpecIds)
+	return backend
 }
@@ -0,0 +1,41 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestServiceEventHandler(t *testing.T) {
+	wh := newTestWatchHandler()
+	service := &core.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", ResourceVersion: "1"},
+		Spec:       core.ServiceSpec{Ports: []core.ServicePort{{Port: 80}}},
+	}
+	otherNamespace := service.DeepCopy()
+	otherNamespace.Namespace = "other"
+	assert.NoError(t, wh.serviceEventHandler(&watch.Event{Type: watch.Added, Object: service.DeepCopy()}))
+	assert.NoError(t, wh.serviceEventHandler(&watch.Event{Type: watch.Added, Object: otherNamespace}))
+	assert.Equal(t, 2, len(wh.jsonReport.Services.Created))
+
+	// only the resourceVersion changed
+	touched := service.DeepCopy()
+	touched.ResourceVersion = "2"
+	assert.NoError(t, wh.serviceEventHandler(&watch.Event{Type: watch.Modified, Object: touched}))
+	assert.Equal(t, 0, len(wh.jsonReport.Services.Updated))
+
+	newPort := touched.DeepCopy()
+	newPort.ResourceVersion = "3"
+	newPort.Spec.Ports[0].Port = 8080
+	assert.NoError(t, wh.serviceEventHandler(&watch.Event{Type: watch.Modified, Object: newPort}))
+	assert.Equal(t, 1, len(wh.jsonReport.Services.Updated))
+	assert.Equal(t, "default", wh.jsonReport.Services.Updated[0].(*core.Service).Namespace)
+	assert.Equal(t, int32(80), otherNamespace.Spec.Ports[0].Port, "service of other namespace should not change")
+
+	assert.NoError(t, wh.serviceEventHandler(&watch.Event{Type: watch.Deleted, Object: newPort.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Services.Deleted))
+	assert.Equal(t, 1, len(wh.sdm))
+}
@@ -0,0 +1,90 @@
+package watch
+
+import (
+	"fmt"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/golang/glog"
+)
+
+const (
+	webSocketSinkType = "websocket"
+	httpSinkType      = "http"
+	fileSinkType      = "file"
+)
+
+// Sink is a destination of the cluster reports
+type Sink interface {
+	// Send delivers a single report
+	Send(report []byte) error
+	// Name identifies the sink in the logs
+	Name() string
+}
+
+type sinkConfig struct {
+	// Type is one of websocket, http or file
+	Type string `json:"type"`
+	// URL of the http sink
+	URL string `json:"url,omitempty"`
+	// Headers are added to the requests of the http sink
+	Headers map[string]string `json:"headers,omitempty"`
+	// Path of the file sink
+	Path string `json:"path,omitempty"`
+	// MaxSizeMB is the size of the file sink before it's rotated
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+	// MaxFiles is the number of rotated files of the file sink to keep
+	MaxFiles int `json:"maxFiles,omitempty"`
+}
+
+// createSinks creates the report sinks of the config. The event receiver websocket, when configured, is returned as well
+// since its connection is managed outside of the sink
+func createSinks(collectorConfig *collectorConfig, config *armometadata.ClusterConfig) ([]Sink, *WebSocketHandler, error) {
+	sinksConfig := collectorConfig.ReportSinks
+	if len(sinksConfig) == 0 {
+		sinksConfig = []sinkConfig{{Type: webSocketSinkType}}
+	}
+	var sinks []Sink
+	var webSocketHandler *WebSocketHandler
+	for i := range sinksConfig {
+		switch sinksConfig[i].Type {
+		case webSocketSinkType:
+			if webSocketHandler != nil {
+				return nil, nil, fmt.Errorf("only one websocket sink is supported")
+			}
+			if err := collectorConfig.ReportEncoding.validate(); err != nil {
+				return nil, nil, err
+			}
+			erURL, err := setWebSocketURL(config, collectorConfig)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to set event receiver url: %s", err.Error())
+			}
+			webSocketHandler = createWebSocketHandler(erURL, createReportSpool(collectorConfig.ReportSpool), collectorConfig)
+			sinks = append(sinks, webSocketHandler)
+		case httpSinkType:
+			sink, err := newHTTPSink(&sinksConfig[i])
+			if err != nil {
+				return nil, nil, err
+			}
+			sinks = append(sinks, sink)
+		case fileSinkType:
+			sink, err := newFileSink(&sinksConfig[i])
+			if err != nil {
+				return nil, nil, err
+			}
+			sinks = append(sinks, sink)
+		default:
+			return nil, nil, fmt.Errorf("unknown report sink type '%s'", sinksConfig[i].Type)
+		}
+		glog.Infof("reporting to %s", sinks[len(sinks)-1].Name())
+	}
+	return sinks, webSocketHandler, nil
+}
+
+// sendToSinks sends the report to all the sinks, a failing sink doesn't stop the others
+func (wh *WatchHandler) sendToSinks(report []byte) {
+	for i := range wh.sinks {
+		if err := wh.sinks[i].Send(report); err != nil {
+			glog.Errorf("failed to send report to %s: %s", wh.sinks[i].Name(), err.Error())
+		}
+	}
+}
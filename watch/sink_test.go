@@ -0,0 +1,76 @@
+package watch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSinks(t *testing.T) {
+	config := &armometadata.ClusterConfig{EventReceiverWebsocketURL: "wss://report.armo.cloud", AccountID: "1234", ClusterName: "test"}
+
+	sinks, webSocketHandler, err := createSinks(&collectorConfig{ReportSpool: spoolConfig{Dir: t.TempDir()}}, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(sinks))
+	assert.NotNil(t, webSocketHandler, "websocket is the default sink")
+
+	sinks, webSocketHandler, err = createSinks(&collectorConfig{ReportSinks: []sinkConfig{{Type: httpSinkType, URL: "http://collector:8080/reports"}, {Type: fileSinkType, Path: "/tmp/reports.ndjson"}}}, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(sinks))
+	assert.Nil(t, webSocketHandler)
+
+	_, _, err = createSinks(&collectorConfig{ReportSinks: []sinkConfig{{Type: "kafka"}}}, config)
+	assert.Error(t, err)
+	_, _, err = createSinks(&collectorConfig{ReportSinks: []sinkConfig{{Type: fileSinkType}}}, config)
+	assert.Error(t, err)
+	_, _, err = createSinks(&collectorConfig{ReportSinks: []sinkConfig{{Type: webSocketSinkType}, {Type: webSocketSinkType}}}, config)
+	assert.Error(t, err)
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received = append(received, string(body))
+	}))
+	defer server.Close()
+
+	sink, err := newHTTPSink(&sinkConfig{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Send([]byte(`{"firstReport":true}`)))
+	assert.Equal(t, []string{`{"firstReport":true}`}, received)
+
+	sink.headers = nil
+	assert.Error(t, sink.Send([]byte(`{"firstReport":false}`)))
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports.ndjson")
+	sink, err := newFileSink(&sinkConfig{Path: path, MaxFiles: 2})
+	assert.NoError(t, err)
+	sink.maxSize = 30
+
+	for _, report := range []string{`{"report":1}`, `{"report":2}`, `{"report":3}`, `{"report":4}`} {
+		assert.NoError(t, sink.Send([]byte(report)))
+	}
+	current, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"report\":3}\n{\"report\":4}\n", string(current))
+
+	rotated, err := os.ReadFile(path + ".1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(strings.Split(strings.TrimSpace(string(rotated)), "\n")))
+	_, err = os.Stat(path + ".2")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,242 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// storageEncryptionParameters are the storage class parameters and the CSI volume attributes of the cloud providers
+// telling the volumes are encrypted, in lower case
+var storageEncryptionParameters = []string{
+	"kmskeyid",                // AWS EBS
+	"disk-encryption-kms-key", // GCE PD
+	"diskencryptionsetid",     // Azure disk
+	"diskencryptiontype",      // Azure disk
+}
+
+// VolumeData is a volume of the pod spec of a microservice, resolved to its claim, persistent volume and storage class
+type VolumeData struct {
+	Name string `json:"name"`
+	// Type is the source of the volume in the pod spec, e.g. persistentVolumeClaim, hostPath, emptyDir
+	Type string `json:"type"`
+	// HostPath is the path on the node of a hostPath volume, or of a hostPath or local persistent volume
+	HostPath   string `json:"hostPath,omitempty"`
+	ClaimName  string `json:"claimName,omitempty"`
+	VolumeName string `json:"volumeName,omitempty"`
+	// VolumeType is the source of the persistent volume, e.g. csi, awsElasticBlockStore, nfs, local
+	VolumeType       string `json:"volumeType,omitempty"`
+	StorageClassName string `json:"storageClassName,omitempty"`
+	Provisioner      string `json:"provisioner,omitempty"`
+	// Encrypted tells if the storage class or the persistent volume encrypt the volume, nil when it's unknown
+	Encrypted *bool `json:"encrypted,omitempty"`
+}
+
+// PersistentVolumeWatch watch over persistent volumes
+func (wh *WatchHandler) PersistentVolumeWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER PersistentVolumeWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over persistent volumes starting")
+	persistentVolumeWatcher := wh.watchInformer(wh.informerFactory.Core().V1().PersistentVolumes().Informer(), "persistentvolume")
+	glog.Infof("Watching over persistent volumes started")
+	wh.handleInformerEvents(persistentVolumeWatcher, "persistentvolume", wh.persistentVolumeEventHandler)
+}
+
+// PersistentVolumeClaimWatch watch over persistent volume claims
+func (wh *WatchHandler) PersistentVolumeClaimWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER PersistentVolumeClaimWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over persistent volume claims starting")
+	persistentVolumeClaimWatcher := wh.watchInformer(wh.informerFactory.Core().V1().PersistentVolumeClaims().Informer(), "persistentvolumeclaim")
+	glog.Infof("Watching over persistent volume claims started")
+	wh.handleInformerEvents(persistentVolumeClaimWatcher, "persistentvolumeclaim", wh.persistentVolumeClaimEventHandler)
+}
+
+// StorageClassWatch watch over storage classes
+func (wh *WatchHandler) StorageClassWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER StorageClassWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over storage classes starting")
+	storageClassWatcher := wh.watchInformer(wh.informerFactory.Storage().V1().StorageClasses().Informer(), "storageclass")
+	glog.Infof("Watching over storage classes started")
+	wh.handleInformerEvents(storageClassWatcher, "storageclass", wh.storageClassEventHandler)
+}
+
+func (wh *WatchHandler) persistentVolumeEventHandler(event *watch.Event) error {
+	persistentVolume, ok := event.Object.(*core.PersistentVolume)
+	if !ok {
+		return fmt.Errorf("got unexpected persistent volume from chan")
+	}
+	if wh.reportObjectEvent("persistent volume", event.Type, persistentVolume, wh.pvdm, PERSISTENTVOLUMES, isPersistentVolumeChanged) {
+		// the claim of the volume may be in any namespace
+		wh.updateMicroServicesVolumes("")
+	}
+	return nil
+}
+
+func (wh *WatchHandler) persistentVolumeClaimEventHandler(event *watch.Event) error {
+	persistentVolumeClaim, ok := event.Object.(*core.PersistentVolumeClaim)
+	if !ok {
+		return fmt.Errorf("got unexpected persistent volume claim from chan")
+	}
+	if wh.reportObjectEvent("persistent volume claim", event.Type, persistentVolumeClaim, wh.pvcdm, PERSISTENTVOLUMECLAIMS, isPersistentVolumeClaimChanged) {
+		wh.updateMicroServicesVolumes(persistentVolumeClaim.Namespace)
+	}
+	return nil
+}
+
+func (wh *WatchHandler) storageClassEventHandler(event *watch.Event) error {
+	storageClass, ok := event.Object.(*storagev1.StorageClass)
+	if !ok {
+		return fmt.Errorf("got unexpected storage class from chan")
+	}
+	if wh.reportObjectEvent("storage class", event.Type, storageClass, wh.storageclassdm, STORAGECLASSES, isStorageClassChanged) {
+		wh.updateMicroServicesVolumes("")
+	}
+	return nil
+}
+
+// updateMicroServicesVolumes updates the volumes of the microservices of the namespace, of all the namespaces when
+// it's empty
+func (wh *WatchHandler) updateMicroServicesVolumes(namespace string) {
+	wh.updateMicroServices(namespace, func(msd *MicroServiceData) bool {
+		volumes := wh.getVolumes(msd.Pod)
+		if reflect.DeepEqual(volumes, msd.Volumes) {
+			return false
+		}
+		msd.Volumes = volumes
+		return true
+	})
+}
+
+// getVolumes resolves the volumes of the pod spec, from the informers cache
+func (wh *WatchHandler) getVolumes(pod *core.Pod) []VolumeData {
+	volumes := make([]VolumeData, 0, len(pod.Spec.Volumes))
+	for i := range pod.Spec.Volumes {
+		volume := &pod.Spec.Volumes[i]
+		data := VolumeData{Name: volume.Name, Type: getVolumeSourceType(volume.VolumeSource)}
+		switch {
+		case volume.HostPath != nil:
+			data.HostPath = volume.HostPath.Path
+		case volume.PersistentVolumeClaim != nil:
+			data.ClaimName = volume.PersistentVolumeClaim.ClaimName
+		case volume.Ephemeral != nil:
+			// the claim of a generic ephemeral volume is named after the pod and the volume
+			data.ClaimName = pod.Name + "-" + volume.Name
+		}
+		if data.ClaimName != "" {
+			wh.resolveClaim(pod.Namespace, &data)
+		}
+		volumes = append(volumes, data)
+	}
+	return volumes
+}
+
+// resolveClaim sets the persistent volume and the storage class of the claim of the volume
+func (wh *WatchHandler) resolveClaim(namespace string, data *VolumeData) {
+	coreInformers := wh.informerFactory.Core().V1()
+	claim, err := coreInformers.PersistentVolumeClaims().Lister().PersistentVolumeClaims(namespace).Get(data.ClaimName)
+	if err != nil {
+		return
+	}
+	data.VolumeName = claim.Spec.VolumeName
+	if claim.Spec.StorageClassName != nil {
+		data.StorageClassName = *claim.Spec.StorageClassName
+	}
+	if data.VolumeName != "" {
+		if persistentVolume, err := coreInformers.PersistentVolumes().Lister().Get(data.VolumeName); err == nil {
+			data.VolumeType = getVolumeSourceType(persistentVolume.Spec.PersistentVolumeSource)
+			if data.StorageClassName == "" {
+				data.StorageClassName = persistentVolume.Spec.StorageClassName
+			}
+			switch {
+			case persistentVolume.Spec.HostPath != nil:
+				data.HostPath = persistentVolume.Spec.HostPath.Path
+			case persistentVolume.Spec.Local != nil:
+				data.HostPath = persistentVolume.Spec.Local.Path
+			case persistentVolume.Spec.CSI != nil:
+				data.Encrypted = isStorageEncrypted(persistentVolume.Spec.CSI.VolumeAttributes)
+			}
+		}
+	}
+	if data.StorageClassName != "" {
+		if storageClass, err := wh.informerFactory.Storage().V1().StorageClasses().Lister().Get(data.StorageClassName); err == nil {
+			data.Provisioner = storageClass.Provisioner
+			if encrypted := isStorageEncrypted(storageClass.Parameters); encrypted != nil {
+				data.Encrypted = encrypted
+			}
+		}
+	}
+}
+
+// getVolumeSourceType returns the JSON name of the source set in a core.VolumeSource or a core.PersistentVolumeSource
+func getVolumeSourceType(source interface{}) string {
+	value := reflect.ValueOf(source)
+	for i := 0; i < value.NumField(); i++ {
+		if field := value.Field(i); field.Kind() == reflect.Ptr && !field.IsNil() {
+			return strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		}
+	}
+	return ""
+}
+
+// isStorageEncrypted tells from the parameters of a storage class or the attributes of a CSI volume if the volume is
+// encrypted, nil when they don't tell
+func isStorageEncrypted(parameters map[string]string) *bool {
+	for key, value := range parameters {
+		key = strings.ToLower(key)
+		if key == "encrypted" {
+			if encrypted, err := strconv.ParseBool(value); err == nil {
+				return &encrypted
+			}
+			continue
+		}
+		for _, parameter := range storageEncryptionParameters {
+			if key == parameter && value != "" {
+				encrypted := true
+				return &encrypted
+			}
+		}
+	}
+	return nil
+}
+
+func isPersistentVolumeChanged(oldObj, newObj watchedObject) bool {
+	oldVolume, newVolume := oldObj.(*core.PersistentVolume), newObj.(*core.PersistentVolume)
+	return isObjectMetaChanged(&oldVolume.ObjectMeta, &newVolume.ObjectMeta) ||
+		!reflect.DeepEqual(oldVolume.Spec, newVolume.Spec) ||
+		oldVolume.Status.Phase != newVolume.Status.Phase
+}
+
+func isPersistentVolumeClaimChanged(oldObj, newObj watchedObject) bool {
+	oldClaim, newClaim := oldObj.(*core.PersistentVolumeClaim), newObj.(*core.PersistentVolumeClaim)
+	return isObjectMetaChanged(&oldClaim.ObjectMeta, &newClaim.ObjectMeta) ||
+		!reflect.DeepEqual(oldClaim.Spec, newClaim.Spec) ||
+		oldClaim.Status.Phase != newClaim.Status.Phase
+}
+
+func isStorageClassChanged(oldObj, newObj watchedObject) bool {
+	oldStorageClass, newStorageClass := oldObj.(*storagev1.StorageClass), newObj.(*storagev1.StorageClass)
+	return isObjectMetaChanged(&oldStorageClass.ObjectMeta, &newStorageClass.ObjectMeta) ||
+		oldStorageClass.Provisioner != newStorageClass.Provisioner ||
+		!reflect.DeepEqual(oldStorageClass.Parameters, newStorageClass.Parameters) ||
+		!reflect.DeepEqual(oldStorageClass.ReclaimPolicy, newStorageClass.ReclaimPolicy) ||
+		!reflect.DeepEqual(oldStorageClass.AllowVolumeExpansion, newStorageClass.AllowVolumeExpansion) ||
+		!reflect.DeepEqual(oldStorageClass.VolumeBindingMode, newStorageClass.VolumeBindingMode)
+}
@@ -0,0 +1,91 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestGetVolumeSourceType(t *testing.T) {
+	assert.Equal(t, "emptyDir", getVolumeSourceType(core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}}))
+	assert.Equal(t, "awsElasticBlockStore", getVolumeSourceType(core.PersistentVolumeSource{AWSElasticBlockStore: &core.AWSElasticBlockStoreVolumeSource{}}))
+	assert.Equal(t, "", getVolumeSourceType(core.VolumeSource{}))
+}
+
+func TestIsStorageEncrypted(t *testing.T) {
+	assert.Nil(t, isStorageEncrypted(map[string]string{"type": "gp3"}))
+	assert.False(t, *isStorageEncrypted(map[string]string{"encrypted": "false"}))
+	assert.True(t, *isStorageEncrypted(map[string]string{"encrypted": "true"}))
+	assert.True(t, *isStorageEncrypted(map[string]string{"disk-encryption-kms-key": "projects/p/locations/l/keyRings/r/cryptoKeys/k"}))
+}
+
+func TestStorageEventHandlers(t *testing.T) {
+	storageClassName := "fast"
+	claim := &core.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default", ResourceVersion: "1"},
+		Spec:       core.PersistentVolumeClaimSpec{StorageClassName: &storageClassName},
+	}
+	wh := newTestWatchHandler()
+	defer close(wh.stopChan)
+	claimInformer := wh.informerFactory.Core().V1().PersistentVolumeClaims().Informer()
+	volumeInformer := wh.informerFactory.Core().V1().PersistentVolumes().Informer()
+	storageClassInformer := wh.informerFactory.Storage().V1().StorageClasses().Informer()
+	wh.informerFactory.Start(wh.stopChan)
+	wh.informerFactory.WaitForCacheSync(wh.stopChan)
+	newTestMicroService(wh, 1, "default", "db", nil)
+	pod := wh.pdm[1].Front().Value.(MicroServiceData).Pod
+	pod.Spec.Volumes = []core.Volume{
+		{Name: "data", VolumeSource: core.VolumeSource{PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+		{Name: "logs", VolumeSource: core.VolumeSource{HostPath: &core.HostPathVolumeSource{Path: "/var/log"}}},
+	}
+
+	assert.NoError(t, claimInformer.GetStore().Add(claim))
+	assert.NoError(t, wh.persistentVolumeClaimEventHandler(&watch.Event{Type: watch.Added, Object: claim.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.PersistentVolumeClaims.Created))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Updated))
+	msd := wh.jsonReport.MicroServices.Updated[0].(MicroServiceData)
+	assert.Equal(t, []VolumeData{
+		{Name: "data", Type: "persistentVolumeClaim", ClaimName: "data", StorageClassName: "fast"},
+		{Name: "logs", Type: "hostPath", HostPath: "/var/log"},
+	}, msd.Volumes)
+
+	// the bound volume and the storage class resolve the claim
+	volume := &core.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-1", ResourceVersion: "2"},
+		Spec: core.PersistentVolumeSpec{
+			PersistentVolumeSource: core.PersistentVolumeSource{CSI: &core.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com"}},
+		},
+	}
+	assert.NoError(t, volumeInformer.GetStore().Add(volume))
+	assert.NoError(t, wh.persistentVolumeEventHandler(&watch.Event{Type: watch.Added, Object: volume.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.PersistentVolumes.Created))
+	// the volume is not bound yet, so the microservice is not reported
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Updated))
+
+	claim.Spec.VolumeName = "pv-1"
+	claim.ResourceVersion = "3"
+	assert.NoError(t, claimInformer.GetStore().Update(claim))
+	assert.NoError(t, wh.persistentVolumeClaimEventHandler(&watch.Event{Type: watch.Modified, Object: claim.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.PersistentVolumeClaims.Updated))
+	storageClass := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "fast", ResourceVersion: "4"},
+		Provisioner: "ebs.csi.aws.com",
+		Parameters:  map[string]string{"encrypted": "true"},
+	}
+	assert.NoError(t, storageClassInformer.GetStore().Add(storageClass))
+	assert.NoError(t, wh.storageClassEventHandler(&watch.Event{Type: watch.Added, Object: storageClass.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.StorageClasses.Created))
+	assert.Equal(t, 3, len(wh.jsonReport.MicroServices.Updated))
+	msd = wh.jsonReport.MicroServices.Updated[2].(MicroServiceData)
+	encrypted := true
+	assert.Equal(t, VolumeData{Name: "data", Type: "persistentVolumeClaim", ClaimName: "data", VolumeName: "pv-1", VolumeType: "csi",
+		StorageClassName: "fast", Provisioner: "ebs.csi.aws.com", Encrypted: &encrypted}, msd.Volumes[0])
+
+	// the microservices are reported only when their volumes change
+	assert.NoError(t, wh.storageClassEventHandler(&watch.Event{Type: watch.Modified, Object: storageClass.DeepCopy()}))
+	assert.Equal(t, 3, len(wh.jsonReport.MicroServices.Updated))
+}
@@ -5,18 +5,38 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"reflect"
 	"sync"
+	"sync/atomic"
 
+	"github.com/armosec/utils-go/boolutils"
 	"github.com/armosec/utils-k8s-go/armometadata"
 	"github.com/golang/glog"
+	"github.com/google/uuid"
 	"github.com/kubescape/k8s-interface/k8sinterface"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
 
-	apixv1beta1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes"
 )
 
+// lookupList returns the ID of the identity and the first element of its list in dm, nil when it's not there
+func lookupList(dm map[int]*list.List, identity ...string) (int, *list.Element) {
+	id, ok := getID(identity...)
+	if !ok || dm[id] == nil {
+		return 0, nil
+	}
+	return id, dm[id].Front()
+}
+
 type resourceMap struct {
 	resourceMap map[int]*list.List
 	mutex       sync.RWMutex
@@ -40,6 +60,13 @@ func (rm *resourceMap) remove(index int) {
 	defer rm.mutex.Unlock()
 	delete(rm.resourceMap, index)
 }
+
+// reset removes all the objects
+func (rm *resourceMap) reset() {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	rm.resourceMap = make(map[int]*list.List)
+}
 func (rm *resourceMap) getIDs() []int {
 	rm.mutex.RLock()
 	defer rm.mutex.RUnlock()
@@ -72,6 +99,20 @@ func (rm *resourceMap) updateFront(index int, obj interface{}) {
 		rm.resourceMap[index] = mapElem
 	}
 }
+
+// lookup returns the index of the identity and its first object, when it's stored
+func (rm *resourceMap) lookup(identity ...string) (int, interface{}, bool) {
+	index, ok := getID(identity...)
+	if !ok {
+		return 0, nil, false
+	}
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+	if mapElem := rm.resourceMap[index]; mapElem != nil && mapElem.Front() != nil {
+		return index, mapElem.Front().Value, true
+	}
+	return 0, nil, false
+}
 func (rm *resourceMap) len() int {
 	rm.mutex.RLock()
 	defer rm.mutex.RUnlock()
@@ -88,34 +129,118 @@ func (rm *resourceMap) indexLen(index int) int {
 }
 
 type WatchHandler struct {
-	extensionsClient apixv1beta1client.ApiextensionsV1beta1Interface
-	RestAPIClient    kubernetes.Interface
-	K8sApi           *k8sinterface.KubernetesApi
-	WebSocketHandle  *WebSocketHandler
+	RestAPIClient kubernetes.Interface
+	K8sApi        *k8sinterface.KubernetesApi
+	// WebSocketHandle is nil when the event receiver websocket is not one of the report sinks
+	WebSocketHandle *WebSocketHandler
+	sinks           []Sink
+	// maxReportSize is the size above which a report is split into chunks, zero for no limit
+	maxReportSize int
+	// configMapValues are the config maps whose values are reported
+	configMapValues []objectSelector
+	// eventsConfig selects the reported Kubernetes events, eventRateLimiter limits their rate
+	eventsConfig     eventsConfig
+	eventRateLimiter flowcontrol.RateLimiter
+	// resources are the resources of the config watched with the dynamic informers
+	resources []schema.GroupVersionResource
+	// shared informers, all the watchers and the owner lookups are served from their caches
+	informerFactory  informers.SharedInformerFactory
+	informerWatchers informerWatchers
+	stopChan         chan struct{}
+	// dynamic informers, for the resources without a typed client
+	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+	// owners resolves the owner chains of the pods, from the informer caches
+	owners *ownerResolver
 	// cluster info
 	clusterAPIServerVersion *version.Info
 	cloudVendor             string
-	// pods list
+	// pods list, by ID of the microservice
 	pdm map[int]*list.List
+	// pods are the pods in pdm, by namespace and name
+	pods map[string]podEntry
+	// cronJobIDs are the IDs of the microservices of the cronjobs in pdm, by namespace and name
+	cronJobIDs map[string]int
+	// ownerIDs are the IDs of the microservices in pdm, by namespace, kind and name of their owners: their top owner
+	// and the controllers in the owner chain of their first pod
+	ownerIDs map[string]map[int]bool
+	// pdmMutex guards pdm, pods, cronJobIDs and ownerIDs, which other watchers read to link their objects to the
+	// microservices
+	pdmMutex sync.RWMutex
+	// microServiceNotifiers are notified about the namespaces where microservices changed, by watcher kind
+	microServiceNotifiers      map[string]*namespaceNotifier
+	microServiceNotifiersMutex sync.Mutex
 	// node list
 	ndm map[int]*list.List
 	// services list
 	sdm map[int]*list.List
-	// pods list
-	cjm map[int]*list.List
 	// secrets list
 	secretdm *resourceMap
 	// namespaces list
 	namespacedm *resourceMap
+	// ingresses list
+	ingressdm *resourceMap
+	// gateways list
+	gatewaydm *resourceMap
+	// httproutes list
+	httproutedm *resourceMap
+	// network policies list
+	networkpolicydm *resourceMap
+	// roles list
+	roledm *resourceMap
+	// cluster roles list
+	clusterroledm *resourceMap
+	// role bindings list
+	rolebindingdm *resourceMap
+	// cluster role bindings list
+	clusterrolebindingdm *resourceMap
+	// service accounts list
+	serviceaccountdm *resourceMap
+	// config maps list
+	configmapdm *resourceMap
+	// objects of the resources of the config
+	resourcedm *resourceMap
+	// persistent volumes list
+	pvdm *resourceMap
+	// persistent volume claims list
+	pvcdm *resourceMap
+	// storage classes list
+	storageclassdm *resourceMap
+	// mutating webhook configurations list
+	mutatingwebhookdm *resourceMap
+	// validating webhook configurations list
+	validatingwebhookdm *resourceMap
+	// deployments list
+	deploymentdm *resourceMap
+	// stateful sets list
+	statefulsetdm *resourceMap
+	// daemon sets list
+	daemonsetdm *resourceMap
+	// jobs list
+	jobdm *resourceMap
+	// horizontal pod autoscalers list
+	hpadm *resourceMap
+	// pod disruption budgets list
+	pdbdm *resourceMap
+	// resource quotas list
+	resourcequotadm *resourceMap
+	// limit ranges list
+	limitrangedm *resourceMap
+	// the reported Kubernetes events
+	reportedEvents *reportedEvents
+	// the images the pods run
+	images *imageInventory
 
-	jsonReport             jsonFormat
-	informNewDataChannel   chan int
-	aggregateFirstDataFlag bool
-	// newStateReportChans is calling in a loop whenever new connection to BE is initialized
-	newStateReportChans []chan bool
-	includeNamespaces   []string
+	jsonReport           jsonFormat
+	reportSequenceNumber uint64
+	informNewDataChannel chan int
+	resyncChannel        chan struct{}
+	// aggregateFirstDataFlag is 1 while the first report is aggregated, it's read by the watchers
+	aggregateFirstDataFlag int32
+	includeNamespaces      []string
 
 	config *armometadata.ClusterConfig
+	// wasConnected is set after the first connection to the event receiver websocket
+	wasConnected bool
 
 	notifyUpdates iClusterNotifier // notify other (in-cluster) components about new data
 }
@@ -128,6 +253,7 @@ func CreateWatchHandler() (*WatchHandler, error) {
 		return nil, fmt.Errorf("missing config file: %s", err)
 	}
 	componentNamespace := os.Getenv(namespaceEnvironmentVariable)
+	setIDsClusterName(config.ClusterName)
 
 	if err := parseArgument(); err != nil {
 		return nil, fmt.Errorf("failed to parse args: %s", err.Error())
@@ -137,38 +263,103 @@ func CreateWatchHandler() (*WatchHandler, error) {
 	k8sAPiObj := k8sinterface.NewKubernetesApi()
 
 	restclient.SetDefaultWarningHandler(restclient.NoWarnings{})
-	extensionsClientSet, err := apixv1beta1client.NewForConfig(k8sinterface.GetK8sConfig())
+
+	collectorConfig, err := loadCollectorConfig(confFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("apiV1beta1client.NewForConfig failed: %s", err.Error())
+		return nil, err
 	}
-
-	erURL, err := setWebSocketURL(config)
+	sinks, webSocketHandler, err := createSinks(collectorConfig, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to set event receiver url: %s", err.Error())
+		return nil, fmt.Errorf("failed to create report sinks: %s", err.Error())
+	}
+	resources, err := collectorConfig.groupVersionResources()
+	if err != nil {
+		return nil, fmt.Errorf("invalid resources config: %s", err.Error())
 	}
 
 	result := WatchHandler{RestAPIClient: k8sAPiObj.KubernetesClient,
-		WebSocketHandle:  createWebSocketHandler(erURL),
-		extensionsClient: extensionsClientSet,
-		K8sApi:           k8sinterface.NewKubernetesApi(),
-		pdm:              make(map[int]*list.List),
-		ndm:              make(map[int]*list.List),
-		sdm:              make(map[int]*list.List),
-		cjm:              make(map[int]*list.List),
-		config:           config,
-		secretdm:         newResourceMap(),
-		namespacedm:      newResourceMap(),
+		WebSocketHandle:      webSocketHandler,
+		sinks:                sinks,
+		maxReportSize:        collectorConfig.MaxReportSizeKB * 1024,
+		configMapValues:      collectorConfig.ConfigMapValues,
+		eventsConfig:         collectorConfig.Events,
+		eventRateLimiter:     newEventRateLimiter(&collectorConfig.Events),
+		resources:            resources,
+		K8sApi:               k8sinterface.NewKubernetesApi(),
+		informerFactory:      newSharedInformerFactory(k8sAPiObj.KubernetesClient),
+		informerWatchers:     informerWatchers{watchers: make(map[cache.SharedIndexInformer]*informerWatcher), kinds: make(map[string]bool)},
+		stopChan:             make(chan struct{}),
+		pdm:                  make(map[int]*list.List),
+		pods:                 make(map[string]podEntry),
+		cronJobIDs:           make(map[string]int),
+		ownerIDs:             make(map[string]map[int]bool),
+		ndm:                  make(map[int]*list.List),
+		sdm:                  make(map[int]*list.List),
+		config:               config,
+		secretdm:             newResourceMap(),
+		namespacedm:          newResourceMap(),
+		ingressdm:            newResourceMap(),
+		gatewaydm:            newResourceMap(),
+		httproutedm:          newResourceMap(),
+		networkpolicydm:      newResourceMap(),
+		roledm:               newResourceMap(),
+		clusterroledm:        newResourceMap(),
+		rolebindingdm:        newResourceMap(),
+		clusterrolebindingdm: newResourceMap(),
+		serviceaccountdm:     newResourceMap(),
+		configmapdm:          newResourceMap(),
+		resourcedm:           newResourceMap(),
+		pvdm:                 newResourceMap(),
+		pvcdm:                newResourceMap(),
+		storageclassdm:       newResourceMap(),
+		mutatingwebhookdm:    newResourceMap(),
+		validatingwebhookdm:  newResourceMap(),
+		deploymentdm:         newResourceMap(),
+		statefulsetdm:        newResourceMap(),
+		daemonsetdm:          newResourceMap(),
+		jobdm:                newResourceMap(),
+		hpadm:                newResourceMap(),
+		pdbdm:                newResourceMap(),
+		resourcequotadm:      newResourceMap(),
+		limitrangedm:         newResourceMap(),
+		reportedEvents:       newReportedEvents(),
+		images:               newImageInventory(),
 		jsonReport: jsonFormat{
+			SessionID:   uuid.NewString(),
 			FirstReport: true,
 		},
-		informNewDataChannel:   make(chan int),
-		aggregateFirstDataFlag: true,
+		informNewDataChannel:   make(chan int, 1),
+		resyncChannel:          make(chan struct{}, 1),
+		aggregateFirstDataFlag: 1,
 		includeNamespaces:      []string{componentNamespace}, // ignore only the component namespace
 		notifyUpdates:          newInClusterNotifier(config),
 	}
+	if boolutils.StringToBool(os.Getenv(reportDeltasEnvironmentVariable)) {
+		glog.Info("reporting updates as deltas")
+		result.jsonReport.deltas = newReportDeltas()
+		if webSocketHandler != nil {
+			// the next deltas must not be based on the versions of the dropped reports
+			webSocketHandler.spool.onDrop = result.jsonReport.deltas.reset
+		}
+	}
+	result.dynamicInformerFactory = newDynamicSharedInformerFactory(k8sAPiObj.DynamicClient)
+	result.owners = newOwnerResolver(k8sAPiObj.DynamicClient, restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(k8sAPiObj.KubernetesClient.Discovery())),
+		result.informerFactory, result.dynamicInformerFactory, result.stopChan)
+	result.registerOwnerInformers()
 	return &result, nil
 }
 
+// registerOwnerInformers registers the informers of the pod owners, so GetOwnerData can answer from the cache.
+// They are started together with the first watcher
+func (wh *WatchHandler) registerOwnerInformers() {
+	setWatchErrorHandler(wh.informerFactory.Apps().V1().Deployments().Informer(), "deployment")
+	setWatchErrorHandler(wh.informerFactory.Apps().V1().DaemonSets().Informer(), "daemonset")
+	setWatchErrorHandler(wh.informerFactory.Apps().V1().StatefulSets().Informer(), "statefulset")
+	setWatchErrorHandler(wh.informerFactory.Batch().V1().Jobs().Informer(), "job")
+	setWatchErrorHandler(wh.informerFactory.Batch().V1().CronJobs().Informer(), "cronjob")
+	setWatchErrorHandler(wh.informerFactory.Core().V1().Pods().Informer(), "pod")
+}
+
 func parseArgument() error {
 
 	threFlag := flag.Lookup("stderrthreshold")
@@ -179,25 +370,117 @@ func parseArgument() error {
 	return nil
 }
 
-// SetFirstReportFlag set first report flag
+// SetFirstReportFlag set first report flag. On a first report every watcher resets its state and reports the current
+// state again, in its own goroutine
 func (wh *WatchHandler) SetFirstReportFlag(first bool) {
 	if wh.jsonReport.FirstReport == first {
 		return
 	}
 	wh.jsonReport.FirstReport = first
 	if first {
-		wh.ndm = make(map[int]*list.List)
+		// pdm is shared by the pods and the cronjobs watchers, it's reset before either of them reports again
+		wh.pdmMutex.Lock()
 		wh.pdm = make(map[int]*list.List)
-		wh.sdm = make(map[int]*list.List)
-		wh.cjm = make(map[int]*list.List)
-		wh.secretdm = newResourceMap()
-		wh.namespacedm = newResourceMap()
-		for chanIdx := range wh.newStateReportChans {
-			wh.newStateReportChans[chanIdx] <- true
+		wh.pods = make(map[string]podEntry)
+		wh.cronJobIDs = make(map[string]int)
+		wh.ownerIDs = make(map[string]map[int]bool)
+		wh.pdmMutex.Unlock()
+		// the objects of all the resources of the config are in resourcedm
+		wh.resourcedm.reset()
+		wh.jsonReport.deltas.reset()
+		wh.setAggregateFirstDataFlag(true)
+		// every watcher reports its current state and then confirms on the same channel
+		for _, newStateChan := range wh.informerWatchers.getNewStateChans() {
+			newStateChan <- true
+			<-newStateChan
 		}
 	}
 }
 
+// resetWatcherState forgets the objects of the watcher of the kind. It's called by the watcher before it reports its
+// current state again, the maps of a watcher are written only from its goroutine
+func (wh *WatchHandler) resetWatcherState(kind string) {
+	switch kind {
+	case "node":
+		wh.ndm = make(map[int]*list.List)
+	case "service":
+		wh.sdm = make(map[int]*list.List)
+	case "pod":
+		wh.images.reset()
+	case "event":
+		wh.reportedEvents.reset()
+	case "secret":
+		wh.secretdm.reset()
+	case "namespace":
+		wh.namespacedm.reset()
+	case "ingress":
+		wh.ingressdm.reset()
+	case "gateway":
+		wh.gatewaydm.reset()
+	case "httproute":
+		wh.httproutedm.reset()
+	case "networkpolicy":
+		wh.networkpolicydm.reset()
+	case "role":
+		wh.roledm.reset()
+	case "clusterrole":
+		wh.clusterroledm.reset()
+	case "rolebinding":
+		wh.rolebindingdm.reset()
+	case "clusterrolebinding":
+		wh.clusterrolebindingdm.reset()
+	case "serviceaccount":
+		wh.serviceaccountdm.reset()
+	case "configmap":
+		wh.configmapdm.reset()
+	case "persistentvolume":
+		wh.pvdm.reset()
+	case "persistentvolumeclaim":
+		wh.pvcdm.reset()
+	case "storageclass":
+		wh.storageclassdm.reset()
+	case "mutatingwebhookconfiguration":
+		wh.mutatingwebhookdm.reset()
+	case "validatingwebhookconfiguration":
+		wh.validatingwebhookdm.reset()
+	case "deployment":
+		wh.deploymentdm.reset()
+	case "statefulset":
+		wh.statefulsetdm.reset()
+	case "daemonset":
+		wh.daemonsetdm.reset()
+	case "job":
+		wh.jobdm.reset()
+	case "horizontalpodautoscaler":
+		wh.hpadm.reset()
+	case "poddisruptionbudget":
+		wh.pdbdm.reset()
+	case "resourcequota":
+		wh.resourcequotadm.reset()
+	case "limitrange":
+		wh.limitrangedm.reset()
+	}
+}
+
+// ConnectionStateChanged is called when the state of the connection to the event receiver websocket changes.
+// The reports pending in the spool are sent after reconnecting, the full state is reported again only when the spool
+// dropped some of them. Without acks the last reports written before the connection broke may be lost, so the next
+// updates are reported in full
+func (wh *WatchHandler) ConnectionStateChanged(state ConnectionState) {
+	if state != Connected {
+		return
+	}
+	if wh.wasConnected && !wh.WebSocketHandle.acks {
+		wh.jsonReport.deltas.reset()
+	}
+	// the reports dropped before the first connection are covered by the first report
+	if wh.WebSocketHandle.spool.takeDropped() && wh.wasConnected {
+		glog.Infof("reconnected to websocket, undelivered reports were dropped, reporting the full state")
+		wh.RequestResync()
+	}
+	wh.wasConnected = true
+}
+
 // getFirstReportFlag get first report flag
 func (wh *WatchHandler) getFirstReportFlag() bool {
 	return wh.jsonReport.FirstReport
@@ -212,7 +495,25 @@ func (wh *WatchHandler) isNamespaceWatched(namespace string) bool {
 	return false
 }
 
-// getAggregateFirstDataFlag return pointer
-func (wh *WatchHandler) getAggregateFirstDataFlag() *bool {
-	return &wh.aggregateFirstDataFlag
+// isObjectMetaChanged compares the parts of the metadata worth reporting, the resourceVersion and the managed fields
+// change on every write
+func isObjectMetaChanged(oldMeta, newMeta *metav1.ObjectMeta) bool {
+	return !reflect.DeepEqual(oldMeta.Labels, newMeta.Labels) ||
+		!reflect.DeepEqual(oldMeta.Annotations, newMeta.Annotations) ||
+		!reflect.DeepEqual(oldMeta.OwnerReferences, newMeta.OwnerReferences) ||
+		!reflect.DeepEqual(oldMeta.Finalizers, newMeta.Finalizers) ||
+		!oldMeta.DeletionTimestamp.Equal(newMeta.DeletionTimestamp)
+}
+
+// getAggregateFirstDataFlag returns true while the first report is aggregated
+func (wh *WatchHandler) getAggregateFirstDataFlag() bool {
+	return atomic.LoadInt32(&wh.aggregateFirstDataFlag) == 1
+}
+
+func (wh *WatchHandler) setAggregateFirstDataFlag(aggregate bool) {
+	var flag int32
+	if aggregate {
+		flag = 1
+	}
+	atomic.StoreInt32(&wh.aggregateFirstDataFlag, flag)
 }
@@ -0,0 +1,121 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+
+	"github.com/golang/glog"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// WebhookFacts are the facts about an admission webhook telling how it can be abused to persist in the cluster or
+// to bypass its policies
+type WebhookFacts struct {
+	Name string `json:"name"`
+	// FailOpen is set when the failure policy is Ignore, the requests are admitted when the webhook is down
+	FailOpen bool `json:"failOpen"`
+	// AllNamespaces is set when the webhook has no namespace selector, kube-system included
+	AllNamespaces bool `json:"allNamespaces"`
+	// Service is the namespace/name of the in-cluster service the webhook calls
+	Service string `json:"service,omitempty"`
+	// URL is the URL the webhook calls, when it's not an in-cluster service
+	URL      string `json:"url,omitempty"`
+	External bool   `json:"external"`
+}
+
+// mutatingWebhookData is the reported mutating webhook configuration, with the facts about its webhooks
+type mutatingWebhookData struct {
+	*admissionregistrationv1.MutatingWebhookConfiguration `json:",inline"`
+	Facts                                                 []WebhookFacts `json:"facts"`
+}
+
+// validatingWebhookData is the reported validating webhook configuration, with the facts about its webhooks
+type validatingWebhookData struct {
+	*admissionregistrationv1.ValidatingWebhookConfiguration `json:",inline"`
+	Facts                                                   []WebhookFacts `json:"facts"`
+}
+
+// MutatingWebhookWatch watch over mutating webhook configurations
+func (wh *WatchHandler) MutatingWebhookWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER MutatingWebhookWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over mutating webhook configurations starting")
+	mutatingWebhookWatcher := wh.watchInformer(wh.informerFactory.Admissionregistration().V1().MutatingWebhookConfigurations().Informer(), "mutatingwebhookconfiguration")
+	glog.Infof("Watching over mutating webhook configurations started")
+	wh.handleInformerEvents(mutatingWebhookWatcher, "mutatingwebhookconfiguration", wh.mutatingWebhookEventHandler)
+}
+
+// ValidatingWebhookWatch watch over validating webhook configurations
+func (wh *WatchHandler) ValidatingWebhookWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER ValidatingWebhookWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over validating webhook configurations starting")
+	validatingWebhookWatcher := wh.watchInformer(wh.informerFactory.Admissionregistration().V1().ValidatingWebhookConfigurations().Informer(), "validatingwebhookconfiguration")
+	glog.Infof("Watching over validating webhook configurations started")
+	wh.handleInformerEvents(validatingWebhookWatcher, "validatingwebhookconfiguration", wh.validatingWebhookEventHandler)
+}
+
+func (wh *WatchHandler) mutatingWebhookEventHandler(event *watch.Event) error {
+	configuration, ok := event.Object.(*admissionregistrationv1.MutatingWebhookConfiguration)
+	if !ok {
+		return fmt.Errorf("got unexpected mutating webhook configuration from chan")
+	}
+	data := &mutatingWebhookData{MutatingWebhookConfiguration: configuration, Facts: make([]WebhookFacts, 0, len(configuration.Webhooks))}
+	for i := range configuration.Webhooks {
+		webhook := &configuration.Webhooks[i]
+		data.Facts = append(data.Facts, newWebhookFacts(webhook.Name, &webhook.ClientConfig, webhook.FailurePolicy, webhook.NamespaceSelector))
+	}
+	wh.reportObjectEvent("mutating webhook configuration", event.Type, data, wh.mutatingwebhookdm, MUTATINGWEBHOOKS, isMutatingWebhookChanged)
+	return nil
+}
+
+func (wh *WatchHandler) validatingWebhookEventHandler(event *watch.Event) error {
+	configuration, ok := event.Object.(*admissionregistrationv1.ValidatingWebhookConfiguration)
+	if !ok {
+		return fmt.Errorf("got unexpected validating webhook configuration from chan")
+	}
+	data := &validatingWebhookData{ValidatingWebhookConfiguration: configuration, Facts: make([]WebhookFacts, 0, len(configuration.Webhooks))}
+	for i := range configuration.Webhooks {
+		webhook := &configuration.Webhooks[i]
+		data.Facts = append(data.Facts, newWebhookFacts(webhook.Name, &webhook.ClientConfig, webhook.FailurePolicy, webhook.NamespaceSelector))
+	}
+	wh.reportObjectEvent("validating webhook configuration", event.Type, data, wh.validatingwebhookdm, VALIDATINGWEBHOOKS, isValidatingWebhookChanged)
+	return nil
+}
+
+func newWebhookFacts(name string, clientConfig *admissionregistrationv1.WebhookClientConfig, failurePolicy *admissionregistrationv1.FailurePolicyType, namespaceSelector *metav1.LabelSelector) WebhookFacts {
+	facts := WebhookFacts{
+		Name: name,
+		// the failure policy defaults to Fail
+		FailOpen:      failurePolicy != nil && *failurePolicy == admissionregistrationv1.Ignore,
+		AllNamespaces: namespaceSelector == nil || (len(namespaceSelector.MatchLabels) == 0 && len(namespaceSelector.MatchExpressions) == 0),
+	}
+	if clientConfig.Service != nil {
+		facts.Service = clientConfig.Service.Namespace + "/" + clientConfig.Service.Name
+	} else if clientConfig.URL != nil {
+		facts.URL = *clientConfig.URL
+		facts.External = true
+	}
+	return facts
+}
+
+func isMutatingWebhookChanged(oldObj, newObj watchedObject) bool {
+	oldData, newData := oldObj.(*mutatingWebhookData), newObj.(*mutatingWebhookData)
+	return isObjectMetaChanged(&oldData.ObjectMeta, &newData.ObjectMeta) ||
+		!reflect.DeepEqual(oldData.Webhooks, newData.Webhooks)
+}
+
+func isValidatingWebhookChanged(oldObj, newObj watchedObject) bool {
+	oldData, newData := oldObj.(*validatingWebhookData), newObj.(*validatingWebhookData)
+	return isObjectMetaChanged(&oldData.ObjectMeta, &newData.ObjectMeta) ||
+		!reflect.DeepEqual(oldData.Webhooks, newData.Webhooks)
+}
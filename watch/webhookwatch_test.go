@@ -0,0 +1,65 @@
+package watch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestNewWebhookFacts(t *testing.T) {
+	ignore := admissionregistrationv1.Ignore
+	url := "https://webhook.example.com/mutate"
+	facts := newWebhookFacts("external.example.com", &admissionregistrationv1.WebhookClientConfig{URL: &url}, &ignore, &metav1.LabelSelector{})
+	assert.Equal(t, WebhookFacts{Name: "external.example.com", FailOpen: true, AllNamespaces: true, URL: url, External: true}, facts)
+
+	fail := admissionregistrationv1.Fail
+	facts = newWebhookFacts("policy.example.com",
+		&admissionregistrationv1.WebhookClientConfig{Service: &admissionregistrationv1.ServiceReference{Namespace: "policy", Name: "webhook"}},
+		&fail, &metav1.LabelSelector{MatchLabels: map[string]string{"policy": "enforced"}})
+	assert.Equal(t, WebhookFacts{Name: "policy.example.com", Service: "policy/webhook"}, facts)
+}
+
+func TestWebhookEventHandlers(t *testing.T) {
+	wh := newTestWatchHandler()
+	ignore := admissionregistrationv1.Ignore
+	mutating := &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "injector", ResourceVersion: "1"},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{{
+			Name:          "inject.example.com",
+			ClientConfig:  admissionregistrationv1.WebhookClientConfig{Service: &admissionregistrationv1.ServiceReference{Namespace: "injector", Name: "injector"}},
+			FailurePolicy: &ignore,
+		}},
+	}
+	assert.NoError(t, wh.mutatingWebhookEventHandler(&watch.Event{Type: watch.Added, Object: mutating.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.MutatingWebhooks.Created))
+	data, err := json.Marshal(wh.jsonReport.MutatingWebhooks.Created[0])
+	assert.NoError(t, err)
+	reported := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(data, &reported))
+	assert.Equal(t, "injector", reported["metadata"].(map[string]interface{})["name"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "inject.example.com", "failOpen": true, "allNamespaces": true, "service": "injector/injector", "external": false}}, reported["facts"])
+
+	// unchanged
+	mutating.ResourceVersion = "2"
+	assert.NoError(t, wh.mutatingWebhookEventHandler(&watch.Event{Type: watch.Modified, Object: mutating.DeepCopy()}))
+	assert.Nil(t, wh.jsonReport.MutatingWebhooks.Updated)
+
+	mutating.Webhooks[0].FailurePolicy = nil
+	assert.NoError(t, wh.mutatingWebhookEventHandler(&watch.Event{Type: watch.Modified, Object: mutating.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.MutatingWebhooks.Updated))
+	assert.False(t, wh.jsonReport.MutatingWebhooks.Updated[0].(*mutatingWebhookData).Facts[0].FailOpen)
+
+	validating := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy", ResourceVersion: "3"},
+		Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "validate.example.com"}},
+	}
+	assert.NoError(t, wh.validatingWebhookEventHandler(&watch.Event{Type: watch.Added, Object: validating.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.ValidatingWebhooks.Created))
+	assert.NoError(t, wh.validatingWebhookEventHandler(&watch.Event{Type: watch.Deleted, Object: validating.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.ValidatingWebhooks.Deleted))
+	assert.Equal(t, 0, wh.validatingwebhookdm.len())
+}
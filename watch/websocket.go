@@ -1,13 +1,14 @@
 package watch
 
 import (
-	"fmt"
+	"encoding/json"
 	"math/rand"
 	"net/url"
 	"os"
 	"runtime/debug"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armosec/utils-k8s-go/armometadata"
@@ -15,37 +16,89 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-type ReqType int
-
 const (
 	customerGuidQueryParamKey  = "customerGUID"
 	clusterNameQueryParamKey   = "clusterName"
+	acksQueryParamKey          = "acks"
 	EventReceiverWebsocketPath = "/k8s/cluster-reports"
 )
 
+// messages of the server
 const (
-	PING    ReqType = 0
-	MESSAGE ReqType = 1
-	EXIT    ReqType = 2
+	// ackServerMessage acks the reports of the session up to the sequence number
+	ackServerMessage = "ack"
+	// resyncServerMessage requests the full cluster state
+	resyncServerMessage = "resync"
 )
 
+type serverMessage struct {
+	Type           string `json:"type"`
+	SessionID      string `json:"sessionID,omitempty"`
+	SequenceNumber uint64 `json:"sequenceNumber,omitempty"`
+}
+
+// ConnectionState is the state of the connection to the event receiver websocket
+type ConnectionState int
+
 const (
-	WaitBeforeReportEnv = "WAIT_BEFORE_REPORT"
+	Disconnected ConnectionState = 0
+	Connecting   ConnectionState = 1
+	Connected    ConnectionState = 2
 )
 
-type DataSocket struct {
-	message string
-	RType   ReqType
+func (state ConnectionState) String() string {
+	switch state {
+	case Disconnected:
+		return "disconnected"
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	}
+	return "unknown"
 }
 
+const (
+	WaitBeforeReportEnv = "WAIT_BEFORE_REPORT"
+)
+
 type WebSocketHandler struct {
-	data       chan DataSocket
+	// spool keeps the reports until they are written to the websocket, or acked by the server when acks is set
+	spool      *reportSpool
+	acks       bool
+	encoding   reportEncoding
 	u          url.URL
-	mutex      *sync.Mutex
+	dialer     *websocket.Dialer
 	SignalChan chan os.Signal
+	backoff    *backoff
+	state      ConnectionState
+	// resyncCallback is called when the server requests the full cluster state
+	resyncCallback func()
+	// stateCallback is called when the state of the connection changes
+	stateCallback func(ConnectionState)
+}
+
+// webSocketConnection is a single connection to the websocket, closed once by whichever of the routines
+// using it fails first
+type webSocketConnection struct {
+	*websocket.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newWebSocketConnection(conn *websocket.Conn) *webSocketConnection {
+	return &webSocketConnection{Conn: conn, closed: make(chan struct{})}
+}
+
+func (conn *webSocketConnection) close(reason string) {
+	conn.closeOnce.Do(func() {
+		glog.Infof("closing connection: %s", reason)
+		conn.Close()
+		close(conn.closed)
+	})
 }
 
-func setWebSocketURL(config *armometadata.ClusterConfig) (*url.URL, error) {
+func setWebSocketURL(config *armometadata.ClusterConfig, collectorConfig *collectorConfig) (*url.URL, error) {
 	u, err := url.Parse(config.EventReceiverWebsocketURL)
 	if err != nil {
 		return nil, err
@@ -54,122 +107,156 @@ func setWebSocketURL(config *armometadata.ClusterConfig) (*url.URL, error) {
 	q := u.Query()
 	q.Add(customerGuidQueryParamKey, config.AccountID)
 	q.Add(clusterNameQueryParamKey, config.ClusterName)
+	if collectorConfig.ReportAcks {
+		// let the server know it should ack the reports
+		q.Add(acksQueryParamKey, "true")
+	}
+	collectorConfig.ReportEncoding.addQueryParams(q)
 	u.RawQuery = q.Encode()
 	u.ForceQuery = true
 
 	return u, nil
 }
-func createWebSocketHandler(u *url.URL) *WebSocketHandler {
+func createWebSocketHandler(u *url.URL, spool *reportSpool, collectorConfig *collectorConfig) *WebSocketHandler {
 	glog.Infof("websocket URL: %s", u.String())
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = collectorConfig.ReportEncoding.PermessageDeflate
 	wsh := WebSocketHandler{
 		u:          *u,
-		data:       make(chan DataSocket),
-		mutex:      &sync.Mutex{},
+		dialer:     &dialer,
+		spool:      spool,
+		acks:       collectorConfig.ReportAcks,
+		encoding:   collectorConfig.ReportEncoding,
 		SignalChan: make(chan os.Signal),
+		backoff:    newBackoff(reconnectMinDelay, reconnectMaxDelay),
 	}
 	return &wsh
 }
 
-func (wsh *WebSocketHandler) connectToWebSocket(sleepBeforeConnection time.Duration) (*websocket.Conn, error) {
-
-	var err error
-	var conn *websocket.Conn
-
-	tries := 5
-	for reconnectionCounter := 0; reconnectionCounter < tries; reconnectionCounter++ {
-		randomDelay := rand.Int63n(int64(reconnectionCounter+1)*int64(sleepBeforeConnection)) / int64(time.Second)
-		glog.Infof("connect try: %d, waiting for %d seconds", reconnectionCounter, randomDelay)
-		time.Sleep(time.Second * time.Duration(randomDelay))
-		if conn, _, err = websocket.DefaultDialer.Dial(wsh.u.String(), nil); err == nil {
-			glog.Infof("connected successfully to: '%s", wsh.u.String())
-			wsh.setPingPongHandler(conn)
-			return conn, nil
-		}
-		glog.Error(err)
+func (wsh *WebSocketHandler) connectToWebSocket() (*webSocketConnection, error) {
+	wsh.setState(Connecting)
+	conn, _, err := wsh.dialer.Dial(wsh.u.String(), nil)
+	if err != nil {
+		return nil, err
 	}
+	glog.Infof("connected successfully to: '%s", wsh.u.String())
+	wsConn := newWebSocketConnection(conn)
+	wsh.setPingPongHandler(wsConn)
+	return wsConn, nil
+}
 
-	err = fmt.Errorf("cant connect to websocket after %d tries", tries)
-	glog.Error(err)
-	return nil, err
-
+func (wsh *WebSocketHandler) setState(state ConnectionState) {
+	if wsh.state == state {
+		return
+	}
+	glog.Infof("websocket %s", state)
+	wsh.state = state
+	if wsh.stateCallback != nil {
+		wsh.stateCallback(state)
+	}
 }
 
-// SendReportRoutine function sending updates
-func (wsh *WebSocketHandler) SendReportRoutine(isServerReady *bool, reconnectCallback func(bool)) error {
+// SendReportRoutine function sending updates. It connects to the websocket and reconnects whenever the connection
+// breaks, waiting between the tries with an exponential backoff. resyncCallback is called when the server requests
+// the full cluster state, and stateCallback when the state of the connection changes
+func (wsh *WebSocketHandler) SendReportRoutine(isServerReady *bool, resyncCallback func(), stateCallback func(ConnectionState)) error {
 	defer func() {
 		if err := recover(); err != nil {
 			glog.Errorf("RECOVER sendReportRoutine. %v, stack: %s", err, debug.Stack())
 		}
 	}()
+	wsh.resyncCallback = resyncCallback
+	wsh.stateCallback = stateCallback
+
+	// spread the connections of the clusters starting together
+	if t := getNumericValueFromEnvVar(WaitBeforeReportEnv, 30); t > 0 {
+		randomDelay := time.Duration(rand.Int63n(int64(t) * int64(time.Second)))
+		glog.Infof("waiting for %s before connecting", randomDelay.Round(time.Second))
+		time.Sleep(randomDelay)
+	}
 	for {
-		t := getNumericValueFromEnvVar(WaitBeforeReportEnv, 30)
-		conn, err := wsh.connectToWebSocket(time.Duration(t) * time.Second)
+		conn, err := wsh.connectToWebSocket()
 		if err != nil {
-			glog.Error(err)
-			return err
+			wsh.setState(Disconnected)
+			delay := wsh.backoff.next()
+			glog.Errorf("failed to connect to websocket, retrying in %s. reason: %s", delay.Round(time.Millisecond), err.Error())
+			time.Sleep(delay)
+			continue
 		}
+		connectedAt := time.Now()
 		*isServerReady = true
+		wsh.setState(Connected)
+		// the reports sent on the previous connection and never acked are sent again
+		if resent := wsh.spool.resend(); resent > 0 {
+			glog.Infof("resending %d unacked reports", resent)
+		}
 
-		wsh.handleSendReportRoutine(conn, reconnectCallback)
-	}
+		wsh.handleSendReportRoutine(conn)
 
-	// use mutex for writing message that way if write failed only the failed writing will reconnect
+		wsh.setState(Disconnected)
+		// a connection breaking right away is retried with a growing delay too
+		if time.Since(connectedAt) > wsh.backoff.max {
+			wsh.backoff.reset()
+		}
+		delay := wsh.backoff.next()
+		glog.Infof("reconnecting in %s", delay.Round(time.Millisecond))
+		time.Sleep(delay)
+	}
 }
 
-func (wsh *WebSocketHandler) handleSendReportRoutine(conn *websocket.Conn, reconnectCallback func(bool)) error {
-ReconnectLoop:
+// handleSendReportRoutine writes the spooled reports to the websocket, oldest first, until the connection breaks.
+// A report is removed from the spool only after it was written, or acked when acks is set, so the reports pending
+// when the connection breaks are sent after reconnecting
+func (wsh *WebSocketHandler) handleSendReportRoutine(conn *webSocketConnection) {
 	for {
-		data := <-wsh.data
-		wsh.mutex.Lock()
-
-		switch data.RType {
-		case MESSAGE:
-			timeID := time.Now().UnixNano()
-			glog.Infof("sending message, %d", timeID)
-
-			err := conn.WriteMessage(websocket.TextMessage, []byte(data.message))
-			if err != nil {
-				// count on K8s pod lifecycle logic to restart the process again and then reconnect
-				os.Exit(4)
-
-				glog.Errorf("In sendReportRoutine, %d, WriteMessage to websocket: %v", data.RType, err)
-				if reconnectCallback != nil {
-					reconnectCallback(true)
-				}
-				t := getNumericValueFromEnvVar(WaitBeforeReportEnv, 60)
-				if conn, err = wsh.connectToWebSocket(time.Duration(t) * time.Second); err != nil {
-					// TODO: handle retries
-					glog.Errorf("sendReportRoutine. %s", err.Error())
-					wsh.mutex.Unlock()
-					break ReconnectLoop
-				}
-				if reconnectCallback == nil {
-					glog.Infof("resending message. %d", timeID)
-					err := conn.WriteMessage(websocket.TextMessage, []byte(data.message))
-					if err != nil {
-						wsh.mutex.Unlock()
-						glog.Errorf("WriteMessage, %d, %v", timeID, err)
-						return fmt.Errorf("failed to connect to websocket")
-					}
-					glog.Infof("message resent, %d", timeID)
-				}
-			} else {
-				glog.Infof("message sent, %d", timeID)
+		seq, report, ok := wsh.spool.peek()
+		if !ok {
+			select {
+			case <-wsh.spool.notify:
+				continue
+			case <-conn.closed:
+				return
 			}
-		case EXIT:
-			glog.Warningf("websocket received exit code exit. message: %s", data.message)
-			// count on K8s pod lifecycle logic to restart the process again and then reconnect
-			os.Exit(4)
 		}
-		wsh.mutex.Unlock()
+		select {
+		case <-conn.closed:
+			return
+		default:
+		}
+
+		message, messageType, err := wsh.encoding.encode(report)
+		if err != nil {
+			// the report is not lost, the server tells the JSON reports by their text message type
+			glog.Errorf("In sendReportRoutine, %d, sending the report as json: %s", seq, err.Error())
+			message, messageType = report, websocket.TextMessage
+		}
+		glog.Infof("sending message, %d", seq)
+		if err := conn.WriteMessage(messageType, message); err != nil {
+			glog.Errorf("In sendReportRoutine, %d, WriteMessage to websocket: %v", seq, err)
+			conn.close("write message error")
+			return
+		}
+		if wsh.acks {
+			wsh.spool.markSent(seq)
+		} else {
+			wsh.spool.remove(seq)
+		}
+		glog.Infof("message sent, %d", seq)
 	}
-	return nil
 }
 
 func (wh *WatchHandler) SendMessageToWebSocket(jsonData []byte) {
-	data := DataSocket{message: string(jsonData), RType: MESSAGE}
+	wh.WebSocketHandle.Send(jsonData)
+}
 
-	wh.WebSocketHandle.data <- data
+// Name of the websocket sink
+func (wsh *WebSocketHandler) Name() string {
+	return "websocket sink " + wsh.u.Host
+}
+
+// Send adds the report to the spool, the routine writing to the websocket sends it once connected
+func (wsh *WebSocketHandler) Send(report []byte) error {
+	return wsh.spool.push(report)
 }
 
 // ListenerAndSender listen for changes in cluster and send reports to websocket
@@ -184,89 +271,94 @@ func (wh *WatchHandler) ListenerAndSender() {
 	// in the first time we wait until all the data will arrive from the cluster and the we will inform on every change
 	glog.Infof("wait %d seconds for aggregate the first data from the cluster\n", waitingDuration)
 	time.Sleep(waitingDelay)
+	wh.waitForWatchersSync()
 	wh.SetFirstReportFlag(true)
 	for {
-		jsonData := prepareDataToSend(wh)
-		if jsonData != nil {
+		for _, jsonData := range prepareDataToSend(wh) {
 			if os.Getenv(printReportEnvironmentVariable) == "true" { // TODO: use logger levels instead
 				glog.Infof("%s", string(jsonData))
 			}
-			wh.SendMessageToWebSocket(jsonData)
+			wh.sendToSinks(jsonData)
 		}
 		if wh.getFirstReportFlag() {
 			wh.SetFirstReportFlag(false)
 		}
-		if WaitTillNewDataArrived(wh) {
-			continue
+		if !WaitTillNewDataArrived(wh) {
+			// the server lost track of the reports, report the full state again
+			wh.SetFirstReportFlag(true)
 		}
 	}
 }
 
-func (wsh *WebSocketHandler) setPingPongHandler(conn *websocket.Conn) {
-	end := false
+// setPingPongHandler starts the routines pinging the server and reading its messages, the connection is closed
+// when the server misses 3 pings or the read fails
+func (wsh *WebSocketHandler) setPingPongHandler(conn *webSocketConnection) {
 	timeout := 10 * time.Second
-	go func() {
-		counter := 0
-		defaultPING := conn.PingHandler()
-		conn.SetPingHandler(func(message string) error {
-			counter = 0
-			return defaultPING(message)
-		})
-
-		defaultPONG := conn.PongHandler()
-		conn.SetPongHandler(func(message string) error {
-			counter = 0
-			return defaultPONG(message)
-		})
+	var missedPings int32
+	defaultPING := conn.PingHandler()
+	conn.SetPingHandler(func(message string) error {
+		atomic.StoreInt32(&missedPings, 0)
+		return defaultPING(message)
+	})
+
+	defaultPONG := conn.PongHandler()
+	conn.SetPongHandler(func(message string) error {
+		atomic.StoreInt32(&missedPings, 0)
+		return defaultPONG(message)
+	})
 
+	go func() {
 		// test ping-pong
 		for {
-			if end {
-				break
-			}
 			err := conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(timeout))
 			if err != nil {
 				glog.Errorf("WriteControl error: %s", err.Error())
 			}
-			if counter > 2 {
-				if end {
-					return
-				}
+			if atomic.LoadInt32(&missedPings) > 2 {
 				glog.Errorf("ping closed connection")
-				wsh.closeConnection(conn, "ping error")
-				end = true
+				conn.close("ping error")
+				return
+			}
+			select {
+			case <-conn.closed:
 				return
+			case <-time.After(timeout):
 			}
-			time.Sleep(timeout)
-			counter++
+			atomic.AddInt32(&missedPings, 1)
 		}
 	}()
 	go func() {
 		for {
-			if end {
-				break
-			}
-			if _, _, err := conn.ReadMessage(); err != nil {
-				if end {
-					break
-				}
-				end = true
+			_, message, err := conn.ReadMessage()
+			if err != nil {
 				glog.Errorf("read message closed connection: %s", err.Error())
-				wsh.closeConnection(conn, "read message error")
-				break
+				conn.close("read message error")
+				return
 			}
-			time.Sleep(timeout)
+			wsh.handleServerMessage(message)
 		}
 	}()
 }
 
-func (wsh *WebSocketHandler) closeConnection(conn *websocket.Conn, message string) {
-	glog.Infof("closing connection: %s", message)
-	wsh.mutex.Lock()
-	conn.Close()
-	wsh.mutex.Unlock()
-	glog.Infof("connection closed: %s", message)
-	wsh.data <- DataSocket{RType: EXIT, message: message}
+// handleServerMessage handles the acks and the resync requests of the server
+func (wsh *WebSocketHandler) handleServerMessage(message []byte) {
+	msg := serverMessage{}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		glog.Warningf("unknown message from server: %s", err.Error())
+		return
+	}
+	switch msg.Type {
+	case ackServerMessage:
+		acked := wsh.spool.ack(msg.SessionID, msg.SequenceNumber)
+		glog.Infof("server acked report %d of session %s, %d reports removed from spool", msg.SequenceNumber, msg.SessionID, acked)
+	case resyncServerMessage:
+		glog.Infof("server requested a resync")
+		if wsh.resyncCallback != nil {
+			wsh.resyncCallback()
+		}
+	default:
+		glog.Warningf("unknown message type from server: '%s'", msg.Type)
+	}
 }
 
 func getNumericValueFromEnvVar(envVar string, defaultValue int) int {
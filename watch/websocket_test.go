@@ -0,0 +1,176 @@
+package watch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHandleServerMessage(t *testing.T) {
+	spool, err := newReportSpool(&spoolConfig{})
+	assert.NoError(t, err)
+	resync := false
+	wsh := &WebSocketHandler{spool: spool, acks: true, resyncCallback: func() { resync = true }}
+
+	assert.NoError(t, spool.push([]byte(`{"sessionID":"a","sequenceNumber":1}`)))
+	seq, _, _ := spool.peek()
+	spool.markSent(seq)
+	wsh.handleServerMessage([]byte(`{"type":"ack","sessionID":"a","sequenceNumber":1}`))
+	assert.Equal(t, 0, spool.len())
+
+	wsh.handleServerMessage([]byte(`not json`))
+	wsh.handleServerMessage([]byte(`{"type":"hello"}`))
+	assert.False(t, resync)
+	wsh.handleServerMessage([]byte(`{"type":"resync"}`))
+	assert.True(t, resync)
+}
+
+func TestRequestResync(t *testing.T) {
+	wh := newTestWatchHandler()
+	wh.RequestResync()
+	wh.RequestResync()
+	assert.False(t, WaitTillNewDataArrived(wh))
+	informNewDataArrive(wh)
+	wh.setAggregateFirstDataFlag(false)
+	informNewDataArrive(wh)
+	assert.True(t, WaitTillNewDataArrived(wh))
+}
+
+func TestConnectionStateChanged(t *testing.T) {
+	wh := newTestWatchHandler()
+	spool, err := newReportSpool(&spoolConfig{})
+	assert.NoError(t, err)
+	wh.WebSocketHandle = &WebSocketHandler{spool: spool}
+	spool.maxSize = 1
+	assert.NoError(t, spool.push([]byte("dropped before connecting")))
+	assert.NoError(t, spool.push([]byte("pending")))
+
+	// the first report has the full state
+	wh.ConnectionStateChanged(Connected)
+	assert.Equal(t, 0, len(wh.resyncChannel))
+
+	// the pending reports are sent after reconnecting, the updates after them are reported in full without acks
+	wh.jsonReport.deltas = newReportDeltas()
+	service := &core.Service{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: "1234", ResourceVersion: "1"}}
+	wh.jsonReport.AddToJsonFormat(service.DeepCopy(), SERVICES, CREATED)
+	wh.ConnectionStateChanged(Disconnected)
+	wh.ConnectionStateChanged(Connected)
+	assert.Equal(t, 0, len(wh.resyncChannel))
+	service.ResourceVersion = "2"
+	wh.jsonReport.AddToJsonFormat(service.DeepCopy(), SERVICES, UPDATED)
+	assert.IsType(t, &core.Service{}, wh.jsonReport.Services.Updated[0])
+
+	// the full state is reported again when reports were dropped
+	assert.NoError(t, spool.push([]byte("pending too")))
+	wh.ConnectionStateChanged(Disconnected)
+	wh.ConnectionStateChanged(Connected)
+	assert.Equal(t, 1, len(wh.resyncChannel))
+}
+
+func TestSendReportRoutineReconnects(t *testing.T) {
+	t.Setenv(WaitBeforeReportEnv, "0")
+	received := make(chan string, 10)
+	var connections int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		connection := atomic.AddInt32(&connections, 1)
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		received <- string(message)
+		if connection == 1 {
+			// break the first connection
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	u.Scheme = "ws"
+	spool, err := newReportSpool(&spoolConfig{})
+	assert.NoError(t, err)
+	wsh := createWebSocketHandler(u, spool, &collectorConfig{})
+	wsh.backoff = newBackoff(10*time.Millisecond, 50*time.Millisecond)
+	states := make(chan ConnectionState, 10)
+	isServerReady := false
+	go wsh.SendReportRoutine(&isServerReady, nil, func(state ConnectionState) { states <- state })
+
+	assert.NoError(t, wsh.Send([]byte("first")))
+	assert.Equal(t, "first", <-received)
+
+	var seen []ConnectionState
+	for len(seen) < 5 {
+		select {
+		case state := <-states:
+			seen = append(seen, state)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("not reconnected, states: %v", seen)
+		}
+	}
+	assert.Equal(t, []ConnectionState{Connecting, Connected, Disconnected, Connecting, Connected}, seen)
+
+	assert.NoError(t, wsh.Send([]byte("second")))
+	select {
+	case message := <-received:
+		assert.Equal(t, "second", message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("report not sent after reconnecting")
+	}
+}
+
+func TestSendReportEncodingError(t *testing.T) {
+	t.Setenv(WaitBeforeReportEnv, "0")
+	received := make(chan int, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		messageType, _, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		received <- messageType
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	u.Scheme = "ws"
+	spool, err := newReportSpool(&spoolConfig{})
+	assert.NoError(t, err)
+	wsh := createWebSocketHandler(u, spool, &collectorConfig{ReportEncoding: reportEncoding{Format: cborReportFormat}})
+	isServerReady := false
+	go wsh.SendReportRoutine(&isServerReady, nil, nil)
+
+	// a report that can't be encoded is sent as json
+	assert.NoError(t, wsh.Send([]byte(`{"firstReport":`)))
+	select {
+	case messageType := <-received:
+		assert.Equal(t, websocket.TextMessage, messageType)
+	case <-time.After(5 * time.Second):
+		t.Fatal("report not sent")
+	}
+	assert.Eventually(t, func() bool { return spool.len() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
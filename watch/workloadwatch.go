@@ -0,0 +1,295 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strings"
+
+	"github.com/golang/glog"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// the rollout states of a workload
+const (
+	RolloutComplete    = "Complete"
+	RolloutProgressing = "Progressing"
+	RolloutFailed      = "Failed"
+)
+
+// WorkloadStatus is the replicas and the rollout state of a workload. For jobs, the replicas are the completions,
+// the ready replicas the active pods and the available replicas the succeeded pods
+type WorkloadStatus struct {
+	Replicas          int32  `json:"replicas"`
+	ReadyReplicas     int32  `json:"readyReplicas"`
+	UpdatedReplicas   int32  `json:"updatedReplicas"`
+	AvailableReplicas int32  `json:"availableReplicas"`
+	Rollout           string `json:"rollout"`
+}
+
+// deploymentData is the reported deployment, with its status
+type deploymentData struct {
+	*appsv1.Deployment `json:",inline"`
+	WorkloadStatus     WorkloadStatus `json:"workloadStatus"`
+}
+
+// statefulSetData is the reported stateful set, with its status
+type statefulSetData struct {
+	*appsv1.StatefulSet `json:",inline"`
+	WorkloadStatus      WorkloadStatus `json:"workloadStatus"`
+}
+
+// daemonSetData is the reported daemon set, with its status
+type daemonSetData struct {
+	*appsv1.DaemonSet `json:",inline"`
+	WorkloadStatus    WorkloadStatus `json:"workloadStatus"`
+}
+
+// jobData is the reported job, with its status
+type jobData struct {
+	*batchv1.Job   `json:",inline"`
+	WorkloadStatus WorkloadStatus `json:"workloadStatus"`
+}
+
+// DeploymentWatch watch over deployments
+func (wh *WatchHandler) DeploymentWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER DeploymentWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over deployments starting")
+	deploymentWatcher := wh.watchInformer(wh.informerFactory.Apps().V1().Deployments().Informer(), "deployment")
+	glog.Infof("Watching over deployments started")
+	wh.handleInformerEvents(deploymentWatcher, "deployment", wh.deploymentEventHandler)
+}
+
+// StatefulSetWatch watch over stateful sets
+func (wh *WatchHandler) StatefulSetWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER StatefulSetWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over stateful sets starting")
+	statefulSetWatcher := wh.watchInformer(wh.informerFactory.Apps().V1().StatefulSets().Informer(), "statefulset")
+	glog.Infof("Watching over stateful sets started")
+	wh.handleInformerEvents(statefulSetWatcher, "statefulset", wh.statefulSetEventHandler)
+}
+
+// DaemonSetWatch watch over daemon sets
+func (wh *WatchHandler) DaemonSetWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER DaemonSetWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over daemon sets starting")
+	daemonSetWatcher := wh.watchInformer(wh.informerFactory.Apps().V1().DaemonSets().Informer(), "daemonset")
+	glog.Infof("Watching over daemon sets started")
+	wh.handleInformerEvents(daemonSetWatcher, "daemonset", wh.daemonSetEventHandler)
+}
+
+// JobWatch watch over jobs
+func (wh *WatchHandler) JobWatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			glog.Errorf("RECOVER JobWatch. error: %v, stack: %s", err, debug.Stack())
+		}
+	}()
+	glog.Infof("Watching over jobs starting")
+	jobWatcher := wh.watchInformer(wh.informerFactory.Batch().V1().Jobs().Informer(), "job")
+	glog.Infof("Watching over jobs started")
+	wh.handleInformerEvents(jobWatcher, "job", wh.jobEventHandler)
+}
+
+func (wh *WatchHandler) deploymentEventHandler(event *watch.Event) error {
+	deployment, ok := event.Object.(*appsv1.Deployment)
+	if !ok {
+		return fmt.Errorf("got unexpected deployment from chan")
+	}
+	data := &deploymentData{Deployment: deployment, WorkloadStatus: getDeploymentStatus(deployment)}
+	wh.reportWorkloadEvent("Deployment", event.Type, data, wh.deploymentdm, DEPLOYMENTS, isDeploymentChanged)
+	return nil
+}
+
+func (wh *WatchHandler) statefulSetEventHandler(event *watch.Event) error {
+	statefulSet, ok := event.Object.(*appsv1.StatefulSet)
+	if !ok {
+		return fmt.Errorf("got unexpected stateful set from chan")
+	}
+	data := &statefulSetData{StatefulSet: statefulSet, WorkloadStatus: getStatefulSetStatus(statefulSet)}
+	wh.reportWorkloadEvent("StatefulSet", event.Type, data, wh.statefulsetdm, STATEFULSETS, isStatefulSetChanged)
+	return nil
+}
+
+func (wh *WatchHandler) daemonSetEventHandler(event *watch.Event) error {
+	daemonSet, ok := event.Object.(*appsv1.DaemonSet)
+	if !ok {
+		return fmt.Errorf("got unexpected daemon set from chan")
+	}
+	data := &daemonSetData{DaemonSet: daemonSet, WorkloadStatus: getDaemonSetStatus(daemonSet)}
+	wh.reportWorkloadEvent("DaemonSet", event.Type, data, wh.daemonsetdm, DAEMONSETS, isDaemonSetChanged)
+	return nil
+}
+
+func (wh *WatchHandler) jobEventHandler(event *watch.Event) error {
+	job, ok := event.Object.(*batchv1.Job)
+	if !ok {
+		return fmt.Errorf("got unexpected job from chan")
+	}
+	data := &jobData{Job: job, WorkloadStatus: getJobStatus(job)}
+	wh.reportWorkloadEvent("Job", event.Type, data, wh.jobdm, JOBS, isJobChanged)
+	return nil
+}
+
+// reportWorkloadEvent reports the workload, and removes the microservices left without pods when it's deleted
+func (wh *WatchHandler) reportWorkloadEvent(kind string, eventType watch.EventType, obj watchedObject, dm *resourceMap, jtype JsonType, isChanged func(oldObj, newObj watchedObject) bool) {
+	if wh.reportObjectEvent(strings.ToLower(kind), eventType, obj, dm, jtype, isChanged) && eventType == watch.Deleted {
+		wh.removeWorkloadMicroServices(kind, obj.GetNamespace(), obj.GetName())
+	}
+}
+
+// removeWorkloadMicroServices removes the microservices of the deleted workload which have no pods left, like the
+// microservices of a workload scaled to zero. The others are removed with their last pod
+func (wh *WatchHandler) removeWorkloadMicroServices(kind, namespace, name string) {
+	wh.pdmMutex.Lock()
+	defer wh.pdmMutex.Unlock()
+	removed := false
+	for id := range wh.ownerIDs[ownerKey(namespace, kind, name)] {
+		v := wh.pdm[id]
+		if v.Len() != 1 {
+			continue
+		}
+		msd, ok := v.Front().Value.(MicroServiceData)
+		if !ok || msd.Pod == nil || msd.Pod.Namespace != namespace || msd.Owner.Kind != kind || msd.Owner.Name != name {
+			continue
+		}
+		wh.removeMicroService(id)
+		glog.Infof("remove %s.%s", kind, name)
+		wh.jsonReport.AddToJsonFormat(msd, MICROSERVICES, DELETED)
+		removed = true
+	}
+	if removed {
+		wh.notifyMicroServiceChanged(namespace)
+		informNewDataArrive(wh)
+	}
+}
+
+// getDeploymentStatus returns the status of the deployment, its rollout state as kubectl rollout status tells it
+func getDeploymentStatus(deployment *appsv1.Deployment) WorkloadStatus {
+	status := WorkloadStatus{
+		Replicas:          getReplicas(deployment.Spec.Replicas),
+		ReadyReplicas:     deployment.Status.ReadyReplicas,
+		UpdatedReplicas:   deployment.Status.UpdatedReplicas,
+		AvailableReplicas: deployment.Status.AvailableReplicas,
+		Rollout:           RolloutProgressing,
+	}
+	for i := range deployment.Status.Conditions {
+		condition := &deployment.Status.Conditions[i]
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			status.Rollout = RolloutFailed
+			return status
+		}
+	}
+	if deployment.Status.ObservedGeneration >= deployment.Generation &&
+		status.UpdatedReplicas == status.Replicas &&
+		deployment.Status.Replicas == status.UpdatedReplicas &&
+		status.AvailableReplicas == status.UpdatedReplicas {
+		status.Rollout = RolloutComplete
+	}
+	return status
+}
+
+func getStatefulSetStatus(statefulSet *appsv1.StatefulSet) WorkloadStatus {
+	status := WorkloadStatus{
+		Replicas:          getReplicas(statefulSet.Spec.Replicas),
+		ReadyReplicas:     statefulSet.Status.ReadyReplicas,
+		UpdatedReplicas:   statefulSet.Status.UpdatedReplicas,
+		AvailableReplicas: statefulSet.Status.AvailableReplicas,
+		Rollout:           RolloutProgressing,
+	}
+	if statefulSet.Status.ObservedGeneration >= statefulSet.Generation &&
+		status.ReadyReplicas == status.Replicas &&
+		statefulSet.Status.CurrentRevision == statefulSet.Status.UpdateRevision {
+		status.Rollout = RolloutComplete
+	}
+	return status
+}
+
+func getDaemonSetStatus(daemonSet *appsv1.DaemonSet) WorkloadStatus {
+	status := WorkloadStatus{
+		Replicas:          daemonSet.Status.DesiredNumberScheduled,
+		ReadyReplicas:     daemonSet.Status.NumberReady,
+		UpdatedReplicas:   daemonSet.Status.UpdatedNumberScheduled,
+		AvailableReplicas: daemonSet.Status.NumberAvailable,
+		Rollout:           RolloutProgressing,
+	}
+	if daemonSet.Status.ObservedGeneration >= daemonSet.Generation &&
+		status.UpdatedReplicas == status.Replicas &&
+		status.AvailableReplicas == status.Replicas {
+		status.Rollout = RolloutComplete
+	}
+	return status
+}
+
+func getJobStatus(job *batchv1.Job) WorkloadStatus {
+	status := WorkloadStatus{
+		Replicas:          getReplicas(job.Spec.Completions),
+		ReadyReplicas:     job.Status.Active,
+		AvailableReplicas: job.Status.Succeeded,
+		Rollout:           RolloutProgressing,
+	}
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Status != core.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			status.Rollout = RolloutComplete
+		case batchv1.JobFailed:
+			status.Rollout = RolloutFailed
+		}
+	}
+	return status
+}
+
+// getReplicas returns the replicas of the spec, which default to 1
+func getReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+func isDeploymentChanged(oldObj, newObj watchedObject) bool {
+	oldData, newData := oldObj.(*deploymentData), newObj.(*deploymentData)
+	return isObjectMetaChanged(&oldData.ObjectMeta, &newData.ObjectMeta) ||
+		!reflect.DeepEqual(oldData.Spec, newData.Spec) ||
+		oldData.WorkloadStatus != newData.WorkloadStatus
+}
+
+func isStatefulSetChanged(oldObj, newObj watchedObject) bool {
+	oldData, newData := oldObj.(*statefulSetData), newObj.(*statefulSetData)
+	return isObjectMetaChanged(&oldData.ObjectMeta, &newData.ObjectMeta) ||
+		!reflect.DeepEqual(oldData.Spec, newData.Spec) ||
+		oldData.WorkloadStatus != newData.WorkloadStatus
+}
+
+func isDaemonSetChanged(oldObj, newObj watchedObject) bool {
+	oldData, newData := oldObj.(*daemonSetData), newObj.(*daemonSetData)
+	return isObjectMetaChanged(&oldData.ObjectMeta, &newData.ObjectMeta) ||
+		!reflect.DeepEqual(oldData.Spec, newData.Spec) ||
+		oldData.WorkloadStatus != newData.WorkloadStatus
+}
+
+func isJobChanged(oldObj, newObj watchedObject) bool {
+	oldData, newData := oldObj.(*jobData), newObj.(*jobData)
+	return isObjectMetaChanged(&oldData.ObjectMeta, &newData.ObjectMeta) ||
+		!reflect.DeepEqual(oldData.Spec, newData.Spec) ||
+		oldData.WorkloadStatus != newData.WorkloadStatus
+}
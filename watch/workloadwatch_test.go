@@ -0,0 +1,102 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestGetDeploymentStatus(t *testing.T) {
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, ReadyReplicas: 3, AvailableReplicas: 2},
+	}
+	// an old replica is still running
+	assert.Equal(t, WorkloadStatus{Replicas: 2, ReadyReplicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2, Rollout: RolloutProgressing}, getDeploymentStatus(deployment))
+
+	deployment.Status.Replicas = 2
+	assert.Equal(t, RolloutComplete, getDeploymentStatus(deployment).Rollout)
+
+	deployment.Generation = 3
+	assert.Equal(t, RolloutProgressing, getDeploymentStatus(deployment).Rollout)
+
+	deployment.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Status: core.ConditionFalse, Reason: "ProgressDeadlineExceeded"}}
+	assert.Equal(t, RolloutFailed, getDeploymentStatus(deployment).Rollout)
+
+	// scaled to zero
+	replicas = 0
+	deployment = &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: &replicas}}
+	assert.Equal(t, WorkloadStatus{Rollout: RolloutComplete}, getDeploymentStatus(deployment))
+}
+
+func TestGetJobStatus(t *testing.T) {
+	job := &batchv1.Job{Status: batchv1.JobStatus{Active: 1}}
+	assert.Equal(t, WorkloadStatus{Replicas: 1, ReadyReplicas: 1, Rollout: RolloutProgressing}, getJobStatus(job))
+
+	job.Status = batchv1.JobStatus{Succeeded: 1, Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: core.ConditionTrue}}}
+	assert.Equal(t, WorkloadStatus{Replicas: 1, AvailableReplicas: 1, Rollout: RolloutComplete}, getJobStatus(job))
+
+	job.Status = batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: core.ConditionTrue}}}
+	assert.Equal(t, RolloutFailed, getJobStatus(job).Rollout)
+}
+
+func TestDeploymentEventHandler(t *testing.T) {
+	wh := newTestWatchHandler()
+	replicas := int32(0)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", ResourceVersion: "1"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	assert.NoError(t, wh.deploymentEventHandler(&watch.Event{Type: watch.Added, Object: deployment.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Deployments.Created))
+	assert.Equal(t, WorkloadStatus{Rollout: RolloutComplete}, wh.jsonReport.Deployments.Created[0].(*deploymentData).WorkloadStatus)
+
+	// the status is reported when it changes
+	deployment.ResourceVersion = "2"
+	deployment.Status.ObservedGeneration = 1
+	assert.NoError(t, wh.deploymentEventHandler(&watch.Event{Type: watch.Modified, Object: deployment.DeepCopy()}))
+	assert.Nil(t, wh.jsonReport.Deployments.Updated)
+	replicas = 1
+	deployment.ResourceVersion = "3"
+	assert.NoError(t, wh.deploymentEventHandler(&watch.Event{Type: watch.Modified, Object: deployment.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Deployments.Updated))
+	assert.Equal(t, RolloutProgressing, wh.jsonReport.Deployments.Updated[0].(*deploymentData).WorkloadStatus.Rollout)
+
+	// the microservice left without pods is removed with the deployment, the one with pods is removed with its last pod
+	newTestMicroService(wh, 1, "default", "web-1", nil)
+	newTestMicroService(wh, 2, "default", "web-2", nil)
+	wh.addPodData(2, PodDataForExistMicroService{PodName: "web-2", Namespace: "default"})
+	newTestMicroService(wh, 3, "other", "web-3", nil)
+	for _, id := range []int{1, 2, 3} {
+		msd := wh.pdm[id].Front().Value.(MicroServiceData)
+		msd.Owner = OwnerDet{Name: "web", Kind: "Deployment"}
+		wh.setMicroService(msd)
+	}
+	assert.NoError(t, wh.deploymentEventHandler(&watch.Event{Type: watch.Deleted, Object: deployment.DeepCopy()}))
+	assert.Equal(t, 1, len(wh.jsonReport.Deployments.Deleted))
+	assert.Equal(t, 1, len(wh.jsonReport.MicroServices.Deleted))
+	assert.Equal(t, 1, wh.jsonReport.MicroServices.Deleted[0].(MicroServiceData).PodSpecId)
+	assert.Nil(t, wh.pdm[1])
+	assert.NotNil(t, wh.pdm[2])
+	assert.NotNil(t, wh.pdm[3])
+}
+
+func TestIsMicroServiceNeedToBeRemoved(t *testing.T) {
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"}}
+	wh := newTestWatchHandler(statefulSet)
+	defer close(wh.stopChan)
+	wh.informerFactory.Apps().V1().StatefulSets().Informer()
+	wh.informerFactory.Start(wh.stopChan)
+	wh.informerFactory.WaitForCacheSync(wh.stopChan)
+
+	assert.False(t, wh.isMicroServiceNeedToBeRemoved("StatefulSet", "default", "db"))
+	assert.True(t, wh.isMicroServiceNeedToBeRemoved("StatefulSet", "default", "cache"))
+	assert.False(t, wh.isMicroServiceNeedToBeRemoved("Rollout", "default", "db"))
+}